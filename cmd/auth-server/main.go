@@ -3,34 +3,49 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"expvar"
 	"flag"
 	"fmt"
 	"github.com/cwkr/authd/internal/fileutil"
 	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/mail"
 	"github.com/cwkr/authd/internal/maputil"
 	"github.com/cwkr/authd/internal/oauth2"
 	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/families"
+	"github.com/cwkr/authd/internal/oauth2/keys"
+	"github.com/cwkr/authd/internal/oauth2/opaque"
+	"github.com/cwkr/authd/internal/oauth2/subjects"
 	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/passkeys"
+	"github.com/cwkr/authd/internal/passwordhash"
 	"github.com/cwkr/authd/internal/people"
 	"github.com/cwkr/authd/internal/server"
 	"github.com/cwkr/authd/internal/sqlutil"
+	"github.com/cwkr/authd/internal/totp"
 	"github.com/cwkr/authd/middleware"
 	"github.com/cwkr/authd/settings"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/hjson/hjson-go/v4"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 )
 
 var version = "v0.7.x"
 
+// rateLimitGroups are the endpoint groups that can be limited with rate_limits
+var rateLimitGroups = []string{"authorize", "login", "token", "revoke", "introspect", "people_api"}
+
 func main() {
 	var (
 		serverSettings       *settings.Server
@@ -38,6 +53,11 @@ func main() {
 		accessTokenValidator middleware.AccessTokenValidator
 		peopleStore          people.Store
 		trlStore             trl.Store
+		familyStore          families.Store
+		lockoutStore         lockout.Store
+		subjectStore         subjects.Store
+		opaqueStore          opaque.Store
+		passkeyStore         passkeys.Store
 		clientStore          clients.Store
 		err                  error
 		configFilename       string
@@ -50,6 +70,7 @@ func main() {
 		setFamilyName        string
 		setEmail             string
 		setDepartment        string
+		enrollOTP            bool
 		keySize              int
 		keyID                string
 		saveSettings         bool
@@ -68,6 +89,7 @@ func main() {
 	flag.StringVar(&setFamilyName, "family-name", "", "set user family name")
 	flag.StringVar(&setEmail, "email", "", "set user email")
 	flag.StringVar(&setDepartment, "department", "", "set user department")
+	flag.BoolVar(&enrollOTP, "otp", false, "generate one-time password secret and recovery codes for user")
 	flag.IntVar(&keySize, "key-size", 2048, "generated signing key size")
 	flag.StringVar(&keyID, "key-id", "sigkey", "set generated signing key id")
 	flag.BoolVar(&saveSettings, "save", false, "save config and exit")
@@ -101,17 +123,29 @@ func main() {
 		}
 	}
 
-	if serverSettings.Key == "" {
+	if serverSettings.Key == "" && serverSettings.KeyRotation == nil && serverSettings.KeyStore == nil && serverSettings.PKCS11 == nil {
 		log.Printf("Generating %d bit RSA key with ID %q", keySize, keyID)
 		if err := serverSettings.GenerateSigningKey(keySize, keyID); err != nil {
 			log.Fatalf("!!! %s", err)
 		}
 	}
 
-	if err := serverSettings.LoadKeys(filepath.Dir(settingsFilename)); err != nil {
+	var dbs = make(map[string]*sql.DB)
+
+	if err := serverSettings.LoadKeys(filepath.Dir(settingsFilename), dbs); err != nil {
 		log.Fatalf("!!! %s", err)
 	}
 
+	if rotatingManager, ok := serverSettings.KeyManager().(keys.RotatingManager); ok {
+		go func() {
+			for range time.Tick(time.Minute) {
+				if err := rotatingManager.Rotate(); err != nil {
+					log.Printf("!!! %s", err)
+				}
+			}
+		}()
+	}
+
 	if serverSettings.LoginTemplate != "" {
 		var filename = filepath.Join(filepath.Dir(settingsFilename), strings.TrimPrefix(serverSettings.LoginTemplate, "@"))
 		log.Printf("Loading login form template from %s", filename)
@@ -130,16 +164,23 @@ func main() {
 		}
 	}
 
+	var passwordHashing = passwordhash.DefaultSettings
+	if serverSettings.PasswordHashing != nil {
+		passwordHashing = *serverSettings.PasswordHashing
+	}
+	var hasher *passwordhash.Hasher
+	if hasher, err = passwordhash.NewHasher(passwordHashing); err != nil {
+		log.Fatalf("!!! invalid password hashing: %s", err)
+	}
+
 	if setClientID != "" {
 		if serverSettings.Clients == nil {
 			serverSettings.Clients = map[string]clients.Client{}
 		}
 		var client = serverSettings.Clients[setClientID]
 		if setClientSecret != "" {
-			if secretHash, err := bcrypt.GenerateFromPassword([]byte(setClientSecret), 5); err != nil {
+			if client.SecretHash, err = hasher.Hash(setClientSecret); err != nil {
 				log.Fatalf("!!! %s", err)
-			} else {
-				client.SecretHash = string(secretHash)
 			}
 		}
 		serverSettings.Clients[setClientID] = client
@@ -151,10 +192,8 @@ func main() {
 		}
 		var user = serverSettings.Users[setUserID]
 		if setPassword != "" {
-			if passwordHash, err := bcrypt.GenerateFromPassword([]byte(setPassword), 5); err != nil {
+			if user.PasswordHash, err = hasher.Hash(setPassword); err != nil {
 				log.Fatalf("!!! %s", err)
-			} else {
-				user.PasswordHash = string(passwordHash)
 			}
 		}
 		if setGivenName != "" {
@@ -172,6 +211,17 @@ func main() {
 		if user.PasswordHash == "" {
 			log.Fatal("!!! missing password")
 		}
+		if enrollOTP {
+			if user.OTPCredentials.Secret, err = totp.GenerateSecret(); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+			var recoveryCodes []string
+			if recoveryCodes, user.OTPCredentials.RecoveryCodes, err = totp.GenerateRecoveryCodes(10); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+			log.Printf("One-time password key URI: %s", totp.KeyURI(otpIssuerName(serverSettings), setUserID, user.OTPCredentials.Secret))
+			log.Printf("Recovery codes: %s", strings.Join(recoveryCodes, " "))
+		}
 		serverSettings.Users[setUserID] = user
 	}
 
@@ -199,32 +249,13 @@ func main() {
 
 	var scope = strings.TrimSpace(oauth2.OIDCDefaultScope + " " + serverSettings.ExtraScope)
 
-	tokenCreator, err = oauth2.NewTokenCreator(
-		serverSettings.PrivateKey(),
-		serverSettings.KeyID(),
-		serverSettings.Issuer,
-		scope,
-		int64(serverSettings.AccessTokenTTL),
-		int64(serverSettings.RefreshTokenTTL),
-		int64(serverSettings.IDTokenTTL),
-		serverSettings.AccessTokenExtraClaims,
-		serverSettings.IDTokenExtraClaims,
-		serverSettings.Roles,
-		serverSettings.UsePSS,
-	)
-	if err != nil {
-		log.Fatalf("!!! %s", err)
-	}
-
-	accessTokenValidator = middleware.NewAccessTokenValidator(serverSettings.KeySetProvider())
-
 	var basePath = ""
 	var sessionStore = sessions.NewCookieStore([]byte(serverSettings.SessionSecret))
 	sessionStore.Options.HttpOnly = true
 	sessionStore.Options.MaxAge = 0
 	sessionStore.Options.SameSite = http.SameSiteLaxMode
 	if issuerUrl, err := url.Parse(serverSettings.Issuer); err == nil {
-		if issuerUrl.Path != "/" {
+		if issuerUrl.Path != "/" && issuerUrl.Path != "" {
 			basePath = strings.TrimSuffix(issuerUrl.Path, "/")
 			sessionStore.Options.Path = basePath
 			sessionStore.Options.Secure = false
@@ -236,13 +267,11 @@ func main() {
 		log.Fatalf("!!! %s", err)
 	}
 
-	var dbs = make(map[string]*sql.DB)
-
 	var users = maputil.LowerKeys(serverSettings.Users)
 
 	if serverSettings.PeopleStore != nil {
 		if sqlutil.IsDatabaseURI(serverSettings.PeopleStore.URI) {
-			if peopleStore, err = people.NewSqlStore(sessionStore, users, int64(serverSettings.SessionTTL), dbs, serverSettings.PeopleStore); err != nil {
+			if peopleStore, err = people.NewSqlStore(sessionStore, users, int64(serverSettings.SessionTTL), dbs, serverSettings.PeopleStore, hasher); err != nil {
 				log.Fatalf("!!! %s", err)
 			}
 		} else if strings.HasPrefix(serverSettings.PeopleStore.URI, "ldap:") || strings.HasPrefix(serverSettings.PeopleStore.URI, "ldaps:") {
@@ -267,19 +296,224 @@ func main() {
 	} else {
 		clientStore = clients.NewInMemoryClientStore(serverSettings.Clients)
 	}
+	for clientID, client := range serverSettings.Clients {
+		if client.SecretHash != "" && !passwordhash.IsHash(client.SecretHash) {
+			log.Printf("!!! client %s has a plaintext secret, hash it with -client-id %s -client-secret ... -save", clientID, clientID)
+		}
+	}
+
+	var mailer mail.Mailer
+	if serverSettings.Mail != nil {
+		if mailer, err = mail.NewMailer(*serverSettings.Mail, filepath.Dir(settingsFilename)); err != nil {
+			log.Fatalf("!!! %s", err)
+		}
+	} else if serverSettings.EmailLogin != nil {
+		log.Fatal("!!! email login requires mail settings")
+	} else if serverSettings.PasswordReset != nil {
+		log.Fatal("!!! password reset requires mail settings")
+	}
 
+	var acrLevels = serverSettings.ACRLevels
+	if len(acrLevels) == 0 {
+		acrLevels = oauth2.DefaultACRLevels
+	}
+	var mfaPolicy = oauth2.MFAPolicy{RequiredRoles: serverSettings.MFARequiredRoles, RoleMappings: serverSettings.Roles, ACRLevels: acrLevels}
+	var webAuthn *webauthn.WebAuthn
+	if serverSettings.WebAuthn != nil {
+		if webAuthn, err = passkeys.NewWebAuthn(*serverSettings.WebAuthn, serverSettings.Issuer, serverSettings.Title); err != nil {
+			log.Fatalf("!!! %s", err)
+		}
+		if serverSettings.PasskeyStore != nil {
+			if sqlutil.IsDatabaseURI(serverSettings.PasskeyStore.URI) {
+				if passkeyStore, err = passkeys.NewSqlStore(dbs, serverSettings.PasskeyStore); err != nil {
+					log.Fatalf("!!! %s", err)
+				}
+			} else if passkeys.IsBoltURI(serverSettings.PasskeyStore.URI) {
+				var filename = strings.TrimPrefix(serverSettings.PasskeyStore.URI, passkeys.BoltURIPrefix)
+				if !filepath.IsAbs(filename) {
+					filename = filepath.Join(filepath.Dir(settingsFilename), filename)
+				}
+				if passkeyStore, err = passkeys.NewBoltStore(filename); err != nil {
+					log.Fatalf("!!! %s", err)
+				}
+			} else {
+				log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.PasskeyStore.URI)
+			}
+		} else {
+			log.Print("No passkey store configured, registered passkeys are lost on restart")
+			passkeyStore = passkeys.NewInMemoryStore()
+		}
+		mfaPolicy.PasskeyStore = passkeyStore
+	}
+	var issuerName = otpIssuerName(serverSettings)
+
+	var trlPurgeInterval = time.Hour
 	if serverSettings.TRLStore != nil {
 		if sqlutil.IsDatabaseURI(serverSettings.TRLStore.URI) {
 			if trlStore, err = trl.NewSqlStore(dbs, serverSettings.TRLStore); err != nil {
 				log.Fatalf("!!! %s", err)
 			}
+		} else if trl.IsBoltURI(serverSettings.TRLStore.URI) {
+			var filename = strings.TrimPrefix(serverSettings.TRLStore.URI, trl.BoltURIPrefix)
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(filepath.Dir(settingsFilename), filename)
+			}
+			log.Printf("Opening token revocation list %s", filename)
+			if trlStore, err = trl.NewBoltStore(filename); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
 		} else {
 			log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.TRLStore.URI)
 		}
+		if serverSettings.TRLStore.CacheTTL > 0 {
+			var cacheSize = serverSettings.TRLStore.CacheSize
+			if cacheSize <= 0 {
+				cacheSize = 10_000
+			}
+			trlStore = trl.NewCachingStore(trlStore, time.Duration(serverSettings.TRLStore.CacheTTL)*time.Second, cacheSize)
+		}
+		if serverSettings.TRLStore.PurgeInterval > 0 {
+			trlPurgeInterval = time.Duration(serverSettings.TRLStore.PurgeInterval) * time.Second
+		}
 	} else {
+		log.Print("No token revocation list store configured, revocations are not remembered")
 		trlStore = trl.NewNoopStore()
 	}
 
+	var trlCutoffTTL = time.Duration(serverSettings.RevocationCutoffTTL()) * time.Second
+	go func() {
+		trl.PurgeExpired(trlStore, trlCutoffTTL)
+		for range time.Tick(trlPurgeInterval) {
+			trl.PurgeExpired(trlStore, trlCutoffTTL)
+		}
+	}()
+
+	if serverSettings.FamilyStore != nil {
+		if sqlutil.IsDatabaseURI(serverSettings.FamilyStore.URI) {
+			if familyStore, err = families.NewSqlStore(dbs, serverSettings.FamilyStore); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+		} else {
+			log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.FamilyStore.URI)
+		}
+	} else {
+		log.Print("!!! refresh token families are kept in memory, reuse of refresh tokens rotated before a restart is not detected; configure refresh_token_family_store in production")
+		familyStore = families.NewInMemoryStore()
+	}
+
+	var lockoutSettings lockout.Settings
+	if serverSettings.Lockout != nil {
+		lockoutSettings = *serverSettings.Lockout
+	}
+	if serverSettings.LockoutStore != nil {
+		if sqlutil.IsDatabaseURI(serverSettings.LockoutStore.URI) {
+			if lockoutStore, err = lockout.NewSqlStore(dbs, serverSettings.LockoutStore); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+		} else {
+			log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.LockoutStore.URI)
+		}
+	} else {
+		lockoutStore = lockout.NewInMemoryStore(lockoutSettings)
+	}
+	var lockoutGuard = lockout.NewGuard(lockoutStore, lockoutSettings)
+
+	var passwordPolicy = people.DefaultPasswordPolicy
+	if serverSettings.PasswordPolicy != nil {
+		passwordPolicy = *serverSettings.PasswordPolicy
+	}
+	if err := passwordPolicy.Validate(); err != nil {
+		log.Fatalf("!!! invalid password policy: %s", err)
+	}
+
+	if serverSettings.SubjectStore != nil {
+		if sqlutil.IsDatabaseURI(serverSettings.SubjectStore.URI) {
+			if subjectStore, err = subjects.NewSqlStore(dbs, serverSettings.SubjectStore); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+		} else {
+			log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.SubjectStore.URI)
+		}
+	}
+	// clients from a client store are validated when they are used
+	var subjectMapper = oauth2.NewSubjectMapper(serverSettings.PairwiseSalt, subjectStore)
+	for clientID, client := range serverSettings.Clients {
+		if err := subjectMapper.Validate(client); err != nil {
+			log.Fatalf("!!! client %s: %s", clientID, err)
+		}
+	}
+
+	if serverSettings.OpaqueTokenStore != nil {
+		if sqlutil.IsDatabaseURI(serverSettings.OpaqueTokenStore.URI) {
+			if opaqueStore, err = opaque.NewSqlStore(dbs, serverSettings.OpaqueTokenStore); err != nil {
+				log.Fatalf("!!! %s", err)
+			}
+		} else {
+			log.Fatalf("!!! unsupported or empty store uri: %s", serverSettings.OpaqueTokenStore.URI)
+		}
+	} else {
+		opaqueStore = opaque.NewInMemoryStore()
+	}
+
+	tokenCreator, err = oauth2.NewTokenCreator(
+		serverSettings.KeyManager(),
+		serverSettings.Issuer,
+		scope,
+		int64(serverSettings.AccessTokenTTL),
+		int64(serverSettings.RefreshTokenTTL),
+		int64(serverSettings.IDTokenTTL),
+		serverSettings.AccessTokenExtraClaims,
+		serverSettings.IDTokenExtraClaims,
+		serverSettings.Roles,
+		acrLevels,
+		oauth2.NewClientKeySets(filepath.Dir(settingsFilename), time.Duration(serverSettings.KeysTTL)*time.Second),
+		subjectMapper,
+		opaqueStore,
+	)
+	if err != nil {
+		log.Fatalf("!!! %s", err)
+	}
+
+	accessTokenValidator = middleware.NewAccessTokenValidator(serverSettings.KeySetProvider(), opaqueStore)
+	switch serverSettings.RevocationCheck {
+	case "":
+	case settings.RevocationCheckTRL, settings.RevocationCheckSnapshot:
+		var validatorTRLStore = trlStore
+		if serverSettings.RevocationCheck == settings.RevocationCheckSnapshot {
+			validatorTRLStore = trl.NewSnapshotStore(trlStore, time.Duration(serverSettings.RevocationSnapshotTTL)*time.Second)
+		}
+		accessTokenValidator = middleware.NewRevocationValidator(accessTokenValidator, validatorTRLStore, func(clientID, subject string) (string, error) {
+			var client, err = clientStore.Lookup(clientID)
+			if err != nil {
+				return "", err
+			}
+			return tokenCreator.ResolveSubject(*client, subject)
+		})
+	default:
+		log.Fatalf("!!! unsupported revocation check: %s", serverSettings.RevocationCheck)
+	}
+
+	var rateLimiters = map[string]*middleware.RateLimiter{}
+	for group, rateLimit := range serverSettings.RateLimits {
+		if !slices.Contains(rateLimitGroups, group) {
+			log.Fatalf("!!! unknown rate limit group: %s", group)
+		}
+		if rateLimiters[group], err = middleware.NewRateLimiter(rateLimit); err != nil {
+			log.Fatalf("!!! %s", err)
+		}
+	}
+	// rateLimit limits the handler with the limiter shared by all endpoints of the group
+	var rateLimit = func(group string, next http.Handler) http.Handler {
+		if rateLimiter, found := rateLimiters[group]; found {
+			return middleware.RateLimit(next, rateLimiter)
+		}
+		return next
+	}
+	trustedProxies, err := middleware.ParseTrustedProxies(serverSettings.TrustedProxies)
+	if err != nil {
+		log.Fatalf("!!! invalid trusted proxies: %s", err)
+	}
+
 	var router = mux.NewRouter()
 
 	router.NotFoundHandler = htmlutil.NotFoundHandler(basePath)
@@ -295,47 +529,118 @@ func main() {
 		Methods(http.MethodGet)
 	router.Handle(basePath+"/favicon-32x32.png", server.Favicon32x32Handler()).
 		Methods(http.MethodGet)
-	router.Handle(basePath+"/login", server.LoginHandler(basePath, peopleStore, clientStore, serverSettings.Issuer, serverSettings.SessionName)).
+	router.Handle(basePath+"/login", rateLimit("login", server.LoginHandler(basePath, peopleStore, clientStore, sessionStore, mfaPolicy, lockoutGuard, serverSettings.EmailLogin != nil, serverSettings.PasswordReset != nil, serverSettings.Issuer, serverSettings.SessionName))).
+		Methods(http.MethodGet, http.MethodPost)
+	if serverSettings.EmailLogin != nil {
+		var emailLogin = *serverSettings.EmailLogin
+		if emailLogin.LinkTTL <= 0 {
+			emailLogin.LinkTTL = 900
+		}
+		if emailLogin.MaxMessages <= 0 {
+			emailLogin.MaxMessages = 5
+		}
+		if emailLogin.Subject == "" {
+			emailLogin.Subject = "Your login link"
+		}
+		router.Handle(basePath+"/login/email", rateLimit("login", server.EmailLoginHandler(basePath, peopleStore, clientStore, sessionStore, mfaPolicy, mailer, emailLogin, []byte(serverSettings.SessionSecret), serverSettings.Issuer, serverSettings.SessionName))).
+			Methods(http.MethodGet, http.MethodPost)
+	}
+	if serverSettings.PasswordReset != nil {
+		var hashStore, ok = peopleStore.(people.PasswordHashStore)
+		if peopleStore.ReadOnly() || !ok {
+			log.Fatal("!!! password reset requires a writable people store")
+		}
+		if serverSettings.TRLStore == nil {
+			log.Fatal("!!! password reset requires trl_store to end sessions and revoke refresh tokens")
+		}
+		var passwordReset = *serverSettings.PasswordReset
+		if passwordReset.LinkTTL <= 0 {
+			passwordReset.LinkTTL = 900
+		}
+		if passwordReset.MaxMessages <= 0 {
+			passwordReset.MaxMessages = 3
+		}
+		if passwordReset.Subject == "" {
+			passwordReset.Subject = "Reset your password"
+		}
+		router.Handle(basePath+"/login/reset", rateLimit("login", server.PasswordResetHandler(basePath, peopleStore, hashStore, trlStore, lockoutGuard, passwordPolicy, mailer, passwordReset, []byte(serverSettings.SessionSecret), serverSettings.Issuer))).
+			Methods(http.MethodGet, http.MethodPost)
+	}
+	router.Handle(basePath+"/login/stepup", rateLimit("login", server.StepUpHandler(basePath, peopleStore, clientStore, sessionStore, mfaPolicy, serverSettings.Issuer, serverSettings.SessionName))).
+		Methods(http.MethodGet)
+	router.Handle(basePath+"/login/otp", rateLimit("login", server.OTPHandler(basePath, peopleStore, clientStore, sessionStore, mfaPolicy, lockoutGuard, serverSettings.Issuer, issuerName, serverSettings.SessionName))).
 		Methods(http.MethodGet, http.MethodPost)
+	if webAuthn != nil {
+		var webAuthnHandler = rateLimit("login", server.WebAuthnHandler(basePath, webAuthn, passkeyStore, peopleStore, clientStore, sessionStore, serverSettings.Issuer, serverSettings.SessionName))
+		router.Handle(basePath+"/login/webauthn", webAuthnHandler).
+			Methods(http.MethodGet)
+		router.Handle(basePath+"/login/webauthn/{step:begin|finish}", webAuthnHandler).
+			Methods(http.MethodPost)
+		router.Handle(basePath+"/scripts/webauthn.js", server.WebAuthnScriptHandler()).
+			Methods(http.MethodGet)
+	}
 	router.Handle(basePath+"/logout", server.LogoutHandler(basePath, serverSettings, sessionStore, clientStore))
 	router.Handle(basePath+"/health", server.HealthHandler(peopleStore)).
 		Methods(http.MethodGet)
 	router.Handle(basePath+"/info", server.InfoHandler(version, runtime.Version())).
 		Methods(http.MethodGet)
+	if serverSettings.EnableMetrics {
+		router.Handle(basePath+"/debug/vars", expvar.Handler()).
+			Methods(http.MethodGet)
+	}
 
 	router.Handle(basePath+"/jwks", oauth2.JwksHandler(serverSettings.KeySetProvider())).
 		Methods(http.MethodGet, http.MethodOptions)
-	router.Handle(basePath+"/token", oauth2.TokenHandler(tokenCreator, peopleStore, clientStore, trlStore, scope)).
+	router.Handle(basePath+"/token", rateLimit("token", oauth2.TokenHandler(tokenCreator, peopleStore, clientStore, trlStore, familyStore, mfaPolicy, lockoutGuard, scope))).
 		Methods(http.MethodOptions, http.MethodPost)
-	router.Handle(basePath+"/authorize", oauth2.AuthorizeHandler(basePath, tokenCreator, peopleStore, clientStore, scope, serverSettings.SessionName)).
+	router.Handle(basePath+"/authorize", rateLimit("authorize", oauth2.AuthorizeHandler(basePath, tokenCreator, peopleStore, clientStore, trlStore, mfaPolicy, scope, serverSettings.SessionName))).
 		Methods(http.MethodGet)
-	router.Handle(basePath+"/.well-known/openid-configuration", oauth2.DiscoveryDocumentHandler(serverSettings.Issuer, scope)).
+	router.Handle(basePath+"/.well-known/openid-configuration", oauth2.DiscoveryDocumentHandler(serverSettings.Issuer, scope, serverSettings.KeyManager(), serverSettings.Algorithm(), acrLevels)).
 		Methods(http.MethodGet, http.MethodOptions)
-	router.Handle(basePath+"/userinfo", middleware.RequireJWT(oauth2.UserInfoHandler(peopleStore, serverSettings.AccessTokenExtraClaims, serverSettings.Roles), accessTokenValidator, serverSettings.Issuer)).
+	router.Handle(basePath+"/userinfo", middleware.RequireJWT(oauth2.UserInfoHandler(tokenCreator, peopleStore, clientStore, serverSettings.AccessTokenExtraClaims, serverSettings.Roles), accessTokenValidator, serverSettings.Issuer)).
 		Methods(http.MethodGet, http.MethodOptions)
 
-	router.Handle(basePath+"/revoke", oauth2.RevokeHandler(tokenCreator, clientStore, trlStore)).
+	router.Handle(basePath+"/revoke", rateLimit("revoke", oauth2.RevokeHandler(tokenCreator, clientStore, trlStore, familyStore, opaqueStore))).
+		Methods(http.MethodPost, http.MethodOptions)
+	router.Handle(basePath+"/introspect", rateLimit("introspect", oauth2.IntrospectHandler(tokenCreator, clientStore, trlStore, serverSettings.IntrospectionClients))).
 		Methods(http.MethodPost, http.MethodOptions)
 
 	if !serverSettings.DisableAPI {
-		var lookupPersonHandler = server.LookupPersonHandler(peopleStore,
-			serverSettings.PeopleAPICustomVersions, serverSettings.Roles)
+		var lookupPersonHandler = rateLimit("people_api", server.LookupPersonHandler(peopleStore,
+			serverSettings.PeopleAPICustomVersions, serverSettings.Roles))
 		if serverSettings.PeopleAPIRequireAuthN {
 			lookupPersonHandler = middleware.RequireJWT(lookupPersonHandler, accessTokenValidator, serverSettings.Issuer)
 		}
 		router.Handle(basePath+"/api/{version}/people/{user_id}", lookupPersonHandler).
 			Methods(http.MethodGet, http.MethodOptions)
+		if len(serverSettings.AdminClients) > 0 {
+			router.Handle(basePath+"/api/v1/revocations", server.RevokeTokensHandler(clientStore, trlStore, serverSettings.AdminClients)).
+				Methods(http.MethodOptions, http.MethodPost)
+			router.Handle(basePath+"/api/v1/people/{user_id}/lockout", server.UnlockPersonHandler(clientStore, lockoutGuard, serverSettings.AdminClients)).
+				Methods(http.MethodOptions, http.MethodDelete)
+		}
 		if !peopleStore.ReadOnly() {
-			router.Handle(basePath+"/api/v1/people/{user_id}", middleware.RequireJWT(server.PutPersonHandler(peopleStore), accessTokenValidator, serverSettings.Issuer)).
+			router.Handle(basePath+"/api/v1/people/{user_id}", middleware.RequireJWT(rateLimit("people_api", server.PutPersonHandler(peopleStore)), accessTokenValidator, serverSettings.Issuer)).
 				Methods(http.MethodPut)
-			router.Handle(basePath+"/api/v1/people/{user_id}/password", middleware.RequireJWT(server.ChangePasswordHandler(peopleStore), accessTokenValidator, serverSettings.Issuer)).
+			router.Handle(basePath+"/api/v1/people/{user_id}/password", middleware.RequireJWT(rateLimit("people_api", server.ChangePasswordHandler(peopleStore, passwordPolicy, lockoutGuard)), accessTokenValidator, serverSettings.Issuer)).
 				Methods(http.MethodOptions, http.MethodPut)
 		}
 	}
 
 	log.Printf("Listening on http://localhost:%d%s/", serverSettings.Port, basePath)
-	err = http.ListenAndServe(fmt.Sprintf(":%d", serverSettings.Port), router)
+	err = http.ListenAndServe(fmt.Sprintf(":%d", serverSettings.Port), middleware.TrustProxies(router, trustedProxies))
 	if err != nil {
 		log.Fatalf("!!! %s", err)
 	}
 }
+
+// otpIssuerName returns the name authenticator apps show next to the account
+func otpIssuerName(serverSettings *settings.Server) string {
+	if serverSettings.Title != "" {
+		return serverSettings.Title
+	}
+	if issuerUrl, err := url.Parse(serverSettings.Issuer); err == nil && issuerUrl.Hostname() != "" {
+		return issuerUrl.Hostname()
+	}
+	return serverSettings.Issuer
+}
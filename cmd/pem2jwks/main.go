@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/keyset"
 	"github.com/go-jose/go-jose/v3"
 	"log"
 	"os"
@@ -18,7 +19,7 @@ func main() {
 	flag.StringVar(&outFilename, "o", "", "output file")
 	flag.Parse()
 
-	var publicKeys, err = oauth2.LoadPublicKeys("./", flag.Args())
+	var publicKeys, err = keyset.NewProvider("", flag.Args(), 0).Get()
 	if err != nil {
 		panic(err)
 	}
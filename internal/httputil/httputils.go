@@ -2,6 +2,7 @@ package httputil
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -24,6 +25,14 @@ func ExtractAccessToken(r *http.Request) string {
 	return ""
 }
 
+// RemoteAddr returns the IP address of the client without port
+func RemoteAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
 func AllowCORS(w http.ResponseWriter, r *http.Request, allowMethods []string, allowCredentials bool) {
 	var allowedMethods = strings.Join(allowMethods, ", ")
 
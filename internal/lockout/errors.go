@@ -0,0 +1,7 @@
+package lockout
+
+import "errors"
+
+var (
+	ErrTooManyFailures = errors.New("too many failed login attempts, try again later")
+)
@@ -0,0 +1,144 @@
+package lockout
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+type Settings struct {
+	// MaxFailures is the number of failed attempts after which a user is locked out
+	MaxFailures int `json:"max_failures,omitempty"`
+	// MaxFailuresPerIP is the number of failed attempts after which a source address is locked out
+	MaxFailuresPerIP int `json:"max_failures_per_ip,omitempty"`
+	// Delay is the wait in seconds after the first failed attempt of a user, it doubles with every further failure
+	Delay int `json:"delay,omitempty"`
+	// Duration is the lockout in seconds, failed attempts are forgotten after the same time
+	Duration int `json:"duration,omitempty"`
+	// MaxKeys is the number of counters kept in memory, the least recently updated counter is dropped for a new one
+	MaxKeys int `json:"max_keys,omitempty"`
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.MaxFailures <= 0 {
+		s.MaxFailures = 5
+	}
+	if s.MaxFailuresPerIP <= 0 {
+		s.MaxFailuresPerIP = 50
+	}
+	if s.Delay <= 0 {
+		s.Delay = 1
+	}
+	if s.Duration <= 0 {
+		s.Duration = 900
+	}
+	if s.MaxKeys <= 0 {
+		s.MaxKeys = 100_000
+	}
+	return s
+}
+
+// Guard counts failed logins per user and per source address. Counters are kept for unknown users as well, so a
+// lockout does not reveal whether an account exists.
+type Guard struct {
+	store    Store
+	settings Settings
+}
+
+func NewGuard(store Store, settings Settings) *Guard {
+	return &Guard{store: store, settings: settings.withDefaults()}
+}
+
+func userKey(userID string) string {
+	return "user:" + strings.ToLower(userID)
+}
+
+func addrKey(addr string) string {
+	return "ip:" + addr
+}
+
+func (g *Guard) duration() time.Duration {
+	return time.Duration(g.settings.Duration) * time.Second
+}
+
+// wait returns how long a user has to wait after the given number of failures
+func (g *Guard) wait(failures, maxFailures int, progressive bool) time.Duration {
+	if failures >= maxFailures {
+		return g.duration()
+	}
+	if !progressive || failures == 0 {
+		return 0
+	}
+	var delay = time.Duration(g.settings.Delay) * time.Second << min(failures-1, 16)
+	return min(delay, g.duration())
+}
+
+// Reserve counts an attempt of the user from the source address before the credentials are verified, so concurrent
+// guesses can not pass the lockout together. It returns ErrTooManyFailures and the time until the next attempt is
+// accepted when the user or the source address has to wait, rejected attempts are not counted so they do not extend
+// the wait.
+func (g *Guard) Reserve(userID, addr string) (time.Duration, error) {
+	var now = time.Now()
+	var retryAfter time.Duration
+	var reserved []string
+	for _, check := range []struct {
+		key         string
+		maxFailures int
+		progressive bool
+	}{
+		{userKey(userID), g.settings.MaxFailures, true},
+		{addrKey(addr), g.settings.MaxFailuresPerIP, false},
+	} {
+		if err := g.store.Update(check.key, now, func(counter Counter) Counter {
+			// failures older than the lockout duration are forgotten
+			if counter.LastFailure.Add(g.duration()).Before(now) {
+				counter.Failures = 0
+			}
+			if counter.Failures > 0 {
+				if until := counter.LastFailure.Add(g.wait(counter.Failures, check.maxFailures, check.progressive)); now.Before(until) {
+					retryAfter = until.Sub(now)
+					return counter
+				}
+			}
+			return Counter{Failures: counter.Failures + 1, LastFailure: now}
+		}); err != nil {
+			return 0, err
+		}
+		if retryAfter > 0 {
+			break
+		}
+		reserved = append(reserved, check.key)
+	}
+	if retryAfter > 0 {
+		// the attempt counted for the user is released when the source address has to wait
+		for _, key := range reserved {
+			if err := g.release(key); err != nil {
+				return 0, err
+			}
+		}
+		log.Printf("!!! login of user_id=%s from %s rejected for %v", userID, addr, retryAfter.Round(time.Second))
+		return retryAfter, ErrTooManyFailures
+	}
+	return 0, nil
+}
+
+func (g *Guard) release(key string) error {
+	return g.store.Update(key, time.Now(), func(counter Counter) Counter {
+		counter.Failures = max(counter.Failures-1, 0)
+		return counter
+	})
+}
+
+// Succeeded forgets the failed attempts of the user and releases the attempt reserved for the source address
+func (g *Guard) Succeeded(userID, addr string) error {
+	if err := g.store.Reset(userKey(userID)); err != nil {
+		return err
+	}
+	return g.release(addrKey(addr))
+}
+
+// Unlock lifts the lockout of the user
+func (g *Guard) Unlock(userID string) error {
+	log.Printf("unlocking user_id=%s", userID)
+	return g.store.Reset(userKey(userID))
+}
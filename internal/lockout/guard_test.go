@@ -0,0 +1,113 @@
+package lockout
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveConcurrent(t *testing.T) {
+	var settings = Settings{MaxFailures: 5, Delay: 60}
+	var guard = NewGuard(NewInMemoryStore(settings), settings)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var accepted int
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := guard.Reserve("alice", "192.0.2.1"); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrTooManyFailures) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("accepted %d concurrent attempts, want 1", accepted)
+	}
+}
+
+func TestSucceeded(t *testing.T) {
+	var settings = Settings{MaxFailures: 5, MaxFailuresPerIP: 2}
+	var guard = NewGuard(NewInMemoryStore(settings), settings)
+
+	for range 3 {
+		if _, err := guard.Reserve("alice", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Succeeded("alice", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// successful logins do not count against the source address
+	if _, err := guard.Reserve("bob", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter, err := guard.Reserve("bob", "192.0.2.1"); !errors.Is(err, ErrTooManyFailures) || retryAfter <= 0 {
+		t.Errorf("second failure of bob: retryAfter=%v err=%v", retryAfter, err)
+	}
+}
+
+func TestRejectedAttemptsNotCounted(t *testing.T) {
+	var settings = Settings{MaxFailures: 1, Duration: 1}
+	var guard = NewGuard(NewInMemoryStore(settings), settings)
+
+	if _, err := guard.Reserve("alice", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	var last = time.Second
+	for range 5 {
+		var retryAfter, err = guard.Reserve("alice", "192.0.2.1")
+		if !errors.Is(err, ErrTooManyFailures) || retryAfter <= 0 || retryAfter > last {
+			t.Fatalf("attempt during lockout: retryAfter=%v err=%v", retryAfter, err)
+		}
+		last = retryAfter
+		time.Sleep(100 * time.Millisecond)
+	}
+	// attempts during the lockout do not extend it
+	time.Sleep(last + 100*time.Millisecond)
+	if _, err := guard.Reserve("alice", "192.0.2.1"); err != nil {
+		t.Errorf("attempt after lockout: %v", err)
+	}
+}
+
+func TestInMemoryStoreBounded(t *testing.T) {
+	var store = NewInMemoryStore(Settings{Duration: 60, MaxKeys: 3}).(*inMemoryStore)
+	var now = time.Now()
+	var fail = func(counter Counter) Counter {
+		return Counter{Failures: counter.Failures + 1, LastFailure: now}
+	}
+
+	for _, key := range []string{"user:a", "user:b", "user:c", "user:d", "user:e"} {
+		if err := store.Update(key, now, fail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(store.counters) != 3 || store.order.Len() != 3 {
+		t.Errorf("%d counters kept, want 3", len(store.counters))
+	}
+	if _, found := store.counters["user:a"]; found {
+		t.Error("least recently updated counter kept")
+	}
+
+	// counters whose failures have been forgotten are dropped before the limit is reached
+	store = NewInMemoryStore(Settings{Duration: 60, MaxKeys: 3}).(*inMemoryStore)
+	if err := store.Update("user:old", now, func(counter Counter) Counter {
+		return Counter{Failures: 1, LastFailure: now.Add(-time.Hour)}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update("user:new", now, fail); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.counters["user:old"]; found {
+		t.Error("expired counter kept")
+	}
+}
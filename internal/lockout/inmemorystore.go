@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	counter Counter
+}
+
+// inMemoryStore keeps the counters of recently failed attempts, keys are chosen by the clients so the number of
+// counters is bounded
+type inMemoryStore struct {
+	mu       sync.Mutex
+	settings Settings
+	counters map[string]*list.Element
+	// order holds the counters, the most recently updated first
+	order *list.List
+}
+
+func NewInMemoryStore(settings Settings) Store {
+	return &inMemoryStore{settings: settings.withDefaults(), counters: map[string]*list.Element{}, order: list.New()}
+}
+
+// purge removes the least recently updated counters whose failures have been forgotten and makes room for a new
+// counter, the caller holds the lock
+func (s *inMemoryStore) purge(now time.Time) {
+	var duration = time.Duration(s.settings.Duration) * time.Second
+	for oldest := s.order.Back(); oldest != nil; oldest = s.order.Back() {
+		var e = oldest.Value.(*entry)
+		if s.order.Len() < s.settings.MaxKeys && !e.counter.LastFailure.Add(duration).Before(now) {
+			return
+		}
+		s.order.Remove(oldest)
+		delete(s.counters, e.key)
+	}
+}
+
+func (s *inMemoryStore) Update(key string, now time.Time, update func(counter Counter) Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, found := s.counters[key]; found {
+		s.order.MoveToFront(element)
+		var e = element.Value.(*entry)
+		e.counter = update(e.counter)
+	} else {
+		s.purge(now)
+		s.counters[key] = s.order.PushFront(&entry{key: key, counter: update(Counter{})})
+	}
+	return nil
+}
+
+func (s *inMemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, found := s.counters[key]; found {
+		s.order.Remove(element)
+		delete(s.counters, key)
+	}
+	return nil
+}
+
+func (s *inMemoryStore) Ping() error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package lockout
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/blockloop/scan/v2"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"log"
+	"time"
+)
+
+type sqlStore struct {
+	dbconn   *sql.DB
+	settings *StoreSettings
+}
+
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:   dbconn,
+			settings: settings,
+		}, nil
+	}
+}
+
+func (s *sqlStore) Update(key string, now time.Time, update func(counter Counter) Counter) error {
+	var tx, err = s.dbconn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the row has to exist before it can be locked
+	log.Printf("SQL: %s; -- %s, %v", s.settings.Insert, key, now)
+	// INSERT INTO login_failures (id, failures, last_failure) VALUES ($1, 0, $2) ON CONFLICT (id) DO NOTHING
+	if _, err := tx.Exec(s.settings.Insert, key, now); err != nil {
+		log.Printf("!!! Insert of login failures failed: %v", err)
+		return err
+	}
+
+	var counter Counter
+	log.Printf("SQL: %s; -- %s", s.settings.Query, key)
+	// SELECT failures, last_failure FROM login_failures WHERE id = $1 FOR UPDATE
+	if rows, err := tx.Query(s.settings.Query, key); err == nil {
+		if err := scan.RowStrict(&counter, rows); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	} else {
+		log.Printf("!!! Query for login failures failed: %v", err)
+		return err
+	}
+
+	counter = update(counter)
+	log.Printf("SQL: %s; -- %s, %d, %v", s.settings.Update, key, counter.Failures, counter.LastFailure)
+	// UPDATE login_failures SET failures = $2, last_failure = $3 WHERE id = $1
+	if _, err := tx.Exec(s.settings.Update, key, counter.Failures, counter.LastFailure); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Reset(key string) error {
+	log.Printf("SQL: %s; -- %s", s.settings.Delete, key)
+	// DELETE FROM login_failures WHERE id = $1
+	_, err := s.dbconn.Exec(s.settings.Delete, key)
+	return err
+}
+
+func (s *sqlStore) Ping() error {
+	return s.dbconn.Ping()
+}
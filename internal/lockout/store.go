@@ -0,0 +1,19 @@
+package lockout
+
+import (
+	"time"
+)
+
+// Counter holds the failed login attempts for a user or a source address
+type Counter struct {
+	Failures    int       `db:"failures"`
+	LastFailure time.Time `db:"last_failure"`
+}
+
+type Store interface {
+	// Update replaces the counter of the key by the result of update, concurrent updates of the same key are
+	// serialized so no attempt is lost
+	Update(key string, now time.Time, update func(counter Counter) Counter) error
+	Reset(key string) error
+	Ping() error
+}
@@ -0,0 +1,9 @@
+package lockout
+
+type StoreSettings struct {
+	URI    string `json:"uri,omitempty"`
+	Query  string `json:"query,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Update string `json:"update,omitempty"`
+	Delete string `json:"delete,omitempty"`
+}
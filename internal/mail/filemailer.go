@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileMailer writes every message to a file in the outbox directory, for development only
+type fileMailer struct {
+	outbox string
+	from   string
+}
+
+func newFileMailer(outbox, from string) (Mailer, error) {
+	if err := os.MkdirAll(outbox, 0700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{outbox: outbox, from: from}, nil
+}
+
+func (f *fileMailer) Send(to, subject, body string) error {
+	var filename = filepath.Join(f.outbox, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	log.Printf("Writing mail to %s into %s", to, filename)
+	return os.WriteFile(filename, message(f.from, to, subject, body), 0600)
+}
+
+// logMailer prints messages to the log, for development only
+type logMailer struct {
+	from string
+}
+
+func (l *logMailer) Send(to, subject, body string) error {
+	log.Printf("Mail to %s:\n%s", to, message(l.from, to, subject, body))
+	return nil
+}
@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func newSMTPMailer(uri *url.URL, from string) Mailer {
+	var addr = uri.Host
+	if uri.Port() == "" {
+		addr = net.JoinHostPort(uri.Hostname(), "25")
+	}
+	var auth smtp.Auth
+	if uri.User != nil {
+		var password, _ = uri.User.Password()
+		auth = smtp.PlainAuth("", uri.User.Username(), password, uri.Hostname())
+	}
+	return &smtpMailer{addr: addr, auth: auth, from: from}
+}
+
+// Send uses STARTTLS when the server offers it
+func (s *smtpMailer) Send(to, subject, body string) error {
+	// the envelope takes the bare address of a sender like "Auth Server <auth@example.org>"
+	var sender = s.from
+	if address, err := mail.ParseAddress(s.from); err == nil {
+		sender = address.Address
+	}
+	return smtp.SendMail(s.addr, s.auth, sender, []string{to}, message(s.from, to, subject, body))
+}
@@ -0,0 +1,152 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one session per connection and records the commands and the message
+type fakeSMTPServer struct {
+	listener net.Listener
+	// rejectRcpt answers RCPT TO with a permanent failure
+	rejectRcpt bool
+	sessions   chan fakeSMTPSession
+}
+
+type fakeSMTPSession struct {
+	commands []string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T, rejectRcpt bool) *fakeSMTPServer {
+	var listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server = &fakeSMTPServer{listener: listener, rejectRcpt: rejectRcpt, sessions: make(chan fakeSMTPSession, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (f *fakeSMTPServer) serve() {
+	for {
+		var conn, err = f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.sessions <- f.handle(conn)
+	}
+}
+
+func (f *fakeSMTPServer) handle(conn net.Conn) fakeSMTPSession {
+	defer conn.Close()
+	var session fakeSMTPSession
+	var reader = bufio.NewReader(conn)
+	var reply = func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP fake")
+	for {
+		var line, err = reader.ReadString('\n')
+		if err != nil {
+			return session
+		}
+		line = strings.TrimRight(line, "\r\n")
+		session.commands = append(session.commands, line)
+		var verb = strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case verb == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case verb == "AUTH":
+			reply("235 2.7.0 Authentication successful")
+		case verb == "RCPT" && f.rejectRcpt:
+			reply("550 5.1.1 No such user")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				var dataLine, err = reader.ReadString('\n')
+				if err != nil {
+					return session
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			session.data = data.String()
+			reply("250 2.0.0 Ok: queued")
+		case verb == "QUIT":
+			reply("221 2.0.0 Bye")
+			return session
+		default:
+			reply("250 2.0.0 Ok")
+		}
+	}
+}
+
+func (f *fakeSMTPServer) mailer(t *testing.T, userinfo string) Mailer {
+	var mailer, err = NewMailer(Settings{URI: "smtp://" + userinfo + f.listener.Addr().String(), From: "Auth Server <auth@example.org>"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailer
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	var server = newFakeSMTPServer(t, false)
+
+	if err := server.mailer(t, "").Send("alice@example.com", "Log in to Äuth", "line 1\nline 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	var session = <-server.sessions
+
+	for _, command := range []string{"MAIL FROM:<auth@example.org>", "RCPT TO:<alice@example.com>"} {
+		if !strings.Contains(strings.Join(session.commands, "\n"), command) {
+			t.Errorf("missing %q in %q", command, session.commands)
+		}
+	}
+	for _, header := range []string{"From: Auth Server <auth@example.org>\r\n", "To: alice@example.com\r\n", "Subject: =?UTF-8?q?Log_in_to_=C3=84uth?=\r\n"} {
+		if !strings.Contains(session.data, header) {
+			t.Errorf("missing header %q in %q", header, session.data)
+		}
+	}
+	if !strings.HasSuffix(session.data, "\r\n\r\nline 1\r\nline 2\r\n") {
+		t.Errorf("body not in CRLF lines: %q", session.data)
+	}
+}
+
+func TestSMTPMailerAuth(t *testing.T) {
+	var server = newFakeSMTPServer(t, false)
+
+	if err := server.mailer(t, "mailer:s3cret@").Send("alice@example.com", "Subject", "body"); err != nil {
+		t.Fatal(err)
+	}
+	var session = <-server.sessions
+
+	var want = "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00s3cret"))
+	if !strings.Contains(strings.Join(session.commands, "\n"), want) {
+		t.Errorf("missing %q in %q", want, session.commands)
+	}
+}
+
+func TestSMTPMailerRejected(t *testing.T) {
+	var server = newFakeSMTPServer(t, true)
+
+	if err := server.mailer(t, "").Send("nobody@example.com", "Subject", "body"); err == nil {
+		t.Error("rejected recipient not reported")
+	}
+}
+
+func TestSMTPMailerDefaultPort(t *testing.T) {
+	var uri, _ = url.Parse("smtp://mail.example.org")
+	if addr := newSMTPMailer(uri, "auth@example.org").(*smtpMailer).addr; addr != "mail.example.org:25" {
+		t.Errorf("addr = %q", addr)
+	}
+}
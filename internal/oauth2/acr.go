@@ -0,0 +1,120 @@
+package oauth2
+
+import (
+	"github.com/cwkr/authd/internal/people"
+	"slices"
+	"strings"
+)
+
+// ACRLevel maps an authentication context class reference (acr) to the authentication methods satisfying it
+type ACRLevel struct {
+	ACR string `json:"acr"`
+	// AuthMethods lists alternative sets of methods, one of them has to be contained in the session
+	AuthMethods [][]string `json:"amr,omitempty"`
+	MultiFactor bool       `json:"mfa,omitempty"`
+}
+
+// Satisfied reports whether a session authenticated with the given methods reaches the level
+func (l ACRLevel) Satisfied(methods []string) bool {
+	if len(methods) == 0 {
+		return false
+	}
+	if l.MultiFactor && !(people.Session{Methods: methods}).MultiFactor() {
+		return false
+	}
+	if len(l.AuthMethods) == 0 {
+		return true
+	}
+	for _, required := range l.AuthMethods {
+		if !slices.ContainsFunc(required, func(method string) bool { return !slices.Contains(methods, method) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Requires reports whether every alternative of the level contains one of the given methods
+func (l ACRLevel) Requires(methods ...string) bool {
+	if len(l.AuthMethods) == 0 {
+		return false
+	}
+	for _, required := range l.AuthMethods {
+		if !slices.ContainsFunc(required, func(method string) bool { return slices.Contains(methods, method) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// ACRLevels are ordered from the lowest to the highest level
+type ACRLevels []ACRLevel
+
+// DefaultACRLevels are used when no levels are configured, phr and phrh are the phishing-resistant levels of the
+// OpenID Extended Authentication Profile
+var DefaultACRLevels = ACRLevels{
+	{ACR: "1"},
+	{ACR: "2", MultiFactor: true},
+	{ACR: "phr", AuthMethods: [][]string{{people.MethodHardwareKey}, {people.MethodSoftwareKey}}},
+	{ACR: "phrh", AuthMethods: [][]string{{people.MethodHardwareKey}}},
+}
+
+// Lookup returns the level with the given acr
+func (a ACRLevels) Lookup(acr string) (ACRLevel, bool) {
+	for _, level := range a {
+		if level.ACR == acr {
+			return level, true
+		}
+	}
+	return ACRLevel{}, false
+}
+
+// Level returns the acr of the highest level reached by the given methods or an empty string
+func (a ACRLevels) Level(methods []string) string {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i].Satisfied(methods) {
+			return a[i].ACR
+		}
+	}
+	return ""
+}
+
+// Unmet returns the lowest of the requested levels when none of them is reached by the given methods, unknown acr
+// values are ignored
+func (a ACRLevels) Unmet(acrValues string, methods []string) (ACRLevel, bool) {
+	var (
+		lowest ACRLevel
+		found  bool
+	)
+	for _, level := range a {
+		if !slices.Contains(strings.Fields(acrValues), level.ACR) {
+			continue
+		}
+		if level.Satisfied(methods) {
+			return ACRLevel{}, false
+		}
+		if !found {
+			lowest, found = level, true
+		}
+	}
+	return lowest, found
+}
+
+// Values returns all acr values in order
+func (a ACRLevels) Values() []string {
+	var values = make([]string, 0, len(a))
+	for _, level := range a {
+		values = append(values, level.ACR)
+	}
+	return values
+}
+
+// addAuthenticationClaims adds the amr claim and the acr reached by the methods
+func addAuthenticationClaims(claims map[string]any, acrLevels ACRLevels, authMethods []string) {
+	if len(authMethods) == 0 {
+		return
+	}
+	claims[ClaimAuthMethods] = authMethods
+	if acr := acrLevels.Level(authMethods); acr != "" {
+		claims[ClaimAuthContext] = acr
+	}
+}
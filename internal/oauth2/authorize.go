@@ -5,6 +5,7 @@ import (
 	"github.com/cwkr/authd/internal/htmlutil"
 	"github.com/cwkr/authd/internal/httputil"
 	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/trl"
 	"github.com/cwkr/authd/internal/people"
 	"github.com/cwkr/authd/internal/stringutil"
 	"log"
@@ -27,11 +28,26 @@ func IntersectScope(availableScope, requestedScope string) string {
 	return strings.Join(results, " ")
 }
 
+// ClientScope determines the scope granted to a client. The client's default scopes are used when no scope was
+// requested and the result is limited to the client's allowed scopes.
+func ClientScope(client clients.Client, availableScope, requestedScope string) string {
+	if strings.TrimSpace(requestedScope) == "" && len(client.DefaultScopes) > 0 {
+		requestedScope = strings.Join(client.DefaultScopes, " ")
+	}
+	var scope = IntersectScope(availableScope, requestedScope)
+	if len(client.AllowedScopes) > 0 {
+		scope = IntersectScope(scope, strings.Join(client.AllowedScopes, " "))
+	}
+	return scope
+}
+
 type authorizeHandler struct {
 	basePath     string
 	tokenService TokenCreator
 	peopleStore  people.Store
 	clientStore  clients.Store
+	trlStore     trl.Store
+	mfaPolicy    MFAPolicy
 	scope        string
 	sessionName  string
 }
@@ -49,6 +65,8 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		challenge       = strings.TrimSpace(r.FormValue("code_challenge"))
 		challengeMethod = strings.TrimSpace(r.FormValue("code_challenge_method"))
 		nonce           = strings.TrimSpace(r.FormValue("nonce"))
+		rawClaims       = strings.TrimSpace(r.FormValue("claims"))
+		acrValues       = strings.TrimSpace(r.FormValue("acr_values"))
 		sessionName     = a.sessionName
 		user            User
 	)
@@ -63,12 +81,25 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Error(w, ErrorUnauthorizedClient, ErrorInvalidClient, http.StatusForbidden)
 		return
 	} else {
-		if responseType == ResponseTypeToken && client.DisableImplicit {
-			htmlutil.Error(w, a.basePath, ErrorUnsupportedGrantType, http.StatusBadRequest)
-			return
-		}
 		client = *c
 	}
+	if err := a.tokenService.ValidateClient(client); err != nil {
+		log.Printf("!!! client %s: %s", clientID, err)
+		htmlutil.Error(w, a.basePath, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if responseType == ResponseTypeToken && (client.DisableImplicit || !client.AllowsGrantType(GrantTypeImplicit)) {
+		htmlutil.Error(w, a.basePath, ErrorUnsupportedGrantType, http.StatusBadRequest)
+		return
+	}
+	if responseType == ResponseTypeCode && !client.AllowsGrantType(GrantTypeAuthorizationCode) {
+		htmlutil.Error(w, a.basePath, ErrorUnsupportedGrantType, http.StatusBadRequest)
+		return
+	}
+	if !client.AllowsResponseType(responseType) {
+		htmlutil.Error(w, a.basePath, ErrorUnsupportedResponseType, http.StatusBadRequest)
+		return
+	}
 	if client.SessionName != "" {
 		sessionName = client.SessionName
 	}
@@ -78,19 +109,44 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if uid, active := a.peopleStore.IsSessionActive(r, sessionName); active {
+	var claimsRequest, err = ParseClaimsRequest(rawClaims)
+	if err != nil {
+		htmlutil.Error(w, a.basePath, "invalid claims parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var session, active = a.peopleStore.IsSessionActive(r, sessionName)
+	if active {
+		// sessions started before the tokens of the user were revoked, e.g. by a password reset, have ended
+		if revoked, err := IsSessionRevoked(a.trlStore, session.UserID, session.AuthTime); err != nil {
+			htmlutil.Error(w, a.basePath, err.Error(), http.StatusInternalServerError)
+			return
+		} else if revoked {
+			log.Printf("session of user_id=%s has been revoked", session.UserID)
+			active = false
+		}
+	}
+	if active {
 		timing.Start("store")
-		if person, err := a.peopleStore.Lookup(uid); err == nil {
-			user = User{UserID: uid, Person: *person}
+		if person, err := a.peopleStore.Lookup(session.UserID); err == nil {
+			user = User{UserID: session.UserID, Person: *person}
 		} else {
 			htmlutil.Error(w, a.basePath, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		timing.Stop("store")
-	} else {
+	}
+	// single factor sessions do not satisfy clients or roles requiring multi-factor authentication
+	if !active || (!session.MultiFactor() && a.mfaPolicy.Required(client, user)) {
 		httputil.RedirectQuery(w, r, strings.TrimRight(a.tokenService.Issuer(), "/")+"/login", r.URL.Query())
 		return
 	}
+	// the session has to reach one of the requested levels, otherwise the user steps up with another factor
+	if level, unmet := a.mfaPolicy.ACRLevels.Unmet(acrValues, session.Methods); unmet {
+		log.Printf("user_id=%s amr=%v does not reach acr=%s", session.UserID, session.Methods, level.ACR)
+		httputil.RedirectQuery(w, r, strings.TrimRight(a.tokenService.Issuer(), "/")+"/login/stepup", r.URL.Query())
+		return
+	}
 
 	var redirectParams = url.Values{}
 	redirectParams.Set("state", state)
@@ -98,7 +154,7 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch responseType {
 	case ResponseTypeToken:
 		timing.Start("jwtgen")
-		var accessToken, err = a.tokenService.GenerateAccessToken(user, user.UserID, clientID, IntersectScope(a.scope, scope))
+		var accessToken, err = a.tokenService.GenerateAccessToken(user, user.UserID, client, ClientScope(client, a.scope, scope), claimsRequest, session.Methods)
 		if err != nil {
 			htmlutil.Error(w, a.basePath, err.Error(), http.StatusInternalServerError)
 			return
@@ -106,7 +162,7 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		timing.Stop("jwtgen")
 		redirectParams.Set("access_token", accessToken)
 		redirectParams.Set("token_type", "Bearer")
-		redirectParams.Set("expires_in", fmt.Sprint(a.tokenService.AccessTokenTTL()))
+		redirectParams.Set("expires_in", fmt.Sprint(a.tokenService.AccessTokenTTL(client)))
 
 		httputil.NoCache(w)
 		timing.Report(w)
@@ -120,7 +176,7 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		timing.Start("jwtgen")
-		var authCode, err = a.tokenService.GenerateAuthCode(user.UserID, clientID, IntersectScope(a.scope, scope), challenge, nonce)
+		var authCode, err = a.tokenService.GenerateAuthCode(user.UserID, client, ClientScope(client, a.scope, scope), challenge, nonce, session.AuthTime, claimsRequest, session.Methods)
 		if err != nil {
 			htmlutil.Error(w, a.basePath, err.Error(), http.StatusInternalServerError)
 			return
@@ -136,12 +192,14 @@ func (a *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AuthorizeHandler(basePath string, tokenService TokenCreator, peopleStore people.Store, clientStore clients.Store, scope, sessionName string) http.Handler {
+func AuthorizeHandler(basePath string, tokenService TokenCreator, peopleStore people.Store, clientStore clients.Store, trlStore trl.Store, mfaPolicy MFAPolicy, scope, sessionName string) http.Handler {
 	return &authorizeHandler{
 		basePath:     basePath,
 		tokenService: tokenService,
 		peopleStore:  peopleStore,
 		clientStore:  clientStore,
+		trlStore:     trlStore,
+		mfaPolicy:    mfaPolicy,
 		scope:        scope,
 		sessionName:  sessionName,
 	}
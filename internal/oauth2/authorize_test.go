@@ -0,0 +1,151 @@
+package oauth2
+
+import (
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/pkce"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/people"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authorize sends the authorization request with a session of the user started at authTime, no session is started
+// for an empty user id
+func (o *oauth2Test) authorize(userID string, authTime time.Time, params url.Values) *httptest.ResponseRecorder {
+	var peopleStore = newTestPeopleStore()
+	var handler = AuthorizeHandler("", o.tokenCreator, peopleStore, o.clientStore, o.trlStore, MFAPolicy{}, "openid profile email offline_access", "authd")
+	var r = httptest.NewRequest(http.MethodGet, testIssuer+"/authorize?"+params.Encode(), nil)
+	if userID != "" {
+		var w = httptest.NewRecorder()
+		if err := peopleStore.SaveSession(r, w, people.Session{UserID: userID, AuthTime: authTime, Methods: []string{people.MethodPassword}}, "authd"); err != nil {
+			o.t.Fatal(err)
+		}
+		for _, cookie := range w.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+	}
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func redirectParams(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	if w.Code != http.StatusFound && w.Code != http.StatusSeeOther {
+		t.Fatalf("authorize: %d %s", w.Code, w.Body.String())
+	}
+	var location, err = url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Fragment != "" {
+		params, _ := url.ParseQuery(location.Fragment)
+		return params
+	}
+	return location.Query()
+}
+
+func TestAuthorizeCodeWithPKCE(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	var w = o.authorize("alice", time.Now(), url.Values{
+		"response_type":         {ResponseTypeCode},
+		"client_id":             {"app"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"scope":                 {"openid offline_access"},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkce.CodeChallange(verifier)},
+		"code_challenge_method": {"S256"},
+	})
+	var params = redirectParams(t, w)
+	if !strings.HasPrefix(w.Header().Get("Location"), "https://app.example.com/callback?") || params.Get("state") != "xyz" {
+		t.Fatalf("redirect to %s", w.Header().Get("Location"))
+	}
+
+	var form = url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {params.Get("code")}}
+	if status, response := o.token("app", form); status != http.StatusBadRequest || response["error"] != ErrorInvalidRequest {
+		t.Errorf("token without code_verifier: %d %v", status, response)
+	}
+	form.Set("code_verifier", "wrong")
+	if status, response := o.token("app", form); status != http.StatusBadRequest || response["error"] != ErrorInvalidGrant {
+		t.Errorf("token with wrong code_verifier: %d %v", status, response)
+	}
+	form.Set("code_verifier", verifier)
+	var status, response = o.token("app", form)
+	if status != http.StatusOK || response["access_token"] == nil || response["id_token"] == nil || response["refresh_token"] == nil {
+		t.Errorf("token: %d %v", status, response)
+	}
+}
+
+func TestAuthorizeImplicit(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var params = redirectParams(t, o.authorize("alice", time.Now(), url.Values{
+		"response_type": {ResponseTypeToken},
+		"client_id":     {"app"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+	}))
+	if claims, err := o.tokenCreator.Verify(params.Get("access_token"), ""); err != nil || claims.Subject != "alice" || params.Get("token_type") != "Bearer" {
+		t.Errorf("implicit grant = %v: %+v, %v", params, claims, err)
+	}
+}
+
+func TestAuthorizeRequiresSession(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var params = url.Values{
+		"response_type": {ResponseTypeCode},
+		"client_id":     {"app"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	}
+
+	var w = o.authorize("", time.Time{}, params)
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, testIssuer+"/login?") {
+		t.Errorf("without session: %d %s", w.Code, location)
+	}
+
+	// sessions started before the tokens of the user were revoked have ended
+	var authTime = time.Now().Add(-time.Minute)
+	if err := o.trlStore.PutCutoff(cutoffID("alice"), trl.AnyID, authTime.Add(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	w = o.authorize("alice", authTime, params)
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, testIssuer+"/login?") {
+		t.Errorf("revoked session: %d %s", w.Code, location)
+	}
+	if params := redirectParams(t, o.authorize("alice", time.Now(), params)); params.Get("code") == "" {
+		t.Errorf("new session: %v", params)
+	}
+}
+
+func TestAuthorizeRejectsClients(t *testing.T) {
+	var o = newOAuth2Test(t)
+	if w := o.authorize("alice", time.Now(), url.Values{
+		"response_type": {ResponseTypeCode},
+		"client_id":     {"unknown"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	}); w.Code != http.StatusForbidden {
+		t.Errorf("unknown client: %d", w.Code)
+	}
+
+	o.clientStore = clients.NewInMemoryClientStore(map[string]clients.Client{
+		"app": {RedirectURIPattern: `^https://app\.example\.com/`, ResponseTypes: []string{ResponseTypeCode}},
+	})
+	for _, tt := range []struct {
+		responseType, redirectURI string
+	}{
+		{ResponseTypeCode, "https://evil.example.com/callback"},
+		{ResponseTypeToken, "https://app.example.com/callback"},
+	} {
+		var w = o.authorize("alice", time.Now(), url.Values{
+			"response_type": {tt.responseType},
+			"client_id":     {"app"},
+			"redirect_uri":  {tt.redirectURI},
+		})
+		if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+			t.Errorf("%s to %s: %d %s", tt.responseType, tt.redirectURI, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
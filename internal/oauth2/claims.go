@@ -1,6 +1,8 @@
 package oauth2
 
 import (
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"maps"
 	"os"
 	"strings"
 )
@@ -19,54 +21,123 @@ const (
 	ClaimAccessTokenHash = "at_hash"
 	ClaimNonce           = "nonce"
 	ClaimTokenID         = "jti"
+	ClaimFamilyID        = "fid"
+	ClaimAuthTime        = "auth_time"
+	ClaimAuthMethods     = "amr"
+	ClaimAuthContext     = "acr"
+	ClaimClaims          = "claims"
 )
 
-func AddExtraClaims(claims map[string]any, extraClaims map[string]string, user User, clientID string, roleMappings RoleMappings) {
+// MergeExtraClaims returns the global claim templates overridden or extended by the client specific templates. An
+// empty client template removes the global claim.
+func MergeExtraClaims(extraClaims, clientExtraClaims map[string]string) map[string]string {
+	if len(clientExtraClaims) == 0 {
+		return extraClaims
+	}
+	var merged = maps.Clone(extraClaims)
+	if merged == nil {
+		merged = make(map[string]string, len(clientExtraClaims))
+	}
+	maps.Copy(merged, clientExtraClaims)
+	return merged
+}
+
+// ReleasedUser returns a copy of the user with all attributes withheld that the client's attribute release policy
+// does not allow
+func ReleasedUser(user User, client clients.Client) User {
+	var released = user
+	if !client.ReleasesAttribute("birthdate") {
+		released.Birthdate = ""
+	}
+	if !client.ReleasesAttribute("department") {
+		released.Department = ""
+	}
+	if !client.ReleasesAttribute("email") {
+		released.Email = ""
+	}
+	if !client.ReleasesAttribute("family_name") {
+		released.FamilyName = ""
+	}
+	if !client.ReleasesAttribute("given_name") {
+		released.GivenName = ""
+	}
+	if !client.ReleasesAttribute("groups") {
+		released.Groups = nil
+	}
+	if !client.ReleasesAttribute("phone_number") {
+		released.PhoneNumber = ""
+	}
+	if !client.ReleasesAttribute("street_address") {
+		released.StreetAddress = ""
+	}
+	if !client.ReleasesAttribute("locality") {
+		released.Locality = ""
+	}
+	if !client.ReleasesAttribute("postal_code") {
+		released.PostalCode = ""
+	}
+	return released
+}
+
+// AddExtraClaims expands the claim templates for the given user. Attributes the client's release policy does not
+// allow expand to nothing, roles are mapped from the complete user but only released when the policy allows "roles".
+func AddExtraClaims(claims map[string]any, extraClaims map[string]string, user User, client clients.Client, roleMappings RoleMappings) {
+	var releasedUser = ReleasedUser(user, client)
+	var roles = func() []string {
+		if client.ReleasesAttribute("roles") {
+			return roleMappings.Roles(user)
+		}
+		return nil
+	}
 	for key, tmpl := range extraClaims {
 		if strings.EqualFold(strings.TrimSpace(tmpl), "$groups") {
-			if len(user.Groups) > 0 {
-				claims[key] = user.Groups
+			if len(releasedUser.Groups) > 0 {
+				claims[key] = releasedUser.Groups
 			}
 		} else if strings.EqualFold(strings.TrimSpace(tmpl), "$roles") {
-			if roles := roleMappings.Roles(user); len(roles) > 0 {
+			if roles := roles(); len(roles) > 0 {
 				claims[key] = roles
 			}
 		} else if value := strings.TrimSpace(os.Expand(tmpl, func(name string) string {
 			switch strings.ToLower(name) {
 			case "birthdate":
-				return user.Birthdate
+				return releasedUser.Birthdate
 			case "client_id":
-				return clientID
+				return client.ClientID
 			case "department":
-				return user.Department
+				return releasedUser.Department
 			case "email":
-				return user.Email
+				return releasedUser.Email
 			case "family_name":
-				return user.FamilyName
+				return releasedUser.FamilyName
 			case "given_name":
-				return user.GivenName
+				return releasedUser.GivenName
 			case "locality":
-				return user.Locality
+				return releasedUser.Locality
 			case "phone_number":
-				return user.PhoneNumber
+				return releasedUser.PhoneNumber
 			case "postal_code":
-				return user.PostalCode
+				return releasedUser.PostalCode
 			case "groups_space_delimited":
-				return strings.Join(user.Groups, " ")
+				return strings.Join(releasedUser.Groups, " ")
 			case "groups_comma_delimited":
-				return strings.Join(user.Groups, ",")
+				return strings.Join(releasedUser.Groups, ",")
 			case "groups_semicolon_delimited":
-				return strings.Join(user.Groups, ";")
+				return strings.Join(releasedUser.Groups, ";")
 			case "roles_space_delimited":
-				return strings.Join(roleMappings.Roles(user), " ")
+				return strings.Join(roles(), " ")
 			case "roles_comma_delimited":
-				return strings.Join(roleMappings.Roles(user), ",")
+				return strings.Join(roles(), ",")
 			case "roles_semicolon_delimited":
-				return strings.Join(roleMappings.Roles(user), ";")
+				return strings.Join(roles(), ";")
 			case "street_address":
-				return user.StreetAddress
+				return releasedUser.StreetAddress
 			case "user_id":
-				return user.UserID
+				// the user id would let clients with pairwise subjects correlate users
+				if strings.EqualFold(client.SubjectType, SubjectTypePairwise) {
+					return ""
+				}
+				return releasedUser.UserID
 			}
 			return ""
 		})); value != "" {
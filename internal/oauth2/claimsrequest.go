@@ -0,0 +1,62 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// ClaimRequest is an individual claim request as defined by OpenID Connect Core 1.0 section 5.5.1
+type ClaimRequest struct {
+	Essential bool  `json:"essential,omitempty"`
+	Value     any   `json:"value,omitempty"`
+	Values    []any `json:"values,omitempty"`
+}
+
+// ClaimsRequest is the value of the claims request parameter as defined by OpenID Connect Core 1.0 section 5.5
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+func ParseClaimsRequest(rawClaimsRequest string) (*ClaimsRequest, error) {
+	if strings.TrimSpace(rawClaimsRequest) == "" {
+		return nil, nil
+	}
+	var claimsRequest ClaimsRequest
+	if err := json.Unmarshal([]byte(rawClaimsRequest), &claimsRequest); err != nil {
+		return nil, err
+	}
+	if len(claimsRequest.UserInfo) == 0 && len(claimsRequest.IDToken) == 0 {
+		return nil, nil
+	}
+	return &claimsRequest, nil
+}
+
+// UserInfoOnly returns a claims request that contains only the claims requested for the userinfo endpoint
+func (c *ClaimsRequest) UserInfoOnly() *ClaimsRequest {
+	if c == nil || len(c.UserInfo) == 0 {
+		return nil
+	}
+	return &ClaimsRequest{UserInfo: c.UserInfo}
+}
+
+// AddRequestedClaims adds individually requested standard claims regardless of the granted scope. Essential claims
+// that are not available for the user are logged.
+func AddRequestedClaims(claims map[string]any, requestedClaims map[string]*ClaimRequest, user User) {
+	if len(requestedClaims) == 0 {
+		return
+	}
+	var available = map[string]any{}
+	AddProfileClaims(available, user)
+	AddEmailClaims(available, user)
+	AddPhoneClaims(available, user)
+	AddAddressClaims(available, user)
+	for name, request := range requestedClaims {
+		if value, found := available[name]; found {
+			claims[name] = value
+		} else if _, present := claims[name]; !present && request != nil && request.Essential {
+			log.Printf("!!! essential claim %s not available for user %s", name, user.UserID)
+		}
+	}
+}
@@ -1,9 +1,71 @@
 package clients
 
+import "slices"
+
 type Client struct {
-	RedirectURIPattern         string `json:"redirect_uri_pattern,omitempty"`
-	SecretHash                 string `json:"secret_hash,omitempty"`
-	SessionName                string `json:"session_name,omitempty"`
-	DisableImplicit            bool   `json:"disable_implicit,omitempty"`
-	EnableRefreshTokenRotation bool   `json:"enable_refresh_token_rotation,omitempty"`
+	ClientID                     string            `json:"-"`
+	RedirectURIPattern           string            `json:"redirect_uri_pattern,omitempty"`
+	SecretHash                   string            `json:"secret_hash,omitempty"`
+	SessionName                  string            `json:"session_name,omitempty"`
+	DisableImplicit              bool              `json:"disable_implicit,omitempty"`
+	EnableRefreshTokenRotation   bool              `json:"enable_refresh_token_rotation,omitempty"`
+	RefreshTokenTTL              int               `json:"refresh_token_ttl,omitempty"`
+	RefreshTokenMaxTTL           int               `json:"refresh_token_max_ttl,omitempty"`
+	OfflineSessionTTL            int               `json:"offline_session_ttl,omitempty"`
+	GrantTypes                   []string          `json:"grant_types,omitempty"`
+	ResponseTypes                []string          `json:"response_types,omitempty"`
+	AllowedScopes                []string          `json:"allowed_scopes,omitempty"`
+	DefaultScopes                []string          `json:"default_scopes,omitempty"`
+	AccessTokenTTL               int               `json:"access_token_ttl,omitempty"`
+	IDTokenTTL                   int               `json:"id_token_ttl,omitempty"`
+	CodeTTL                      int               `json:"code_ttl,omitempty"`
+	AccessTokenExtraClaims       map[string]string `json:"access_token_extra_claims,omitempty"`
+	IDTokenExtraClaims           map[string]string `json:"id_token_extra_claims,omitempty"`
+	ReleasedAttributes           []string          `json:"released_attributes,omitempty"`
+	JwksURI                      string            `json:"jwks_uri,omitempty"`
+	IDTokenEncryptedResponseAlg  string            `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedResponseEnc  string            `json:"id_token_encrypted_response_enc,omitempty"`
+	UserinfoSignedResponseAlg    string            `json:"userinfo_signed_response_alg,omitempty"`
+	UserinfoEncryptedResponseAlg string            `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserinfoEncryptedResponseEnc string            `json:"userinfo_encrypted_response_enc,omitempty"`
+	SubjectType                  string            `json:"subject_type,omitempty"`
+	SectorIdentifier             string            `json:"sector_identifier,omitempty"`
+	AccessTokenFormat            string            `json:"access_token_format,omitempty"`
+	RequireMFA                   bool              `json:"require_mfa,omitempty"`
+}
+
+// attributeGroups maps person attributes to the scope-like group they can be released by
+var attributeGroups = map[string]string{
+	"birthdate":      "profile",
+	"family_name":    "profile",
+	"given_name":     "profile",
+	"phone_number":   "phone",
+	"street_address": "address",
+	"locality":       "address",
+	"postal_code":    "address",
+}
+
+// AllowsGrantType reports whether the client may use the given grant type, all grant types are allowed when none
+// are configured
+func (c Client) AllowsGrantType(grantType string) bool {
+	return len(c.GrantTypes) == 0 || slices.Contains(c.GrantTypes, grantType)
+}
+
+// ReleasesAttribute reports whether the attribute release policy of the client allows the given person attribute to be
+// released either by name or by its group (profile, phone or address). All attributes are released when no policy is
+// configured.
+func (c Client) ReleasesAttribute(attribute string) bool {
+	if len(c.ReleasedAttributes) == 0 {
+		return true
+	}
+	if group, found := attributeGroups[attribute]; found && slices.Contains(c.ReleasedAttributes, group) {
+		return true
+	}
+	return slices.Contains(c.ReleasedAttributes, attribute)
+}
+
+// AllowsResponseType reports whether the client may use the given response type, all response types are allowed
+// when none are configured
+func (c Client) AllowsResponseType(responseType string) bool {
+	return len(c.ResponseTypes) == 0 || slices.Contains(c.ResponseTypes, responseType)
 }
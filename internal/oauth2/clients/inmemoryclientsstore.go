@@ -1,8 +1,9 @@
 package clients
 
 import (
+	"crypto/subtle"
 	"github.com/cwkr/authd/internal/maputil"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/cwkr/authd/internal/passwordhash"
 	"strings"
 )
 
@@ -19,12 +20,14 @@ func (i inMemoryClientStore) compareSecret(client *Client, clientSecret string)
 	if client.SecretHash == "" {
 		return nil, ErrClientNoSecret
 	}
-	// bcrypt hash or plaintext
-	if strings.HasPrefix(client.SecretHash, "$2") {
-		if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+	// password hash or plaintext
+	if passwordhash.IsHash(client.SecretHash) {
+		if match, err := passwordhash.Verify(client.SecretHash, clientSecret); err != nil {
 			return nil, err
+		} else if !match {
+			return nil, ErrClientSecretMismatch
 		}
-	} else if clientSecret != client.SecretHash {
+	} else if subtle.ConstantTimeCompare([]byte(clientSecret), []byte(client.SecretHash)) != 1 {
 		return nil, ErrClientSecretMismatch
 	}
 	return client, nil
@@ -40,6 +43,7 @@ func (i inMemoryClientStore) Authenticate(clientID, clientSecret string) (*Clien
 
 func (i inMemoryClientStore) Lookup(clientID string) (*Client, error) {
 	if client, clientExists := i[strings.ToLower(clientID)]; clientExists {
+		client.ClientID = clientID
 		return &client, nil
 	}
 	return nil, ErrClientNotFound
@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	var store = NewInMemoryClientStore(map[string]Client{
+		"plain": {SecretHash: "secret"},
+		// bcrypt hash of "secret"
+		"hashed":  {SecretHash: "$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe"},
+		"ldap":    {SecretHash: "{SSHA}1G904nLkTkGWjKNnQuB/hpWXC/hzYWx0c2FsdA=="},
+		"public":  {},
+		"invalid": {SecretHash: "$2a$04$invalid"},
+	})
+	for _, tt := range []struct {
+		clientID, secret string
+		err              error
+	}{
+		{"plain", "secret", nil},
+		{"PLAIN", "secret", nil},
+		{"plain", "Secret", ErrClientSecretMismatch},
+		{"plain", "secret ", ErrClientSecretMismatch},
+		{"hashed", "secret", nil},
+		{"hashed", "wrong", ErrClientSecretMismatch},
+		// the hash itself is not accepted as secret
+		{"hashed", "$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe", ErrClientSecretMismatch},
+		{"ldap", "secret", nil},
+		{"ldap", "wrong", ErrClientSecretMismatch},
+		{"public", "secret", ErrClientNoSecret},
+		{"plain", "", ErrClientSecretRequired},
+		{"unknown", "secret", ErrClientNotFound},
+	} {
+		var client, err = store.Authenticate(tt.clientID, tt.secret)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Authenticate(%s, %q) = %v, want %v", tt.clientID, tt.secret, err, tt.err)
+		} else if err == nil && client.ClientID != tt.clientID {
+			t.Errorf("Authenticate(%s) = %+v", tt.clientID, client)
+		}
+	}
+	if _, err := store.Authenticate("invalid", "secret"); err == nil {
+		t.Error("client with a malformed bcrypt hash authenticated")
+	}
+}
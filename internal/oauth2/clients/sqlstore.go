@@ -2,6 +2,7 @@ package clients
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/blockloop/scan/v2"
 	"github.com/cwkr/authd/internal/maputil"
@@ -12,21 +13,87 @@ import (
 )
 
 type sqlClient struct {
-	RedirectURIPattern         sql.NullString `db:"redirect_uri_pattern"`
-	SecretHash                 sql.NullString `db:"secret_hash"`
-	SessionName                sql.NullString `db:"session_name"`
-	DisableImplicit            sql.NullBool   `db:"disable_implicit"`
-	EnableRefreshTokenRotation sql.NullBool   `db:"enable_refresh_token_rotation"`
+	RedirectURIPattern           sql.NullString `db:"redirect_uri_pattern"`
+	SecretHash                   sql.NullString `db:"secret_hash"`
+	SessionName                  sql.NullString `db:"session_name"`
+	DisableImplicit              sql.NullBool   `db:"disable_implicit"`
+	EnableRefreshTokenRotation   sql.NullBool   `db:"enable_refresh_token_rotation"`
+	RefreshTokenTTL              sql.NullInt64  `db:"refresh_token_ttl"`
+	RefreshTokenMaxTTL           sql.NullInt64  `db:"refresh_token_max_ttl"`
+	OfflineSessionTTL            sql.NullInt64  `db:"offline_session_ttl"`
+	GrantTypes                   sql.NullString `db:"grant_types"`
+	ResponseTypes                sql.NullString `db:"response_types"`
+	AllowedScopes                sql.NullString `db:"allowed_scopes"`
+	DefaultScopes                sql.NullString `db:"default_scopes"`
+	AccessTokenTTL               sql.NullInt64  `db:"access_token_ttl"`
+	IDTokenTTL                   sql.NullInt64  `db:"id_token_ttl"`
+	CodeTTL                      sql.NullInt64  `db:"code_ttl"`
+	AccessTokenExtraClaims       sql.NullString `db:"access_token_extra_claims"`
+	IDTokenExtraClaims           sql.NullString `db:"id_token_extra_claims"`
+	ReleasedAttributes           sql.NullString `db:"released_attributes"`
+	JwksURI                      sql.NullString `db:"jwks_uri"`
+	IDTokenEncryptedResponseAlg  sql.NullString `db:"id_token_encrypted_response_alg"`
+	IDTokenEncryptedResponseEnc  sql.NullString `db:"id_token_encrypted_response_enc"`
+	UserinfoSignedResponseAlg    sql.NullString `db:"userinfo_signed_response_alg"`
+	UserinfoEncryptedResponseAlg sql.NullString `db:"userinfo_encrypted_response_alg"`
+	UserinfoEncryptedResponseEnc sql.NullString `db:"userinfo_encrypted_response_enc"`
+	SubjectType                  sql.NullString `db:"subject_type"`
+	SectorIdentifier             sql.NullString `db:"sector_identifier"`
+	AccessTokenFormat            sql.NullString `db:"access_token_format"`
+	RequireMFA                   sql.NullBool   `db:"require_mfa"`
 }
 
-func (s *sqlClient) Client() *Client {
-	return &Client{
-		RedirectURIPattern:         s.RedirectURIPattern.String,
-		SecretHash:                 s.SecretHash.String,
-		SessionName:                s.SessionName.String,
-		DisableImplicit:            s.DisableImplicit.Bool,
-		EnableRefreshTokenRotation: s.EnableRefreshTokenRotation.Bool,
+func unmarshalClaims(rawClaims sql.NullString) (map[string]string, error) {
+	if strings.TrimSpace(rawClaims.String) == "" {
+		return nil, nil
+	}
+	var claims map[string]string
+	if err := json.Unmarshal([]byte(rawClaims.String), &claims); err != nil {
+		return nil, err
 	}
+	return claims, nil
+}
+
+func (s *sqlClient) Client(clientID string) (*Client, error) {
+	var accessTokenExtraClaims, idTokenExtraClaims map[string]string
+	var err error
+	if accessTokenExtraClaims, err = unmarshalClaims(s.AccessTokenExtraClaims); err != nil {
+		return nil, err
+	}
+	if idTokenExtraClaims, err = unmarshalClaims(s.IDTokenExtraClaims); err != nil {
+		return nil, err
+	}
+	return &Client{
+		ClientID:                     clientID,
+		RedirectURIPattern:           s.RedirectURIPattern.String,
+		SecretHash:                   s.SecretHash.String,
+		SessionName:                  s.SessionName.String,
+		DisableImplicit:              s.DisableImplicit.Bool,
+		EnableRefreshTokenRotation:   s.EnableRefreshTokenRotation.Bool,
+		RefreshTokenTTL:              int(s.RefreshTokenTTL.Int64),
+		RefreshTokenMaxTTL:           int(s.RefreshTokenMaxTTL.Int64),
+		OfflineSessionTTL:            int(s.OfflineSessionTTL.Int64),
+		GrantTypes:                   strings.Fields(s.GrantTypes.String),
+		ResponseTypes:                strings.Fields(s.ResponseTypes.String),
+		AllowedScopes:                strings.Fields(s.AllowedScopes.String),
+		DefaultScopes:                strings.Fields(s.DefaultScopes.String),
+		AccessTokenTTL:               int(s.AccessTokenTTL.Int64),
+		IDTokenTTL:                   int(s.IDTokenTTL.Int64),
+		CodeTTL:                      int(s.CodeTTL.Int64),
+		AccessTokenExtraClaims:       accessTokenExtraClaims,
+		IDTokenExtraClaims:           idTokenExtraClaims,
+		ReleasedAttributes:           strings.Fields(s.ReleasedAttributes.String),
+		JwksURI:                      s.JwksURI.String,
+		IDTokenEncryptedResponseAlg:  s.IDTokenEncryptedResponseAlg.String,
+		IDTokenEncryptedResponseEnc:  s.IDTokenEncryptedResponseEnc.String,
+		UserinfoSignedResponseAlg:    s.UserinfoSignedResponseAlg.String,
+		UserinfoEncryptedResponseAlg: s.UserinfoEncryptedResponseAlg.String,
+		UserinfoEncryptedResponseEnc: s.UserinfoEncryptedResponseEnc.String,
+		SubjectType:                  s.SubjectType.String,
+		SectorIdentifier:             s.SectorIdentifier.String,
+		AccessTokenFormat:            s.AccessTokenFormat.String,
+		RequireMFA:                   s.RequireMFA.Bool,
+	}, nil
 }
 
 type sqlStore struct {
@@ -70,8 +137,12 @@ func (s *sqlStore) Lookup(clientID string) (*Client, error) {
 
 	var client sqlClient
 	log.Printf("SQL: %s; -- %s", s.settings.Query, clientID)
-	// SELECT redirect_uri_pattern, secret_hash, session_name, disable_implicit, enable_refresh_token_rotation
-	// FROM clients WHERE lower(client_id) = lower($1)
+	// SELECT redirect_uri_pattern, secret_hash, session_name, disable_implicit, enable_refresh_token_rotation,
+	// refresh_token_ttl, refresh_token_max_ttl, offline_session_ttl, grant_types, response_types, allowed_scopes,
+	// default_scopes, access_token_ttl, id_token_ttl, code_ttl, access_token_extra_claims, id_token_extra_claims,
+	// released_attributes, jwks_uri, id_token_encrypted_response_alg, id_token_encrypted_response_enc,
+	// userinfo_signed_response_alg, userinfo_encrypted_response_alg, userinfo_encrypted_response_enc,
+	// subject_type, sector_identifier, access_token_format, require_mfa FROM clients WHERE lower(client_id) = lower($1)
 	if rows, err := s.dbconn.Query(s.settings.Query, clientID); err == nil {
 		if err := scan.RowStrict(&client, rows); err != nil {
 			log.Printf("!!! Scan client failed: %v", err)
@@ -85,7 +156,7 @@ func (s *sqlStore) Lookup(clientID string) (*Client, error) {
 		return nil, err
 	}
 	log.Printf("%#v", client)
-	return client.Client(), nil
+	return client.Client(clientID)
 }
 
 type clientSessionInfo struct {
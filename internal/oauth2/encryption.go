@@ -0,0 +1,128 @@
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClientKeysMissing     = errors.New("client has no registered keys")
+	ErrNoSuitableEncryptKey  = errors.New("no suitable encryption key found in client keys")
+	ErrUnsupportedEncryption = errors.New("unsupported encryption algorithm")
+)
+
+var (
+	KeyEncryptionAlgorithms = []string{
+		string(jose.RSA_OAEP),
+		string(jose.RSA_OAEP_256),
+		string(jose.ECDH_ES),
+		string(jose.ECDH_ES_A128KW),
+		string(jose.ECDH_ES_A192KW),
+		string(jose.ECDH_ES_A256KW),
+	}
+	ContentEncryptionAlgorithms = []string{
+		string(jose.A128CBC_HS256),
+		string(jose.A192CBC_HS384),
+		string(jose.A256CBC_HS512),
+		string(jose.A128GCM),
+		string(jose.A192GCM),
+		string(jose.A256GCM),
+	}
+)
+
+// ClientKeySets provides the public keys registered by clients via jwks_uri
+type ClientKeySets interface {
+	Get(client clients.Client) ([]jose.JSONWebKey, error)
+}
+
+type clientKeySets struct {
+	dir           string
+	cacheDuration time.Duration
+	mu            sync.Mutex
+	providers     map[string]keyset.JSONWebKeyProvider
+}
+
+func NewClientKeySets(dir string, cacheDuration time.Duration) ClientKeySets {
+	return &clientKeySets{
+		dir:           dir,
+		cacheDuration: cacheDuration,
+		providers:     map[string]keyset.JSONWebKeyProvider{},
+	}
+}
+
+func (c *clientKeySets) Get(client clients.Client) ([]jose.JSONWebKey, error) {
+	if client.JwksURI == "" {
+		return nil, ErrClientKeysMissing
+	}
+	c.mu.Lock()
+	var provider, found = c.providers[client.JwksURI]
+	if !found {
+		provider = keyset.NewJSONWebKeyProvider(c.dir, []string{client.JwksURI}, c.cacheDuration)
+		c.providers[client.JwksURI] = provider
+	}
+	c.mu.Unlock()
+	return provider.JSONWebKeys()
+}
+
+// encryptionKey reports whether a client key may be used with the key encryption algorithm, keys meant for signatures
+// or registered for another algorithm are skipped
+func encryptionKey(jwk jose.JSONWebKey, algorithm string) bool {
+	if (jwk.Use != "" && jwk.Use != "enc") || (jwk.Algorithm != "" && jwk.Algorithm != algorithm) {
+		return false
+	}
+	switch jwk.Key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(algorithm, "RSA")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(algorithm, "ECDH")
+	}
+	return false
+}
+
+// NewEncrypter creates an encrypter for the first client key that fits the key encryption algorithm, keys with use
+// "enc" are preferred to keys without use. The content encryption defaults to A128CBC-HS256 when empty.
+func NewEncrypter(publicKeys []jose.JSONWebKey, algorithm, encryption, contentType string) (jose.Encrypter, error) {
+	if !slices.Contains(KeyEncryptionAlgorithms, algorithm) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, algorithm)
+	}
+	if encryption == "" {
+		encryption = string(jose.A128CBC_HS256)
+	} else if !slices.Contains(ContentEncryptionAlgorithms, encryption) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, encryption)
+	}
+
+	var candidates = slices.DeleteFunc(slices.Clone(publicKeys), func(jwk jose.JSONWebKey) bool {
+		return !encryptionKey(jwk, algorithm)
+	})
+	if len(candidates) == 0 {
+		return nil, ErrNoSuitableEncryptKey
+	}
+	slices.SortFunc(candidates, func(a, b jose.JSONWebKey) int {
+		if (a.Use == "enc") != (b.Use == "enc") {
+			if a.Use == "enc" {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.KeyID, b.KeyID)
+	})
+
+	var options = (&jose.EncrypterOptions{}).WithType("JWT")
+	if contentType != "" {
+		options = options.WithContentType(jose.ContentType(contentType))
+	}
+	return jose.NewEncrypter(
+		jose.ContentEncryption(encryption),
+		jose.Recipient{Algorithm: jose.KeyAlgorithm(algorithm), Key: candidates[0].Key, KeyID: candidates[0].KeyID},
+		options,
+	)
+}
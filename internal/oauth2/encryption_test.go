@@ -0,0 +1,84 @@
+package oauth2
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/go-jose/go-jose/v3"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewEncrypterKeySelection(t *testing.T) {
+	var privateKeys = map[string]*rsa.PrivateKey{}
+	for _, kid := range []string{"a-sig", "b-oaep", "c-enc", "d-any"} {
+		var privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKeys[kid] = privateKey
+	}
+	var jwks = jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &privateKeys["a-sig"].PublicKey, KeyID: "a-sig", Use: "sig", Algorithm: string(jose.RS256)},
+		{Key: &privateKeys["b-oaep"].PublicKey, KeyID: "b-oaep", Use: "enc", Algorithm: string(jose.RSA_OAEP)},
+		{Key: &privateKeys["c-enc"].PublicKey, KeyID: "c-enc", Use: "enc", Algorithm: string(jose.RSA_OAEP_256)},
+		{Key: &privateKeys["d-any"].PublicKey, KeyID: "d-any"},
+	}}
+	var jwksBytes, err = json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "client.json"), jwksBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	publicKeys, err := NewClientKeySets(dir, time.Minute).Get(clients.Client{JwksURI: "client.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		keys      []jose.JSONWebKey
+		algorithm string
+		keyID     string
+	}{
+		{publicKeys, string(jose.RSA_OAEP_256), "c-enc"},
+		{publicKeys, string(jose.RSA_OAEP), "b-oaep"},
+		{publicKeys[:1], string(jose.RSA_OAEP), ""},
+		{[]jose.JSONWebKey{publicKeys[0], publicKeys[3]}, string(jose.RSA_OAEP_256), "d-any"},
+		{publicKeys, string(jose.ECDH_ES), ""},
+	} {
+		var encrypter, err = NewEncrypter(tt.keys, tt.algorithm, "", "")
+		if tt.keyID == "" {
+			if !errors.Is(err, ErrNoSuitableEncryptKey) {
+				t.Errorf("%s: err = %v, want ErrNoSuitableEncryptKey", tt.algorithm, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.algorithm, err)
+		}
+		serialized, err := encrypter.Encrypt([]byte("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := serialized.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := jose.ParseEncrypted(compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if object.Header.KeyID != tt.keyID {
+			t.Errorf("%s: encrypted to %s, want %s", tt.algorithm, object.Header.KeyID, tt.keyID)
+		}
+		if plaintext, err := object.Decrypt(privateKeys[tt.keyID]); err != nil || string(plaintext) != "payload" {
+			t.Errorf("%s: Decrypt = %q, %v", tt.algorithm, plaintext, err)
+		}
+	}
+}
@@ -35,6 +35,19 @@ const (
 	// the ErrorInvalidRequest above.
 	ErrorUnsupportedGrantType = "unsupported_grant_type"
 
+	// ErrorUnsupportedResponseType - The authorization server does not
+	// support obtaining an authorization code or access token using this
+	// method, or the client is not allowed to use it.
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+
+	// ErrorInvalidToken - The access token is expired, revoked or
+	// otherwise invalid. Send an HTTP 401 response in this case.
+	ErrorInvalidToken = "invalid_token"
+
+	// ErrorUnsupportedTokenType - The authorization server does not support
+	// the revocation of the presented token type.
+	ErrorUnsupportedTokenType = "unsupported_token_type"
+
 	ErrorInternal = "internal_server_error"
 	ErrorNotFound = "not_found"
 )
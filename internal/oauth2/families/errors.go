@@ -0,0 +1,9 @@
+package families
+
+import "errors"
+
+var (
+	ErrFamilyNotFound = errors.New("refresh token family not found")
+	ErrFamilyRevoked  = errors.New("refresh token family has been revoked")
+	ErrTokenReused    = errors.New("refresh token has already been used")
+)
@@ -0,0 +1,75 @@
+package families
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type inMemoryStore struct {
+	mu       sync.Mutex
+	families map[string]Family
+}
+
+func NewInMemoryStore() Store {
+	return &inMemoryStore{families: map[string]Family{}}
+}
+
+func (s *inMemoryStore) purge(now time.Time) {
+	for familyID, family := range s.families {
+		if family.ExpirationTime.Before(now) {
+			delete(s.families, familyID)
+		}
+	}
+}
+
+func (s *inMemoryStore) Create(family Family) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	s.families[family.FamilyID] = family
+	return nil
+}
+
+func (s *inMemoryStore) Lookup(familyID string) (*Family, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if family, found := s.families[familyID]; found && family.ExpirationTime.After(time.Now()) {
+		return &family, nil
+	}
+	return nil, ErrFamilyNotFound
+}
+
+func (s *inMemoryStore) Rotate(familyID, oldTokenID, newTokenID string, expirationTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var family, found = s.families[familyID]
+	if !found {
+		return ErrFamilyNotFound
+	}
+	if family.Revoked {
+		return ErrFamilyRevoked
+	}
+	if family.TokenID != oldTokenID {
+		return ErrTokenReused
+	}
+	family.TokenID = newTokenID
+	family.ExpirationTime = expirationTime
+	s.families[familyID] = family
+	return nil
+}
+
+func (s *inMemoryStore) Revoke(familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if family, found := s.families[familyID]; found {
+		family.Revoked = true
+		s.families[familyID] = family
+		log.Printf("refresh token family %s revoked", familyID)
+	}
+	return nil
+}
+
+func (s *inMemoryStore) Ping() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package families
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	var (
+		store  = NewInMemoryStore()
+		expiry = time.Now().Add(time.Hour)
+	)
+	if _, err := store.Lookup("family"); !errors.Is(err, ErrFamilyNotFound) {
+		t.Errorf("Lookup before Create = %v", err)
+	}
+	if err := store.Create(Family{FamilyID: "family", UserID: "alice", ClientID: "app", TokenID: "first", ExpirationTime: expiry}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(Family{FamilyID: "expired", TokenID: "first", ExpirationTime: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup("expired"); !errors.Is(err, ErrFamilyNotFound) {
+		t.Errorf("Lookup of expired family = %v", err)
+	}
+
+	if err := store.Rotate("family", "first", "second", expiry.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var family, err = store.Lookup("family")
+	if err != nil || family.TokenID != "second" || !family.ExpirationTime.Equal(expiry.Add(time.Hour)) || family.UserID != "alice" {
+		t.Fatalf("Lookup after Rotate = %+v, %v", family, err)
+	}
+	if err := store.Rotate("family", "first", "third", expiry); !errors.Is(err, ErrTokenReused) {
+		t.Errorf("Rotate of rotated token = %v", err)
+	}
+	if err := store.Rotate("unknown", "first", "second", expiry); !errors.Is(err, ErrFamilyNotFound) {
+		t.Errorf("Rotate of unknown family = %v", err)
+	}
+
+	if err := store.Revoke("family"); err != nil {
+		t.Fatal(err)
+	}
+	if family, err := store.Lookup("family"); err != nil || !family.Revoked {
+		t.Errorf("Lookup after Revoke = %+v, %v", family, err)
+	}
+	if err := store.Rotate("family", "second", "third", expiry); !errors.Is(err, ErrFamilyRevoked) {
+		t.Errorf("Rotate of revoked family = %v", err)
+	}
+	if err := store.Revoke("unknown"); err != nil {
+		t.Errorf("Revoke of unknown family = %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package families
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/blockloop/scan/v2"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"log"
+	"time"
+)
+
+type sqlStore struct {
+	dbconn   *sql.DB
+	settings *StoreSettings
+}
+
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:   dbconn,
+			settings: settings,
+		}, nil
+	}
+}
+
+func (s *sqlStore) Create(family Family) error {
+	log.Printf("SQL: %s; -- %s, %s, %s, %s, %v", s.settings.Insert, family.FamilyID, family.UserID, family.ClientID, family.TokenID, family.ExpirationTime)
+	// INSERT INTO refresh_token_families (fid, user_id, client_id, jti, exp) VALUES ($1, $2, $3, $4, $5)
+	_, err := s.dbconn.Exec(s.settings.Insert, family.FamilyID, family.UserID, family.ClientID, family.TokenID, family.ExpirationTime)
+	return err
+}
+
+func (s *sqlStore) Lookup(familyID string) (*Family, error) {
+	var family Family
+
+	log.Printf("SQL: %s; -- %s", s.settings.Query, familyID)
+	// SELECT fid, user_id, client_id, jti, revoked, exp FROM refresh_token_families WHERE fid = $1 AND exp >= current_timestamp
+	if rows, err := s.dbconn.Query(s.settings.Query, familyID); err == nil {
+		if err := scan.RowStrict(&family, rows); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrFamilyNotFound
+			}
+			return nil, err
+		}
+	} else {
+		log.Printf("!!! Query for refresh token family failed: %v", err)
+		return nil, err
+	}
+	return &family, nil
+}
+
+func (s *sqlStore) Rotate(familyID, oldTokenID, newTokenID string, expirationTime time.Time) error {
+	log.Printf("SQL: %s; -- %s, %s, %s, %v", s.settings.Update, familyID, oldTokenID, newTokenID, expirationTime)
+	// UPDATE refresh_token_families SET jti = $3, exp = $4, last_modified = now() WHERE fid = $1 AND jti = $2 AND revoked = FALSE
+	if result, err := s.dbconn.Exec(s.settings.Update, familyID, oldTokenID, newTokenID, expirationTime); err != nil {
+		return err
+	} else if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrTokenReused
+	}
+	return nil
+}
+
+func (s *sqlStore) Revoke(familyID string) error {
+	log.Printf("SQL: %s; -- %s", s.settings.Revoke, familyID)
+	// UPDATE refresh_token_families SET revoked = TRUE, last_modified = now() WHERE fid = $1
+	_, err := s.dbconn.Exec(s.settings.Revoke, familyID)
+	return err
+}
+
+func (s *sqlStore) Ping() error {
+	return s.dbconn.Ping()
+}
@@ -0,0 +1,22 @@
+package families
+
+import (
+	"time"
+)
+
+type Family struct {
+	FamilyID       string    `db:"fid"`
+	UserID         string    `db:"user_id"`
+	ClientID       string    `db:"client_id"`
+	TokenID        string    `db:"jti"`
+	Revoked        bool      `db:"revoked"`
+	ExpirationTime time.Time `db:"exp"`
+}
+
+type Store interface {
+	Create(family Family) error
+	Lookup(familyID string) (*Family, error)
+	Rotate(familyID, oldTokenID, newTokenID string, expirationTime time.Time) error
+	Revoke(familyID string) error
+	Ping() error
+}
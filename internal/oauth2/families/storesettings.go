@@ -0,0 +1,9 @@
+package families
+
+type StoreSettings struct {
+	URI    string `json:"uri,omitempty"`
+	Query  string `json:"query,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Update string `json:"update,omitempty"`
+	Revoke string `json:"revoke,omitempty"`
+}
@@ -0,0 +1,159 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/stringutil"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// introspectionMetadata are the claims of RFC 7662 returned to clients that may introspect a token but not read all
+// of its claims
+var introspectionMetadata = []string{
+	ClaimScope, ClaimClientID, ClaimSubject, ClaimAudience, ClaimIssuer, ClaimTokenID,
+	ClaimExpiryTime, ClaimIssuedAtTime, ClaimNotBeforeTime,
+}
+
+type introspectHandler struct {
+	tokenCreator         TokenCreator
+	clientStore          clients.Store
+	trlStore             trl.Store
+	introspectionClients []string
+}
+
+func (i *introspectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+
+	httputil.AllowCORS(w, r, []string{http.MethodPost, http.MethodOptions}, false)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var (
+		clientID, clientSecret, basicAuth = r.BasicAuth()
+		token                             = strings.TrimSpace(r.PostFormValue("token"))
+		tokenTypeHint                     = strings.TrimSpace(r.PostFormValue("token_type_hint"))
+	)
+	// when not using basic auth load client_id and client_secret parameters
+	if !basicAuth {
+		clientID = strings.TrimSpace(r.PostFormValue("client_id"))
+		clientSecret = r.PostFormValue("client_secret")
+	}
+
+	// debug output of parameters
+	log.Printf("client_id=%q client_secret=%q token_type_hint=%q token=%q",
+		clientID, strings.Repeat("*", utf8.RuneCountInString(clientSecret)), tokenTypeHint, token)
+
+	if stringutil.IsAnyEmpty(clientID, clientSecret, token) {
+		Error(w, ErrorInvalidRequest, "client_id, client_secret and token parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := i.clientStore.Authenticate(clientID, clientSecret); err != nil {
+		Error(w, ErrorInvalidClient, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var response = map[string]any{"active": false}
+	if claims, err := i.tokenCreator.Introspect(token); err == nil {
+		// codes and refresh tokens are no access tokens, access tokens carry no typ claim
+		if claims[ClaimType] != nil {
+			log.Printf("!!! introspection of token type %v", claims[ClaimType])
+		} else if !i.introspects(clientID, claims) {
+			log.Printf("!!! client_id=%s is not allowed to introspect token of client_id=%v", clientID, claims[ClaimClientID])
+		} else if revoked, err := i.isRevoked(claims); err != nil {
+			log.Printf("!!! %s", err)
+			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !revoked {
+			if i.isIntrospectionClient(clientID) {
+				response = claims
+			} else {
+				// the claims of reference tokens are only released to resource servers
+				for _, name := range introspectionMetadata {
+					if value, found := claims[name]; found {
+						response[name] = value
+					}
+				}
+			}
+			response["active"] = true
+			response["token_type"] = "Bearer"
+		}
+	} else {
+		log.Printf("!!! %s", err)
+	}
+
+	if bytes, err := json.Marshal(response); err != nil {
+		Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+	} else {
+		httputil.NoCache(w)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+	}
+}
+
+func (i *introspectHandler) isIntrospectionClient(clientID string) bool {
+	return slices.ContainsFunc(i.introspectionClients, func(introspectionClient string) bool {
+		return strings.EqualFold(introspectionClient, clientID)
+	})
+}
+
+// introspects reports whether the client may introspect the token, which are resource servers listed in
+// introspection_clients and the client the token was issued to or is intended for
+func (i *introspectHandler) introspects(clientID string, claims map[string]any) bool {
+	if i.isIntrospectionClient(clientID) {
+		return true
+	}
+	if tokenClientID, _ := claims[ClaimClientID].(string); strings.EqualFold(tokenClientID, clientID) {
+		return true
+	}
+	switch audience := claims[ClaimAudience].(type) {
+	case string:
+		return strings.EqualFold(audience, clientID)
+	case []string:
+		return slices.ContainsFunc(audience, func(aud string) bool { return strings.EqualFold(aud, clientID) })
+	case []any:
+		return slices.ContainsFunc(audience, func(aud any) bool { s, _ := aud.(string); return strings.EqualFold(s, clientID) })
+	}
+	return false
+}
+
+// isRevoked checks the token id and the revocation cutoffs for the user and client the token was issued to
+func (i *introspectHandler) isRevoked(claims map[string]any) (bool, error) {
+	var (
+		tokenID, _  = claims[ClaimTokenID].(string)
+		clientID, _ = claims[ClaimClientID].(string)
+		userID, _   = claims[ClaimUserID].(string)
+	)
+	if userID == "" {
+		userID, _ = claims[ClaimSubject].(string)
+	}
+	// client credentials tokens have the client as subject and no user to resolve
+	if strings.EqualFold(userID, clientID) {
+		return IsRevoked(i.trlStore, tokenID, userID, clientID, NumericDate(claims[ClaimIssuedAtTime]))
+	}
+	if client, err := i.clientStore.Lookup(clientID); err == nil {
+		if userID, err = i.tokenCreator.ResolveSubject(*client, userID); err != nil {
+			// subjects that cannot be mapped back to a user are reported as inactive
+			return true, nil
+		}
+	}
+	return IsRevoked(i.trlStore, tokenID, userID, clientID, NumericDate(claims[ClaimIssuedAtTime]))
+}
+
+func IntrospectHandler(tokenCreator TokenCreator, clientStore clients.Store, trlStore trl.Store, introspectionClients []string) http.Handler {
+	return &introspectHandler{
+		tokenCreator:         tokenCreator,
+		clientStore:          clientStore,
+		trlStore:             trlStore,
+		introspectionClients: introspectionClients,
+	}
+}
@@ -0,0 +1,77 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func (o *oauth2Test) introspect(clientID, token string) map[string]any {
+	var handler = IntrospectHandler(o.tokenCreator, o.clientStore, o.trlStore, []string{"resource-server"})
+	var status, response = o.post(handler, clientID, url.Values{"token": {token}})
+	if status != http.StatusOK {
+		o.t.Fatalf("introspect: %d %v", status, response)
+	}
+	return response
+}
+
+func TestIntrospectReferenceToken(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var token = o.accessToken("reference", "alice")
+
+	var response = o.introspect("resource-server", token)
+	if response["active"] != true || response["sub"] != "alice" || response["department"] != "Sales" || response["groups"] == nil {
+		t.Errorf("introspection by resource server = %v", response)
+	}
+
+	// the client the token was issued to only learns the metadata
+	response = o.introspect("reference", token)
+	if response["active"] != true || response["client_id"] != "reference" || response["scope"] != "openid" || response["token_type"] != "Bearer" {
+		t.Errorf("introspection by client = %v", response)
+	}
+	if _, found := response["department"]; found {
+		t.Errorf("claims released to client: %v", response)
+	}
+	if _, found := response["groups"]; found {
+		t.Errorf("claims released to client: %v", response)
+	}
+
+	if response = o.introspect("other", token); len(response) != 1 || response["active"] != false {
+		t.Errorf("introspection by other client = %v", response)
+	}
+}
+
+func TestIntrospectJWT(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var token = o.accessToken("app", "alice")
+
+	if response := o.introspect("app", token); response["active"] != true || response["sub"] != "alice" {
+		t.Errorf("introspection = %v", response)
+	}
+	if status, response := o.revoke("app", token, ""); status != http.StatusNoContent {
+		t.Fatalf("revoke: %d %v", status, response)
+	}
+	if response := o.introspect("resource-server", token); response["active"] != false {
+		t.Errorf("revoked token introspection = %v", response)
+	}
+}
+
+func TestIntrospectOtherTokens(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var client = o.client("app")
+
+	var code, err = o.tokenCreator.GenerateAuthCode("alice", client, "openid", "", "", time.Now(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, _, err := o.tokenCreator.GenerateRefreshToken("alice", client, "openid offline_access", "", "", time.Now(), time.Now().Add(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"code": code, "refresh token": refreshToken, "invalid token": "invalid"} {
+		if response := o.introspect("resource-server", token); len(response) != 1 || response["active"] != false {
+			t.Errorf("%s introspection = %v", name, response)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package keys
+
+import "errors"
+
+var (
+	ErrKeyNotFound     = errors.New("signing key not found")
+	ErrNoActiveKey     = errors.New("no active signing key")
+	ErrKeyExists       = errors.New("signing key already exists")
+	ErrInvalidKeyState = errors.New("invalid signing key state")
+)
@@ -0,0 +1,129 @@
+package keys
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type storedKey struct {
+	KeyID      string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey string    `json:"private_key"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	Expiry     time.Time `json:"expiry"`
+}
+
+type fileStore struct {
+	mu       sync.Mutex
+	filename string
+}
+
+// NewFileStore creates a store that keeps the keys as PKCS#8 PEM in a JSON file readable only by the owner
+func NewFileStore(filename string) Store {
+	return &fileStore{filename: filename}
+}
+
+func (f *fileStore) read() ([]storedKey, error) {
+	var storedKeys []storedKey
+	var bytes, err = os.ReadFile(f.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &storedKeys); err != nil {
+		return nil, err
+	}
+	return storedKeys, nil
+}
+
+func (f *fileStore) write(storedKeys []storedKey) error {
+	var bytes, err = json.MarshalIndent(storedKeys, "", "  ")
+	if err != nil {
+		return err
+	}
+	var tmpFilename = filepath.Join(filepath.Dir(f.filename), "."+filepath.Base(f.filename)+".tmp")
+	if err := os.WriteFile(tmpFilename, bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, f.filename)
+}
+
+func (f *fileStore) Load() ([]Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var storedKeys, err = f.read()
+	if err != nil {
+		return nil, err
+	}
+	var keys = make([]Key, 0, len(storedKeys))
+	for _, storedKey := range storedKeys {
+		var block, _ = pem.Decode([]byte(storedKey.PrivateKey))
+		if block == nil {
+			return nil, ErrInvalidKeyState
+		}
+		var privateKey, err = keyset.ParsePrivateKey(block, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, Key{
+			KeyID:      storedKey.KeyID,
+			Algorithm:  jose.SignatureAlgorithm(storedKey.Algorithm),
+			PrivateKey: privateKey,
+			NotBefore:  storedKey.NotBefore,
+			NotAfter:   storedKey.NotAfter,
+			Expiry:     storedKey.Expiry,
+		})
+	}
+	return keys, nil
+}
+
+func (f *fileStore) Add(key Key) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var storedKeys, err = f.read()
+	if err != nil {
+		return err
+	}
+	for _, storedKey := range storedKeys {
+		if storedKey.NotBefore.Equal(key.NotBefore) {
+			return ErrKeyExists
+		}
+	}
+	pemBytes, err := keyset.EncodePrivateKeyPEM(key.PrivateKey, key.KeyID)
+	if err != nil {
+		return err
+	}
+	return f.write(append(storedKeys, storedKey{
+		KeyID:      key.KeyID,
+		Algorithm:  string(key.Algorithm),
+		PrivateKey: string(pemBytes),
+		NotBefore:  key.NotBefore,
+		NotAfter:   key.NotAfter,
+		Expiry:     key.Expiry,
+	}))
+}
+
+func (f *fileStore) Delete(keyID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var storedKeys, err = f.read()
+	if err != nil {
+		return err
+	}
+	var remainingKeys = make([]storedKey, 0, len(storedKeys))
+	for _, storedKey := range storedKeys {
+		if storedKey.KeyID != keyID {
+			remainingKeys = append(remainingKeys, storedKey)
+		}
+	}
+	return f.write(remainingKeys)
+}
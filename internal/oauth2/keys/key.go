@@ -0,0 +1,48 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v3"
+	"time"
+)
+
+// Key is a signing key. It signs tokens from NotBefore until NotAfter and verifies them until Expiry, zero times are
+// unbounded.
+type Key struct {
+	KeyID      string
+	Algorithm  jose.SignatureAlgorithm
+	PrivateKey crypto.Signer
+	NotBefore  time.Time
+	NotAfter   time.Time
+	Expiry     time.Time
+}
+
+func (k Key) Public() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+func (k Key) Signer() (jose.Signer, error) {
+	return k.SignerWithAlgorithm(k.Algorithm)
+}
+
+func (k Key) SignerWithAlgorithm(algorithm jose.SignatureAlgorithm) (jose.Signer, error) {
+	var signingKey any
+	switch privateKey := k.PrivateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		signingKey = privateKey
+	default:
+		signingKey = opaqueSigner{signer: privateKey, keyID: k.KeyID}
+	}
+	return jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: signingKey}, (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", k.KeyID))
+}
+
+func (k Key) isActive(now time.Time) bool {
+	return !k.NotBefore.After(now) && (k.NotAfter.IsZero() || now.Before(k.NotAfter))
+}
+
+func (k Key) isExpired(now time.Time) bool {
+	return !k.Expiry.IsZero() && !now.Before(k.Expiry)
+}
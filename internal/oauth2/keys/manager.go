@@ -0,0 +1,61 @@
+package keys
+
+import (
+	"github.com/cwkr/authd/keyset"
+	"strings"
+	"time"
+)
+
+// Manager provides the key to sign new tokens with and all keys that tokens can be verified with. As a
+// keyset.Provider it publishes the public keys of all keys that are not expired.
+type Manager interface {
+	keyset.Provider
+	Current() (*Key, error)
+	Lookup(keyID string) (*Key, error)
+}
+
+type staticManager struct {
+	key Key
+}
+
+// NewStaticManager creates a manager for a single configured key that never rotates
+func NewStaticManager(key Key) Manager {
+	return &staticManager{key: key}
+}
+
+func (s *staticManager) Current() (*Key, error) {
+	var key = s.key
+	return &key, nil
+}
+
+func (s *staticManager) Lookup(keyID string) (*Key, error) {
+	if keyID != "" && !strings.EqualFold(keyID, s.key.KeyID) {
+		return nil, ErrKeyNotFound
+	}
+	var key = s.key
+	return &key, nil
+}
+
+func (s *staticManager) Get() (map[string]any, error) {
+	return map[string]any{s.key.KeyID: s.key.Public()}, nil
+}
+
+// currentKey returns the most recently activated key, keys that are past NotAfter are used as fallback until a new
+// key has been activated.
+func currentKey(keys []Key, now time.Time) (*Key, error) {
+	var current *Key
+	for i, key := range keys {
+		if key.NotBefore.After(now) || key.isExpired(now) {
+			continue
+		}
+		if current == nil || (key.isActive(now) && !current.isActive(now)) ||
+			(key.isActive(now) == current.isActive(now) && key.NotBefore.After(current.NotBefore)) {
+			current = &keys[i]
+		}
+	}
+	if current == nil {
+		return nil, ErrNoActiveKey
+	}
+	var key = *current
+	return &key, nil
+}
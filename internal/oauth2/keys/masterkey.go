@@ -0,0 +1,55 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var (
+	ErrMasterKeyMissing = errors.New("master key is required to store signing keys in a database")
+)
+
+// masterKey encrypts private keys with AES-256-GCM, the key id is authenticated so that encrypted keys cannot be
+// swapped between rows.
+type masterKey struct {
+	aead cipher.AEAD
+}
+
+func newMasterKey(secret []byte) (*masterKey, error) {
+	if len(secret) == 0 {
+		return nil, ErrMasterKeyMissing
+	}
+	var key = sha256.Sum256(secret)
+	var block, err = aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &masterKey{aead: aead}, nil
+}
+
+func (m *masterKey) seal(plaintext []byte, keyID string) (string, error) {
+	var nonce = make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(m.aead.Seal(nonce, nonce, plaintext, []byte(keyID))), nil
+}
+
+func (m *masterKey) open(ciphertext, keyID string) ([]byte, error) {
+	var data, err = base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < m.aead.NonceSize() {
+		return nil, ErrInvalidKeyState
+	}
+	return m.aead.Open(nil, data[:m.aead.NonceSize()], data[m.aead.NonceSize():], []byte(keyID))
+}
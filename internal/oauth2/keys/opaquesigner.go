@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
+	"math/big"
+)
+
+// opaqueSigner adapts a crypto.Signer whose private key is not accessible (e.g. kept in a hardware token) to jose
+type opaqueSigner struct {
+	signer crypto.Signer
+	keyID  string
+}
+
+func (o opaqueSigner) Public() *jose.JSONWebKey {
+	return &jose.JSONWebKey{Key: o.signer.Public(), KeyID: o.keyID, Use: "sig"}
+}
+
+func (o opaqueSigner) Algs() []jose.SignatureAlgorithm {
+	return keyset.SigningAlgorithms(o.signer.Public())
+}
+
+func (o opaqueSigner) SignPayload(payload []byte, algorithm jose.SignatureAlgorithm) ([]byte, error) {
+	var hash crypto.Hash
+	switch algorithm {
+	case jose.RS256, jose.PS256, jose.ES256:
+		hash = crypto.SHA256
+	case jose.RS384, jose.PS384, jose.ES384:
+		hash = crypto.SHA384
+	case jose.RS512, jose.PS512, jose.ES512:
+		hash = crypto.SHA512
+	case jose.EdDSA:
+		return o.signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("%w: %s", jose.ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	var hasher = hash.New()
+	hasher.Write(payload)
+	var digest = hasher.Sum(nil)
+
+	var opts crypto.SignerOpts = hash
+	switch algorithm {
+	case jose.PS256, jose.PS384, jose.PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+
+	var signature, err = o.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKey, isECDSA := o.signer.Public().(*ecdsa.PublicKey); isECDSA {
+		return concatECDSASignature(signature, (publicKey.Curve.Params().BitSize+7)/8)
+	}
+	return signature, nil
+}
+
+// concatECDSASignature converts an ASN.1 encoded ECDSA signature to the fixed size R || S form used by JWS
+func concatECDSASignature(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	var signature = make([]byte, 2*size)
+	sig.R.FillBytes(signature[:size])
+	sig.S.FillBytes(signature[size:])
+	return signature, nil
+}
@@ -0,0 +1,71 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"io"
+	"testing"
+)
+
+// tokenSigner hides the private key like a PKCS#11 token does, ECDSA signatures are DER encoded
+type tokenSigner struct {
+	signer crypto.Signer
+}
+
+func (t tokenSigner) Public() crypto.PublicKey {
+	return t.signer.Public()
+}
+
+func (t tokenSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return t.signer.Sign(rand, digest, opts)
+}
+
+func TestOpaqueSigner(t *testing.T) {
+	var rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	var _, ed25519Key, _ = ed25519.GenerateKey(rand.Reader)
+	var p256Key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var p384Key, _ = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	var p521Key, _ = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+
+	for _, test := range []struct {
+		algorithm jose.SignatureAlgorithm
+		key       crypto.Signer
+	}{
+		{jose.RS256, rsaKey},
+		{jose.PS384, rsaKey},
+		{jose.EdDSA, ed25519Key},
+		{jose.ES256, p256Key},
+		{jose.ES384, p384Key},
+		{jose.ES512, p521Key},
+	} {
+		t.Run(string(test.algorithm), func(t *testing.T) {
+			var key = Key{KeyID: "sigkey", Algorithm: test.algorithm, PrivateKey: tokenSigner{test.key}}
+			var signer, err = key.Signer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := jwt.Signed(signer).Claims(map[string]any{"sub": "alice"}).CompactSerialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// go-jose only accepts ECDSA signatures in the R || S form
+			parsed, err := jwt.ParseSigned(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var claims map[string]any
+			if err := parsed.Claims(test.key.Public(), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != "alice" {
+				t.Errorf("sub = %v", claims["sub"])
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+//go:build cgo
+
+package keys
+
+import (
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"github.com/ThalesGroup/crypto11"
+)
+
+var ErrPKCS11KeyNotFound = errors.New("signing key not found in PKCS#11 token")
+
+// LoadPKCS11Key finds the key pair identified by label and/or hex encoded id in the token and returns a signer that
+// performs all private key operations inside the token.
+func LoadPKCS11Key(settings PKCS11Settings, pin string) (crypto.Signer, error) {
+	var config = &crypto11.Config{
+		Path:       settings.Module,
+		SlotNumber: settings.Slot,
+		TokenLabel: settings.TokenLabel,
+		Pin:        pin,
+	}
+	var context, err = crypto11.Configure(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var id, label []byte
+	if settings.KeyID != "" {
+		if id, err = hex.DecodeString(settings.KeyID); err != nil {
+			return nil, err
+		}
+	}
+	if settings.KeyLabel != "" {
+		label = []byte(settings.KeyLabel)
+	}
+
+	signer, err := context.FindKeyPair(id, label)
+	if err != nil {
+		return nil, err
+	} else if signer == nil {
+		return nil, ErrPKCS11KeyNotFound
+	}
+	return signer, nil
+}
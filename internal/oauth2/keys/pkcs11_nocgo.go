@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package keys
+
+import "crypto"
+
+func LoadPKCS11Key(settings PKCS11Settings, pin string) (crypto.Signer, error) {
+	return nil, ErrPKCS11Unsupported
+}
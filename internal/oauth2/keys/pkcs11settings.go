@@ -0,0 +1,16 @@
+package keys
+
+import "errors"
+
+var (
+	ErrPKCS11Unsupported = errors.New("PKCS#11 support requires a build with cgo enabled")
+)
+
+type PKCS11Settings struct {
+	Module     string `json:"module"`
+	Slot       *int   `json:"slot,omitempty"`
+	TokenLabel string `json:"token_label,omitempty"`
+	PIN        string `json:"pin"`
+	KeyLabel   string `json:"key_label,omitempty"`
+	KeyID      string `json:"key_id,omitempty"`
+}
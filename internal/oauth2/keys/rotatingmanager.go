@@ -0,0 +1,198 @@
+package keys
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/oklog/ulid/v2"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingManager keeps a current key for signing, publishes the next key before it becomes active and retains
+// previous keys for verification until the tokens signed with them have expired.
+type RotatingManager interface {
+	Manager
+	Rotate() error
+}
+
+type rotatingManager struct {
+	mu         sync.RWMutex
+	store      Store
+	algorithm  jose.SignatureAlgorithm
+	rsaKeySize int
+	interval   time.Duration
+	prepublish time.Duration
+	retention  time.Duration
+	keys       []Key
+	loadedAt   time.Time
+}
+
+const reloadInterval = 10 * time.Second
+
+func NewRotatingManager(store Store, algorithm jose.SignatureAlgorithm, rsaKeySize int, interval, prepublish, retention time.Duration) (RotatingManager, error) {
+	if prepublish > interval {
+		prepublish = interval
+	}
+	var m = &rotatingManager{
+		store:      store,
+		algorithm:  algorithm,
+		rsaKeySize: rsaKeySize,
+		interval:   interval,
+		prepublish: prepublish,
+		retention:  retention,
+	}
+	if err := m.Rotate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *rotatingManager) newKey(notBefore time.Time) (Key, error) {
+	var privateKey, err = keyset.GenerateSigningKey(m.algorithm, m.rsaKeySize)
+	if err != nil {
+		return Key{}, err
+	}
+	var notAfter = notBefore.Add(m.interval)
+	return Key{
+		KeyID:      strings.ToLower(ulid.MustNew(ulid.Timestamp(notBefore), rand.Reader).String()),
+		Algorithm:  m.algorithm,
+		PrivateKey: privateKey,
+		NotBefore:  notBefore,
+		NotAfter:   notAfter,
+		Expiry:     notAfter.Add(m.retention),
+	}, nil
+}
+
+// add stores a new key, losing a race against another instance adding a key for the same period is not an error
+func (m *rotatingManager) add(notBefore time.Time) error {
+	var key, err = m.newKey(notBefore)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Add(key); errors.Is(err, ErrKeyExists) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Signing key %s added, active from %s until %s", key.KeyID, key.NotBefore.Format(time.DateTime), key.NotAfter.Format(time.DateTime))
+	return nil
+}
+
+// Rotate removes expired keys, makes sure there is an active key and adds the next key once the current key is
+// about to be replaced.
+func (m *rotatingManager) Rotate() error {
+	var now = time.Now().Truncate(time.Second)
+
+	var keys, err = m.store.Load()
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	for _, key := range keys {
+		if key.isExpired(now) {
+			if err := m.store.Delete(key.KeyID); err != nil {
+				return err
+			}
+			log.Printf("Signing key %s expired", key.KeyID)
+			changed = true
+		}
+	}
+
+	var current *Key
+	if current, err = currentKey(keys, now); errors.Is(err, ErrNoActiveKey) || (err == nil && !current.isActive(now)) {
+		// periods are aligned to the interval so that instances sharing a store agree on the key to add
+		if err := m.add(now.Truncate(m.interval)); err != nil {
+			return err
+		}
+		changed = true
+	} else if err != nil {
+		return err
+	} else if !now.Before(current.NotAfter.Add(-m.prepublish)) {
+		var hasNext bool
+		for _, key := range keys {
+			if !key.NotBefore.Before(current.NotAfter) {
+				hasNext = true
+				break
+			}
+		}
+		if !hasNext {
+			if err := m.add(current.NotAfter); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	if changed {
+		if keys, err = m.store.Load(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	return nil
+}
+
+// reload refreshes the keys from the store when a token references an unknown key, which happens when another
+// instance has added a key since the last rotation. Reloads are limited to one per reloadInterval.
+func (m *rotatingManager) reload() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.loadedAt) < reloadInterval {
+		return false
+	}
+	m.loadedAt = time.Now()
+	if keys, err := m.store.Load(); err != nil {
+		log.Printf("!!! %s", err)
+		return false
+	} else {
+		m.keys = keys
+		return true
+	}
+}
+
+func (m *rotatingManager) Current() (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return currentKey(m.keys, time.Now())
+}
+
+func (m *rotatingManager) Lookup(keyID string) (*Key, error) {
+	if key, err := m.lookup(keyID); err == nil || !m.reload() {
+		return key, err
+	}
+	return m.lookup(keyID)
+}
+
+func (m *rotatingManager) lookup(keyID string) (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var now = time.Now()
+	for _, key := range m.keys {
+		if strings.EqualFold(key.KeyID, keyID) && !key.isExpired(now) {
+			return &key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (m *rotatingManager) Get() (map[string]any, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var now = time.Now()
+	var publicKeys = make(map[string]any, len(m.keys))
+	for _, key := range m.keys {
+		if !key.isExpired(now) {
+			publicKeys[key.KeyID] = key.Public()
+		}
+	}
+	return publicKeys, nil
+}
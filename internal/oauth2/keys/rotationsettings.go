@@ -0,0 +1,10 @@
+package keys
+
+type RotationSettings struct {
+	StateFile  string `json:"state_file,omitempty"`
+	Interval   int    `json:"interval,omitempty"`
+	Prepublish int    `json:"prepublish,omitempty"`
+	// Retention is the minimum time retired keys are kept, it is extended to the longest configured token lifetime
+	Retention  int `json:"retention,omitempty"`
+	RSAKeySize int `json:"rsa_key_size,omitempty"`
+}
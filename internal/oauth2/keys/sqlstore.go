@@ -0,0 +1,119 @@
+package keys
+
+import (
+	"database/sql"
+	"encoding/pem"
+	"github.com/blockloop/scan/v2"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
+	"log"
+	"time"
+)
+
+type sqlKey struct {
+	KeyID      string    `db:"kid"`
+	Algorithm  string    `db:"alg"`
+	PrivateKey string    `db:"private_key"`
+	NotBefore  time.Time `db:"not_before"`
+	NotAfter   time.Time `db:"not_after"`
+	Expiry     time.Time `db:"expiry"`
+}
+
+type sqlStore struct {
+	dbconn    *sql.DB
+	settings  *StoreSettings
+	masterKey *masterKey
+}
+
+// NewSqlStore creates a store that keeps the signing keys encrypted with the master key in a database shared by
+// all instances
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings, secret []byte) (Store, error) {
+	var masterKey, err = newMasterKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:    dbconn,
+			settings:  settings,
+			masterKey: masterKey,
+		}, nil
+	}
+}
+
+func (s *sqlStore) Load() ([]Key, error) {
+	var sqlKeys []sqlKey
+
+	log.Printf("SQL: %s", s.settings.Query)
+	// SELECT kid, alg, private_key, not_before, not_after, expiry FROM signing_keys
+	if rows, err := s.dbconn.Query(s.settings.Query); err == nil {
+		if err := scan.RowsStrict(&sqlKeys, rows); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("!!! Query for signing keys failed: %v", err)
+		return nil, err
+	}
+
+	var keys = make([]Key, 0, len(sqlKeys))
+	for _, sqlKey := range sqlKeys {
+		var pemBytes, err = s.masterKey.open(sqlKey.PrivateKey, sqlKey.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		var block, _ = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, ErrInvalidKeyState
+		}
+		privateKey, err := keyset.ParsePrivateKey(block, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, Key{
+			KeyID:      sqlKey.KeyID,
+			Algorithm:  jose.SignatureAlgorithm(sqlKey.Algorithm),
+			PrivateKey: privateKey,
+			NotBefore:  sqlKey.NotBefore,
+			NotAfter:   sqlKey.NotAfter,
+			Expiry:     sqlKey.Expiry,
+		})
+	}
+	return keys, nil
+}
+
+// Add relies on a unique constraint on not_before, when another instance has added a key for the same period
+// ErrKeyExists is returned.
+func (s *sqlStore) Add(key Key) error {
+	var pemBytes, err = keyset.EncodePrivateKeyPEM(key.PrivateKey, key.KeyID)
+	if err != nil {
+		return err
+	}
+	encryptedKey, err := s.masterKey.seal(pemBytes, key.KeyID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SQL: %s; -- %s, %s, ***, %v, %v, %v", s.settings.Insert, key.KeyID, key.Algorithm, key.NotBefore, key.NotAfter, key.Expiry)
+	// INSERT INTO signing_keys (kid, alg, private_key, not_before, not_after, expiry) VALUES ($1, $2, $3, $4, $5, $6)
+	if _, err := s.dbconn.Exec(s.settings.Insert, key.KeyID, string(key.Algorithm), encryptedKey, key.NotBefore, key.NotAfter, key.Expiry); err != nil {
+		if keys, loadErr := s.Load(); loadErr == nil {
+			for _, existingKey := range keys {
+				if existingKey.NotBefore.Equal(key.NotBefore) {
+					return ErrKeyExists
+				}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) Delete(keyID string) error {
+	log.Printf("SQL: %s; -- %s", s.settings.Delete, keyID)
+	// DELETE FROM signing_keys WHERE kid = $1
+	_, err := s.dbconn.Exec(s.settings.Delete, keyID)
+	return err
+}
@@ -0,0 +1,8 @@
+package keys
+
+type Store interface {
+	Load() ([]Key, error)
+	// Add stores a new key, it fails with ErrKeyExists if a key with the same NotBefore has been added concurrently
+	Add(key Key) error
+	Delete(keyID string) error
+}
@@ -0,0 +1,60 @@
+package oauth2
+
+import (
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/passkeys"
+	"github.com/cwkr/authd/internal/people"
+	"slices"
+)
+
+// MFAPolicy decides which users have to present a second factor in addition to their password, clients requesting
+// one of the ACR levels with acr_values make users step up to the methods of that level
+type MFAPolicy struct {
+	RequiredRoles []string
+	RoleMappings  RoleMappings
+	PasskeyStore  passkeys.Store
+	ACRLevels     ACRLevels
+}
+
+// Required reports whether the client or one of the roles of the user demands a second factor
+func (p MFAPolicy) Required(client clients.Client, user User) bool {
+	if client.RequireMFA {
+		return true
+	}
+	if len(p.RequiredRoles) == 0 {
+		return false
+	}
+	for _, role := range p.RoleMappings.Roles(user) {
+		if slices.Contains(p.RequiredRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecondFactorRequired reports whether the user has enrolled a second factor or the policy demands one
+func (p MFAPolicy) SecondFactorRequired(peopleStore people.Store, client clients.Client, userID string) (bool, error) {
+	if p.PasskeyStore != nil {
+		if credentials, err := p.PasskeyStore.List(userID); err != nil {
+			return false, err
+		} else if len(credentials) > 0 {
+			return true, nil
+		}
+	}
+	if otpStore, ok := peopleStore.(people.OTPStore); ok {
+		if _, err := otpStore.LookupOTP(userID); err == nil {
+			return true, nil
+		} else if !errors.Is(err, people.ErrOTPNotEnrolled) {
+			return false, err
+		}
+	}
+	if !client.RequireMFA && len(p.RequiredRoles) == 0 {
+		return false, nil
+	}
+	var person, err = peopleStore.Lookup(userID)
+	if err != nil {
+		return false, err
+	}
+	return p.Required(client, User{Person: *person, UserID: userID}), nil
+}
@@ -3,6 +3,9 @@ package oauth2
 import (
 	"encoding/json"
 	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2/keys"
+	"github.com/cwkr/authd/keyset"
+	"github.com/go-jose/go-jose/v3"
 	"log"
 	"net/http"
 	"strings"
@@ -20,17 +23,31 @@ type DiscoveryDocument struct {
 	UserinfoEndpoint                           string   `json:"userinfo_endpoint"`
 	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
 	ScopesSupported                            []string `json:"scopes_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
 	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
 	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
 	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
 	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
 	RevocationEndpoint                         string   `json:"revocation_endpoint"`
 	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+	ClaimsParameterSupported                   bool     `json:"claims_parameter_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	ACRValuesSupported                         []string `json:"acr_values_supported,omitempty"`
+	IDTokenEncryptionAlgValuesSupported        []string `json:"id_token_encryption_alg_values_supported"`
+	IDTokenEncryptionEncValuesSupported        []string `json:"id_token_encryption_enc_values_supported"`
+	UserinfoSigningAlgValuesSupported          []string `json:"userinfo_signing_alg_values_supported"`
+	UserinfoEncryptionAlgValuesSupported       []string `json:"userinfo_encryption_alg_values_supported"`
+	UserinfoEncryptionEncValuesSupported       []string `json:"userinfo_encryption_enc_values_supported"`
 }
 
 type discoveryDocumentHandler struct {
-	issuer string
-	scope  string
+	issuer     string
+	scope      string
+	keyManager keys.Manager
+	algorithm  jose.SignatureAlgorithm
+	acrLevels  ACRLevels
 }
 
 func (d *discoveryDocumentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -44,6 +61,13 @@ func (d *discoveryDocumentHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 
 	var baseURL = strings.TrimRight(d.issuer, "/")
+	var userinfoSigningAlgorithms = []string{string(d.algorithm)}
+	if key, err := d.keyManager.Current(); err == nil {
+		userinfoSigningAlgorithms = userinfoSigningAlgorithms[:0]
+		for _, alg := range keyset.SigningAlgorithms(key.Public()) {
+			userinfoSigningAlgorithms = append(userinfoSigningAlgorithms, string(alg))
+		}
+	}
 	var discoveryDocument = DiscoveryDocument{
 		Issuer:                 d.issuer,
 		AuthorizationEndpoint:  baseURL + "/authorize",
@@ -60,12 +84,27 @@ func (d *discoveryDocumentHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		UserinfoEndpoint:                           baseURL + "/userinfo",
 		EndSessionEndpoint:                         baseURL + "/logout",
 		ScopesSupported:                            strings.Fields(d.scope),
+		SubjectTypesSupported:                      []string{SubjectTypePublic, SubjectTypePairwise},
 		TokenEndpointAuthMethodsSupported:          []string{"client_secret_basic", "client_secret_post"},
 		TokenEndpointAuthSigningAlgValuesSupported: []string{"PS256", "RS256"},
 		CodeChallengeMethodsSupported:              []string{"S256"},
-		IDTokenSigningAlgValuesSupported:           []string{"PS256", "RS256"},
+		IDTokenSigningAlgValuesSupported:           []string{string(d.algorithm)},
 		RevocationEndpoint:                         baseURL + "/revoke",
 		RevocationEndpointAuthMethodsSupported:     []string{"client_secret_basic", "client_secret_post"},
+		IntrospectionEndpoint:                      baseURL + "/introspect",
+		IntrospectionEndpointAuthMethodsSupported:  []string{"client_secret_basic", "client_secret_post"},
+		ClaimsParameterSupported:                   true,
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce", "at_hash", "amr", "acr",
+			"given_name", "family_name", "birthdate", "email", "email_verified",
+			"phone_number", "phone_number_verified", "address",
+		},
+		ACRValuesSupported:                   d.acrLevels.Values(),
+		IDTokenEncryptionAlgValuesSupported:  KeyEncryptionAlgorithms,
+		IDTokenEncryptionEncValuesSupported:  ContentEncryptionAlgorithms,
+		UserinfoSigningAlgValuesSupported:    userinfoSigningAlgorithms,
+		UserinfoEncryptionAlgValuesSupported: KeyEncryptionAlgorithms,
+		UserinfoEncryptionEncValuesSupported: ContentEncryptionAlgorithms,
 	}
 	if bytes, err := json.Marshal(discoveryDocument); err != nil {
 		Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
@@ -75,9 +114,12 @@ func (d *discoveryDocumentHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-func DiscoveryDocumentHandler(issuer, scope string) http.Handler {
+func DiscoveryDocumentHandler(issuer, scope string, keyManager keys.Manager, algorithm jose.SignatureAlgorithm, acrLevels ACRLevels) http.Handler {
 	return &discoveryDocumentHandler{
-		issuer: issuer,
-		scope:  scope,
+		issuer:     issuer,
+		scope:      scope,
+		keyManager: keyManager,
+		algorithm:  algorithm,
+		acrLevels:  acrLevels,
 	}
 }
@@ -0,0 +1,7 @@
+package opaque
+
+import "errors"
+
+var (
+	ErrTokenNotFound = errors.New("reference token not found or expired")
+)
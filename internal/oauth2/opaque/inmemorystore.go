@@ -0,0 +1,57 @@
+package opaque
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+type referenceToken struct {
+	claims         map[string]any
+	expirationTime time.Time
+}
+
+type inMemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]referenceToken
+}
+
+func NewInMemoryStore() Store {
+	return &inMemoryStore{tokens: map[string]referenceToken{}}
+}
+
+func (s *inMemoryStore) purge(now time.Time) {
+	for tokenHash, token := range s.tokens {
+		if token.expirationTime.Before(now) {
+			delete(s.tokens, tokenHash)
+		}
+	}
+}
+
+func (s *inMemoryStore) Put(tokenHash string, claims map[string]any, expirationTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	s.tokens[tokenHash] = referenceToken{claims: maps.Clone(claims), expirationTime: expirationTime}
+	return nil
+}
+
+func (s *inMemoryStore) Lookup(tokenHash string) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, found := s.tokens[tokenHash]; found && token.expirationTime.After(time.Now()) {
+		return maps.Clone(token.claims), nil
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *inMemoryStore) Delete(tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, tokenHash)
+	return nil
+}
+
+func (s *inMemoryStore) Ping() error {
+	return nil
+}
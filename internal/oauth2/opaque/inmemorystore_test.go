@@ -0,0 +1,53 @@
+package opaque
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	var store = NewInMemoryStore()
+	var token, err = NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, opaque := range map[string]bool{token: true, "header.payload.signature": false, "": false} {
+		if IsOpaque(value) != opaque {
+			t.Errorf("IsOpaque(%q) = %v", value, !opaque)
+		}
+	}
+	if Hash(token) == token || Hash(token) != Hash(token) {
+		t.Errorf("Hash(%q) = %q", token, Hash(token))
+	}
+
+	var claims = map[string]any{"sub": "alice"}
+	if err := store.Put(Hash(token), claims, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("expired", claims, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// the store keeps copies of the claims
+	claims["sub"] = "bob"
+	stored, err := store.Lookup(Hash(token))
+	if err != nil || stored["sub"] != "alice" {
+		t.Fatalf("Lookup = %v, %v", stored, err)
+	}
+	stored["sub"] = "bob"
+	if stored, _ := store.Lookup(Hash(token)); stored["sub"] != "alice" {
+		t.Errorf("Lookup after change = %v", stored)
+	}
+
+	for _, tokenHash := range []string{"expired", "unknown", token} {
+		if _, err := store.Lookup(tokenHash); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("Lookup(%s) = %v", tokenHash, err)
+		}
+	}
+	if err := store.Delete(Hash(token)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(Hash(token)); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Lookup after Delete = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package opaque
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"log"
+	"time"
+)
+
+type sqlStore struct {
+	dbconn   *sql.DB
+	settings *StoreSettings
+}
+
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:   dbconn,
+			settings: settings,
+		}, nil
+	}
+}
+
+func (s *sqlStore) Put(tokenHash string, claims map[string]any, expirationTime time.Time) error {
+	var claimsBytes, err = json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	log.Printf("SQL: %s; -- %s, %s, %v", s.settings.Insert, tokenHash, claimsBytes, expirationTime)
+	// INSERT INTO reference_tokens (token_hash, claims, exp) VALUES ($1, $2, $3)
+	_, err = s.dbconn.Exec(s.settings.Insert, tokenHash, string(claimsBytes), expirationTime)
+	return err
+}
+
+func (s *sqlStore) Lookup(tokenHash string) (map[string]any, error) {
+	var claimsJSON string
+
+	log.Printf("SQL: %s; -- %s", s.settings.Query, tokenHash)
+	// SELECT claims FROM reference_tokens WHERE token_hash = $1 AND exp >= current_timestamp
+	if err := s.dbconn.QueryRow(s.settings.Query, tokenHash).Scan(&claimsJSON); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTokenNotFound
+		}
+		log.Printf("!!! Query for reference token failed: %v", err)
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(claimsJSON), &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *sqlStore) Delete(tokenHash string) error {
+	log.Printf("SQL: %s; -- %s", s.settings.Delete, tokenHash)
+	// DELETE FROM reference_tokens WHERE token_hash = $1
+	_, err := s.dbconn.Exec(s.settings.Delete, tokenHash)
+	return err
+}
+
+func (s *sqlStore) Ping() error {
+	return s.dbconn.Ping()
+}
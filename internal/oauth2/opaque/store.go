@@ -0,0 +1,36 @@
+package opaque
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+type Store interface {
+	Put(tokenHash string, claims map[string]any, expirationTime time.Time) error
+	Lookup(tokenHash string) (map[string]any, error)
+	Delete(tokenHash string) error
+	Ping() error
+}
+
+// NewToken returns a random reference token
+func NewToken() (string, error) {
+	var bytes = make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Hash returns the key a reference token is stored with, the token itself is never stored
+func Hash(token string) string {
+	var hash = sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// IsOpaque reports whether the token is a reference token rather than a JWT
+func IsOpaque(token string) bool {
+	return token != "" && !strings.Contains(token, ".")
+}
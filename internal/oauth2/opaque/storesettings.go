@@ -0,0 +1,8 @@
+package opaque
+
+type StoreSettings struct {
+	URI    string `json:"uri,omitempty"`
+	Query  string `json:"query,omitempty"`
+	Insert string `json:"insert,omitempty"`
+	Delete string `json:"delete,omitempty"`
+}
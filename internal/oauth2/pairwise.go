@@ -0,0 +1,87 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/subjects"
+	"strings"
+)
+
+const (
+	SubjectTypePublic   = "public"
+	SubjectTypePairwise = "pairwise"
+)
+
+var ErrPairwiseNotConfigured = errors.New("pairwise subjects require pairwise_salt and pairwise_subject_store")
+
+// SubjectMapper translates internal user ids to the subject identifiers a client receives and back
+type SubjectMapper interface {
+	Subject(client clients.Client, userID string) (string, error)
+	UserID(client clients.Client, subject string) (string, error)
+	Validate(client clients.Client) error
+}
+
+type subjectMapper struct {
+	salt  string
+	store subjects.Store
+}
+
+// NewSubjectMapper returns a mapper for pairwise subjects, without salt or store pairwise clients are refused because
+// their subjects would change with every restart
+func NewSubjectMapper(salt string, store subjects.Store) SubjectMapper {
+	return &subjectMapper{
+		salt:  salt,
+		store: store,
+	}
+}
+
+// SectorIdentifier returns the sector a pairwise subject is computed for, clients sharing a sector share subjects.
+func SectorIdentifier(client clients.Client) string {
+	if client.SectorIdentifier != "" {
+		return client.SectorIdentifier
+	}
+	return strings.ToLower(client.ClientID)
+}
+
+// Validate fails for pairwise clients when pairwise subjects are not configured, clients loaded from a database are
+// only checked when they are used
+func (s *subjectMapper) Validate(client clients.Client) error {
+	if strings.EqualFold(client.SubjectType, SubjectTypePairwise) && (s.salt == "" || s.store == nil) {
+		return ErrPairwiseNotConfigured
+	}
+	return nil
+}
+
+func (s *subjectMapper) Subject(client clients.Client, userID string) (string, error) {
+	if !strings.EqualFold(client.SubjectType, SubjectTypePairwise) || userID == "" {
+		return userID, nil
+	}
+	if err := s.Validate(client); err != nil {
+		return "", err
+	}
+	var sectorID = SectorIdentifier(client)
+	var hash = sha256.Sum256([]byte(sectorID + "|" + strings.ToLower(userID) + "|" + s.salt))
+	var subject = base64.RawURLEncoding.EncodeToString(hash[:])
+	// the mapping never changes, it is only written on the first issuance for the sector
+	if _, err := s.store.Lookup(sectorID, subject); err == nil {
+		return subject, nil
+	} else if !errors.Is(err, subjects.ErrSubjectNotFound) {
+		return "", err
+	}
+	if err := s.store.Put(sectorID, subject, userID); err != nil {
+		return "", err
+	}
+	return subject, nil
+}
+
+func (s *subjectMapper) UserID(client clients.Client, subject string) (string, error) {
+	if !strings.EqualFold(client.SubjectType, SubjectTypePairwise) || subject == "" {
+		return subject, nil
+	}
+	if err := s.Validate(client); err != nil {
+		return "", err
+	}
+	return s.store.Lookup(SectorIdentifier(client), subject)
+}
@@ -0,0 +1,77 @@
+package oauth2
+
+import (
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/subjects"
+	"net/url"
+	"testing"
+)
+
+// countingSubjectStore keeps pairwise subjects in a map and counts the writes
+type countingSubjectStore struct {
+	userIDs map[string]string
+	puts    int
+}
+
+func (c *countingSubjectStore) Put(sectorID, subject, userID string) error {
+	c.puts++
+	c.userIDs[sectorID+"|"+subject] = userID
+	return nil
+}
+
+func (c *countingSubjectStore) Lookup(sectorID, subject string) (string, error) {
+	if userID, found := c.userIDs[sectorID+"|"+subject]; found {
+		return userID, nil
+	}
+	return "", subjects.ErrSubjectNotFound
+}
+
+func (c *countingSubjectStore) Ping() error {
+	return nil
+}
+
+func TestSubjectMapperWritesOnce(t *testing.T) {
+	var store = &countingSubjectStore{userIDs: map[string]string{}}
+	var mapper = NewSubjectMapper("salt", store)
+	var client = clients.Client{ClientID: "app", SubjectType: SubjectTypePairwise}
+
+	var subject, err = mapper.Subject(client, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if again, err := mapper.Subject(client, "alice"); err != nil || again != subject {
+			t.Fatalf("Subject = %q, %v, want %q", again, err, subject)
+		}
+	}
+	if store.puts != 1 {
+		t.Errorf("store written %d times, want once", store.puts)
+	}
+	if userID, err := mapper.UserID(client, subject); err != nil || userID != "alice" {
+		t.Errorf("UserID = %q, %v", userID, err)
+	}
+	if other, _ := mapper.Subject(clients.Client{ClientID: "other", SubjectType: SubjectTypePairwise}, "alice"); other == subject {
+		t.Error("clients of different sectors share the subject")
+	}
+}
+
+func TestPairwiseClientWithoutSalt(t *testing.T) {
+	var mapper = NewSubjectMapper("", nil)
+	if err := mapper.Validate(clients.Client{SubjectType: SubjectTypePairwise}); !errors.Is(err, ErrPairwiseNotConfigured) {
+		t.Errorf("Validate = %v", err)
+	}
+	if err := mapper.Validate(clients.Client{}); err != nil {
+		t.Errorf("Validate public client = %v", err)
+	}
+
+	// clients from a client store are refused before anything is issued
+	var o = newOAuth2Test(t)
+	o.clientStore = clients.NewInMemoryClientStore(map[string]clients.Client{
+		"pairwise": {SecretHash: "secret", SubjectType: SubjectTypePairwise},
+	})
+	var status, response = o.token("pairwise", url.Values{"grant_type": {GrantTypeClientCredentials}})
+	if response["error"] != ErrorUnauthorizedClient || response["error_description"] != ErrPairwiseNotConfigured.Error() {
+		t.Errorf("token: %d %v", status, response)
+	}
+}
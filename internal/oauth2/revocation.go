@@ -0,0 +1,63 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"strings"
+	"time"
+)
+
+// RevokeTokens revokes all tokens of a user, of a client or of a user and client issued until revokedBefore
+func RevokeTokens(trlStore trl.Store, userID, clientID string, revokedBefore time.Time) error {
+	return trlStore.PutCutoff(cutoffID(userID), cutoffID(clientID), revokedBefore)
+}
+
+// IsRevoked reports whether a token has been revoked by its id or by a cutoff for its user and client
+func IsRevoked(trlStore trl.Store, tokenID, userID, clientID string, issuedAt time.Time) (bool, error) {
+	if tokenID != "" {
+		if revokedToken, err := trlStore.Lookup(tokenID); err != nil {
+			return false, err
+		} else if revokedToken != nil {
+			return true, nil
+		}
+	}
+	var revokedBefore, err = trlStore.LookupCutoff(cutoffID(userID), cutoffID(clientID))
+	if err != nil {
+		return false, err
+	}
+	// iat has a precision of seconds, tokens issued within the second of the cutoff are revoked as well
+	return !revokedBefore.IsZero() && !issuedAt.After(revokedBefore), nil
+}
+
+// IsSessionRevoked reports whether the tokens of the user have been revoked for all clients after the session started,
+// e.g. by a password reset. Cutoffs for single clients do not end sessions.
+func IsSessionRevoked(trlStore trl.Store, userID string, authTime time.Time) (bool, error) {
+	var revokedBefore, err = trlStore.LookupCutoff(cutoffID(userID), trl.AnyID)
+	if err != nil {
+		return false, err
+	}
+	// the session time is precise, sessions started right after the cutoff remain active
+	return authTime.Before(revokedBefore), nil
+}
+
+func cutoffID(id string) string {
+	if id = strings.ToLower(strings.TrimSpace(id)); id == "" {
+		return trl.AnyID
+	}
+	return id
+}
+
+// NumericDate converts a numeric date claim as decoded from JSON or created by the token creator
+func NumericDate(value any) time.Time {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0)
+	case int64:
+		return time.Unix(v, 0)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return time.Unix(i, 0)
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,39 @@
+package oauth2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsSessionRevoked(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var now = time.Now()
+
+	// revoking the tokens of a client leaves the sessions of its users alone
+	if err := RevokeTokens(o.trlStore, "", "app", now); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := IsSessionRevoked(o.trlStore, "alice", now.Add(-time.Minute)); err != nil || revoked {
+		t.Errorf("session revoked by client cutoff: %v, %v", revoked, err)
+	}
+
+	if err := RevokeTokens(o.trlStore, "Alice", "", now); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		authTime time.Time
+		revoked  bool
+	}{
+		{now.Add(-time.Minute), true},
+		{now.Add(-time.Millisecond), true},
+		{now, false},
+		{now.Add(time.Millisecond), false},
+	} {
+		if revoked, err := IsSessionRevoked(o.trlStore, "alice", tt.authTime); err != nil || revoked != tt.revoked {
+			t.Errorf("IsSessionRevoked(%v) = %v, %v", tt.authTime.Sub(now), revoked, err)
+		}
+	}
+	if revoked, err := IsSessionRevoked(o.trlStore, "bob", now.Add(-time.Minute)); err != nil || revoked {
+		t.Errorf("session of another user revoked: %v, %v", revoked, err)
+	}
+}
@@ -1,8 +1,11 @@
 package oauth2
 
 import (
+	"errors"
 	"github.com/cwkr/authd/internal/httputil"
 	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/families"
+	"github.com/cwkr/authd/internal/oauth2/opaque"
 	"github.com/cwkr/authd/internal/oauth2/trl"
 	"github.com/cwkr/authd/internal/stringutil"
 	"log"
@@ -15,6 +18,8 @@ type revokeHandler struct {
 	tokenCreator TokenCreator
 	trlStore     trl.Store
 	clientStore  clients.Store
+	familyStore  families.Store
+	opaqueStore  opaque.Store
 }
 
 func (j *revokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -43,16 +48,24 @@ func (j *revokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("client_id=%q client_secret=%q token_type_hint=%q token=%q",
 		clientID, strings.Repeat("*", utf8.RuneCountInString(clientSecret)), tokenTypeHint, token)
 
+	var (
+		client *clients.Client
+		err    error
+	)
 	if clientSecret != "" {
-		if _, err := j.clientStore.Authenticate(clientID, clientSecret); err != nil {
+		if client, err = j.clientStore.Authenticate(clientID, clientSecret); err != nil {
 			Error(w, ErrorUnauthorizedClient, err.Error(), http.StatusUnauthorized)
 			return
 		}
 	} else {
-		if _, err := j.clientStore.Lookup(clientID); err != nil {
+		if client, err = j.clientStore.Lookup(clientID); err != nil {
 			Error(w, ErrorUnauthorizedClient, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		if client.SecretHash != "" {
+			Error(w, ErrorUnauthorizedClient, "client_secret parameter is required for confidential clients", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	if stringutil.IsAnyEmpty(clientID, token) {
@@ -60,7 +73,43 @@ func (j *revokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claims, err := j.tokenCreator.Verify(token, ""); err == nil {
+	if opaque.IsOpaque(token) {
+		// reference tokens are revoked by removing them from the token store
+		if claims, err := j.opaqueStore.Lookup(opaque.Hash(token)); err == nil {
+			if tokenClientID, _ := claims[ClaimClientID].(string); !strings.EqualFold(tokenClientID, clientID) {
+				Error(w, ErrorUnauthorizedClient, "token was issued to another client", http.StatusBadRequest)
+				return
+			}
+			if err := j.opaqueStore.Delete(opaque.Hash(token)); err != nil {
+				log.Printf("!!! %s", err)
+				Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if errors.Is(err, opaque.ErrTokenNotFound) {
+			log.Printf("!!! Token already invalid: %s", err)
+		} else {
+			log.Printf("!!! %s", err)
+			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if claims, err := j.tokenCreator.Verify(token, ""); err == nil {
+		// access tokens carry no typ claim
+		var tokenType = claims.Type
+		if tokenType == "" {
+			tokenType = TokenTypeAccessToken
+		}
+		// the hint does not restrict the search for the token and unknown hints are ignored as per RFC 7009
+		if tokenTypeHint != "" && tokenTypeHint != tokenType {
+			log.Printf("token_type_hint %q does not match token type %q", tokenTypeHint, tokenType)
+		}
+		if tokenType != TokenTypeAccessToken && tokenType != TokenTypeRefreshToken {
+			Error(w, ErrorUnsupportedTokenType, "only token types 'access_token' and 'refresh_token' can be revoked", http.StatusBadRequest)
+			return
+		}
+		if !strings.EqualFold(claims.ClientID, clientID) {
+			Error(w, ErrorUnauthorizedClient, "token was issued to another client", http.StatusBadRequest)
+			return
+		}
 		if claims.TokenID == "" {
 			Error(w, ErrorInvalidRequest, "token without id (jti)", http.StatusInternalServerError)
 			return
@@ -70,6 +119,13 @@ func (j *revokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if tokenType == TokenTypeRefreshToken && claims.FamilyID != "" {
+			if err := j.familyStore.Revoke(claims.FamilyID); err != nil {
+				log.Printf("!!! %s", err)
+				Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
 	} else {
 		log.Printf("!!! Token already invalid: %s", err)
 	}
@@ -77,10 +133,12 @@ func (j *revokeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func RevokeHandler(tokenCreator TokenCreator, clientStore clients.Store, trlStore trl.Store) http.Handler {
+func RevokeHandler(tokenCreator TokenCreator, clientStore clients.Store, trlStore trl.Store, familyStore families.Store, opaqueStore opaque.Store) http.Handler {
 	return &revokeHandler{
 		tokenCreator: tokenCreator,
 		clientStore:  clientStore,
 		trlStore:     trlStore,
+		familyStore:  familyStore,
+		opaqueStore:  opaqueStore,
 	}
 }
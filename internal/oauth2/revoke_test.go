@@ -0,0 +1,190 @@
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/families"
+	"github.com/cwkr/authd/internal/oauth2/keys"
+	"github.com/cwkr/authd/internal/oauth2/opaque"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/go-jose/go-jose/v3"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "http://localhost:6080"
+
+// oauth2Test wires the token endpoints with in-memory stores, a bolt TRL and a static signing key
+type oauth2Test struct {
+	t            *testing.T
+	tokenCreator TokenCreator
+	clientStore  clients.Store
+	trlStore     trl.Store
+	familyStore  families.Store
+	opaqueStore  opaque.Store
+}
+
+func newOAuth2Test(t *testing.T) *oauth2Test {
+	var privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyManager = keys.NewStaticManager(keys.Key{KeyID: "sigkey", Algorithm: jose.ES256, PrivateKey: privateKey})
+	trlStore, err := trl.NewBoltStore(filepath.Join(t.TempDir(), "trl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opaqueStore = opaque.NewInMemoryStore()
+	tokenCreator, err := NewTokenCreator(keyManager, testIssuer, "openid profile email offline_access", 300, 3600, 300,
+		nil, nil, nil, nil, nil, NewSubjectMapper("", nil), opaqueStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &oauth2Test{
+		t:            t,
+		tokenCreator: tokenCreator,
+		clientStore: clients.NewInMemoryClientStore(map[string]clients.Client{
+			"app":   {SecretHash: "secret", EnableRefreshTokenRotation: true},
+			"other": {SecretHash: "secret"},
+			"reference": {SecretHash: "secret", AccessTokenFormat: AccessTokenFormatOpaque, AccessTokenExtraClaims: map[string]string{
+				"department": "$department",
+				"groups":     "$groups",
+			}},
+			"resource-server": {SecretHash: "secret"},
+		}),
+		trlStore:    trlStore,
+		familyStore: families.NewInMemoryStore(),
+		opaqueStore: opaqueStore,
+	}
+}
+
+func (o *oauth2Test) client(clientID string) clients.Client {
+	var client, err = o.clientStore.Lookup(clientID)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return *client
+}
+
+func (o *oauth2Test) accessToken(clientID, userID string) string {
+	var user = User{UserID: userID, Person: people.Person{Department: "Sales", Groups: []string{"staff"}}}
+	var token, err = o.tokenCreator.GenerateAccessToken(user, "", o.client(clientID), "openid", nil, nil)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return token
+}
+
+// post sends a form authenticated as client with the secret "secret" and decodes a JSON response
+func (o *oauth2Test) post(handler http.Handler, clientID string, form url.Values) (int, map[string]any) {
+	var r = httptest.NewRequest(http.MethodPost, testIssuer, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, "secret")
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	var response map[string]any
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			o.t.Fatalf("%d %s: %v", w.Code, w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+func (o *oauth2Test) revoke(clientID, token, tokenTypeHint string) (int, map[string]any) {
+	var handler = RevokeHandler(o.tokenCreator, o.clientStore, o.trlStore, o.familyStore, o.opaqueStore)
+	return o.post(handler, clientID, url.Values{"token": {token}, "token_type_hint": {tokenTypeHint}})
+}
+
+func (o *oauth2Test) isRevoked(token string) bool {
+	var claims, err = o.tokenCreator.Verify(token, "")
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	revoked, err := IsRevoked(o.trlStore, claims.TokenID, "", "", time.Time{})
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return revoked
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	var o = newOAuth2Test(t)
+
+	for _, tokenTypeHint := range []string{"", TokenTypeAccessToken, TokenTypeRefreshToken, "id_token"} {
+		var token = o.accessToken("app", "alice")
+		if status, response := o.revoke("app", token, tokenTypeHint); status != http.StatusNoContent {
+			t.Fatalf("revoke with hint %q: %d %v", tokenTypeHint, status, response)
+		}
+		if !o.isRevoked(token) {
+			t.Errorf("access token revoked with hint %q is not in the TRL", tokenTypeHint)
+		}
+	}
+}
+
+func TestRevokeRefreshTokenRevokesFamily(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var expiry = time.Now().Add(time.Hour)
+	var token, tokenID, err = o.tokenCreator.GenerateRefreshToken("alice", o.client("app"), "openid offline_access", "", "family", time.Now(), expiry, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.familyStore.Create(families.Family{FamilyID: "family", UserID: "alice", ClientID: "app", TokenID: tokenID, ExpirationTime: expiry}); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, response := o.revoke("app", token, "unknown_hint"); status != http.StatusNoContent {
+		t.Fatalf("revoke: %d %v", status, response)
+	}
+	if !o.isRevoked(token) {
+		t.Error("refresh token is not in the TRL")
+	}
+	if family, err := o.familyStore.Lookup("family"); err != nil || !family.Revoked {
+		t.Errorf("family = %+v, %v", family, err)
+	}
+}
+
+func TestRevokeReferenceToken(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var token = o.accessToken("reference", "alice")
+
+	if status, response := o.revoke("app", token, ""); status != http.StatusBadRequest || response["error"] != ErrorUnauthorizedClient {
+		t.Errorf("revoke by another client: %d %v", status, response)
+	}
+	if status, response := o.revoke("reference", token, ""); status != http.StatusNoContent {
+		t.Fatalf("revoke: %d %v", status, response)
+	}
+	if _, err := o.opaqueStore.Lookup(opaque.Hash(token)); err == nil {
+		t.Error("reference token still stored")
+	}
+}
+
+func TestRevokeRejectsOtherTokens(t *testing.T) {
+	var o = newOAuth2Test(t)
+
+	if status, response := o.revoke("other", o.accessToken("app", "alice"), ""); status != http.StatusBadRequest || response["error"] != ErrorUnauthorizedClient {
+		t.Errorf("revoke token of another client: %d %v", status, response)
+	}
+
+	var code, err = o.tokenCreator.GenerateAuthCode("alice", o.client("app"), "openid", "", "", time.Now(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, response := o.revoke("app", code, ""); status != http.StatusBadRequest || response["error"] != ErrorUnsupportedTokenType {
+		t.Errorf("revoke authorization code: %d %v", status, response)
+	}
+
+	// invalid tokens are no error as per RFC 7009
+	if status, response := o.revoke("app", "invalid.token.value", ""); status != http.StatusNoContent {
+		t.Errorf("revoke invalid token: %d %v", status, response)
+	}
+}
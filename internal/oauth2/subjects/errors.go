@@ -0,0 +1,7 @@
+package subjects
+
+import "errors"
+
+var (
+	ErrSubjectNotFound = errors.New("pairwise subject not found")
+)
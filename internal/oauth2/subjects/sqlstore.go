@@ -0,0 +1,56 @@
+package subjects
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"log"
+)
+
+type sqlStore struct {
+	dbconn   *sql.DB
+	settings *StoreSettings
+}
+
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:   dbconn,
+			settings: settings,
+		}, nil
+	}
+}
+
+func (s *sqlStore) Put(sectorID, subject, userID string) error {
+	log.Printf("SQL: %s; -- %s, %s, %s", s.settings.Insert, sectorID, subject, userID)
+	// INSERT INTO pairwise_subjects (sector_id, sub, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING
+	if _, err := s.dbconn.Exec(s.settings.Insert, sectorID, subject, userID); err != nil {
+		// a concurrent login of the same user may have inserted the subject in the meantime
+		if _, lookupErr := s.Lookup(sectorID, subject); lookupErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) Lookup(sectorID, subject string) (string, error) {
+	var userID string
+
+	log.Printf("SQL: %s; -- %s, %s", s.settings.Query, sectorID, subject)
+	// SELECT user_id FROM pairwise_subjects WHERE sector_id = $1 AND sub = $2
+	if err := s.dbconn.QueryRow(s.settings.Query, sectorID, subject).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrSubjectNotFound
+		}
+		log.Printf("!!! Query for pairwise subject failed: %v", err)
+		return "", err
+	}
+	return userID, nil
+}
+
+func (s *sqlStore) Ping() error {
+	return s.dbconn.Ping()
+}
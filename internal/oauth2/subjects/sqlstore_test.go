@@ -0,0 +1,137 @@
+package subjects
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeDatabase keeps pairwise subjects for the statements "query" and "insert", inserts fail with insertErr after
+// storing the subject to mimic a concurrent insert
+type fakeDatabase struct {
+	mu        sync.Mutex
+	userIDs   map[[2]string]string
+	insertErr error
+}
+
+func (f *fakeDatabase) Open(string) (driver.Conn, error) {
+	return f, nil
+}
+
+func (f *fakeDatabase) Connect(context.Context) (driver.Conn, error) {
+	return f, nil
+}
+
+func (f *fakeDatabase) Driver() driver.Driver {
+	return f
+}
+
+func (f *fakeDatabase) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{f, query}, nil
+}
+
+func (f *fakeDatabase) Close() error {
+	return nil
+}
+
+func (f *fakeDatabase) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeStmt struct {
+	database *fakeDatabase
+	query    string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.database.mu.Lock()
+	defer s.database.mu.Unlock()
+	if s.query != "insert" {
+		return nil, errors.New("unexpected statement " + s.query)
+	}
+	if s.database.insertErr == nil || errors.Is(s.database.insertErr, errConflict) {
+		s.database.userIDs[[2]string{args[0].(string), args[1].(string)}] = args[2].(string)
+	}
+	return driver.RowsAffected(1), s.database.insertErr
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.database.mu.Lock()
+	defer s.database.mu.Unlock()
+	if s.query != "query" {
+		return nil, errors.New("unexpected query " + s.query)
+	}
+	var rows = &fakeRows{}
+	if userID, found := s.database.userIDs[[2]string{args[0].(string), args[1].(string)}]; found {
+		rows.values = append(rows.values, userID)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values []driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"user_id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+var errConflict = errors.New("duplicate key value violates unique constraint")
+
+func TestSqlStore(t *testing.T) {
+	var database = &fakeDatabase{userIDs: map[[2]string]string{}}
+	var db = sql.OpenDB(database)
+	t.Cleanup(func() { db.Close() })
+	var settings = StoreSettings{URI: "postgresql://fake", Query: "query", Insert: "insert"}
+	var store, err = NewSqlStore(map[string]*sql.DB{settings.URI: db}, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Lookup("example.com", "subject"); !errors.Is(err, ErrSubjectNotFound) {
+		t.Errorf("Lookup before Put = %v", err)
+	}
+	if err := store.Put("example.com", "subject", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := store.Lookup("example.com", "subject"); err != nil || userID != "alice" {
+		t.Errorf("Lookup = %q, %v", userID, err)
+	}
+	if _, err := store.Lookup("other.com", "subject"); !errors.Is(err, ErrSubjectNotFound) {
+		t.Errorf("Lookup in other sector = %v", err)
+	}
+
+	// the subject inserted by a concurrent login is no error
+	database.insertErr = errConflict
+	if err := store.Put("example.com", "concurrent", "bob"); err != nil {
+		t.Errorf("Put after concurrent insert = %v", err)
+	}
+	database.insertErr = errors.New("database down")
+	if err := store.Put("example.com", "failed", "carol"); err == nil {
+		t.Error("failed insert reported no error")
+	}
+}
@@ -0,0 +1,7 @@
+package subjects
+
+type Store interface {
+	Put(sectorID, subject, userID string) error
+	Lookup(sectorID, subject string) (string, error)
+	Ping() error
+}
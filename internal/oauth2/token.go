@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
 	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/families"
 	"github.com/cwkr/authd/internal/oauth2/pkce"
 	"github.com/cwkr/authd/internal/oauth2/trl"
 	"github.com/cwkr/authd/internal/people"
@@ -15,6 +17,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -23,9 +26,103 @@ type tokenHandler struct {
 	peopleStore  people.Store
 	clientStore  clients.Store
 	trlStore     trl.Store
+	familyStore  families.Store
+	mfaPolicy    MFAPolicy
+	lockoutGuard *lockout.Guard
 	scope        string
 }
 
+// refreshTokenExpiry returns the expiry of a refresh token issued now. The idle lifetime slides with every refresh,
+// but never beyond the absolute lifetime and the offline session lifetime counted from the original authentication
+// time, the earlier deadline applies when both are configured.
+func (t *tokenHandler) refreshTokenExpiry(client clients.Client, scope string, authTime, now time.Time) time.Time {
+	var idleTTL = t.tokenService.RefreshTokenTTL()
+	if client.RefreshTokenTTL > 0 {
+		idleTTL = int64(client.RefreshTokenTTL)
+	}
+	var expiry = now.Add(time.Duration(idleTTL) * time.Second)
+	var maxTTLs = []int{client.RefreshTokenMaxTTL}
+	if strings.Contains(scope, "offline_access") {
+		maxTTLs = append(maxTTLs, client.OfflineSessionTTL)
+	}
+	for _, maxTTL := range maxTTLs {
+		if maxTTL <= 0 {
+			continue
+		}
+		if deadline := authTime.Add(time.Duration(maxTTL) * time.Second); deadline.Before(expiry) {
+			expiry = deadline
+		}
+	}
+	return expiry
+}
+
+// issueRefreshToken generates a refresh token and records it as the current token of its family. A new family is
+// started when familyID is empty, otherwise the family is rotated away from the token identified by oldTokenID.
+func (t *tokenHandler) issueRefreshToken(client clients.Client, userID, scope, nonce, familyID, oldTokenID string, authTime time.Time, claimsRequest *ClaimsRequest, authMethods []string) (string, error) {
+	var now = time.Now()
+	var expirationTime = t.refreshTokenExpiry(client, scope, authTime, now)
+	if !expirationTime.After(now) {
+		return "", ErrRefreshTokenLifetimeExceeded
+	}
+	if familyID == "" {
+		familyID = NewTokenID(now)
+		var refreshToken, tokenID, err = t.tokenService.GenerateRefreshToken(userID, client, scope, nonce, familyID, authTime, expirationTime, claimsRequest, authMethods)
+		if err != nil {
+			return "", err
+		}
+		return refreshToken, t.familyStore.Create(families.Family{
+			FamilyID:       familyID,
+			UserID:         userID,
+			ClientID:       client.ClientID,
+			TokenID:        tokenID,
+			ExpirationTime: expirationTime,
+		})
+	}
+	var refreshToken, tokenID, err = t.tokenService.GenerateRefreshToken(userID, client, scope, nonce, familyID, authTime, expirationTime, claimsRequest, authMethods)
+	if err != nil {
+		return "", err
+	}
+	if err := t.familyStore.Rotate(familyID, oldTokenID, tokenID, expirationTime); err != nil {
+		if errors.Is(err, families.ErrTokenReused) {
+			log.Printf("!!! Refresh token %s of family %s reused, revoking family", oldTokenID, familyID)
+			_ = t.familyStore.Revoke(familyID)
+		}
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// verifyFamily checks that the refresh token is the current token of a family that has not been revoked. Presenting
+// a token that has already been rotated revokes the entire family. Unknown families (e.g. after a restart with the
+// in-memory store) are registered again with the presented token as their current token: a rotated token is still
+// rejected by the TRL, and the family is revoked once the newer token of the family is presented.
+func (t *tokenHandler) verifyFamily(refreshClaims *VerifiedClaims) error {
+	var family, err = t.familyStore.Lookup(refreshClaims.FamilyID)
+	if errors.Is(err, families.ErrFamilyNotFound) {
+		log.Printf("!!! Refresh token family %s unknown, registering it with token %s", refreshClaims.FamilyID, refreshClaims.TokenID)
+		return t.familyStore.Create(families.Family{
+			FamilyID:       refreshClaims.FamilyID,
+			UserID:         refreshClaims.UserID,
+			ClientID:       refreshClaims.ClientID,
+			TokenID:        refreshClaims.TokenID,
+			ExpirationTime: refreshClaims.Expiry.Time(),
+		})
+	} else if err != nil {
+		return err
+	}
+	if family.Revoked {
+		return families.ErrFamilyRevoked
+	}
+	if family.TokenID != refreshClaims.TokenID {
+		log.Printf("!!! Refresh token %s of family %s reused, revoking family", refreshClaims.TokenID, refreshClaims.FamilyID)
+		if err := t.familyStore.Revoke(refreshClaims.FamilyID); err != nil {
+			log.Printf("!!! %s", err)
+		}
+		return families.ErrTokenReused
+	}
+	return nil
+}
+
 func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL)
 
@@ -73,6 +170,16 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if !client.AllowsGrantType(grantType) {
+		Error(w, ErrorUnauthorizedClient, fmt.Sprintf("grant type '%s' is not allowed for this client", grantType), http.StatusBadRequest)
+		return
+	}
+	if err := t.tokenService.ValidateClient(client); err != nil {
+		log.Printf("!!! client %s: %s", clientID, err)
+		Error(w, ErrorUnauthorizedClient, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	switch grantType {
 	case GrantTypePassword:
 		var (
@@ -89,12 +196,33 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var err error
-		userID, err = t.peopleStore.Authenticate(userID, password)
+		var addr = httputil.RemoteAddr(r)
+		if retryAfter, err := t.lockoutGuard.Reserve(userID, addr); errors.Is(err, lockout.ErrTooManyFailures) {
+			w.Header().Set("Retry-After", fmt.Sprint(int64(retryAfter.Seconds()+1)))
+			Error(w, ErrorInvalidGrant, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var realUserID, err = t.peopleStore.Authenticate(userID, password)
 		if err != nil {
 			Error(w, ErrorInvalidGrant, "invalid username and password combination", http.StatusBadRequest)
 			return
 		}
+		if err := t.lockoutGuard.Succeeded(userID, addr); err != nil {
+			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		userID = realUserID
+		// the password grant has no way to ask for a one-time password
+		if required, err := t.mfaPolicy.SecondFactorRequired(t.peopleStore, client, userID); err != nil {
+			Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		} else if required {
+			Error(w, ErrorInvalidGrant, "multi-factor authentication required", http.StatusBadRequest)
+			return
+		}
 
 		timing.Start("store")
 		var person *people.Person
@@ -106,10 +234,13 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		timing.Stop("store")
 		var user = User{Person: *person, UserID: userID}
 		timing.Start("jwtgen")
-		accessToken, _ = t.tokenService.GenerateAccessToken(user, userID, clientID, IntersectScope(t.scope, scope))
+		accessToken, _ = t.tokenService.GenerateAccessToken(user, userID, client, ClientScope(client, t.scope, scope), nil, []string{people.MethodPassword})
 		timing.Stop("jwtgen")
 	case GrantTypeAuthorizationCode:
 		var codeClaims, authCodeErr = t.tokenService.Verify(code, TokenTypeCode)
+		if authCodeErr == nil {
+			codeClaims.UserID, authCodeErr = t.tokenService.ResolveSubject(client, codeClaims.UserID)
+		}
 		if authCodeErr != nil {
 			log.Printf("!!! %s", authCodeErr)
 			Error(w, ErrorInvalidGrant, authCodeErr.Error(), http.StatusBadRequest)
@@ -143,13 +274,25 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		timing.Stop("store")
 		var user = User{Person: *person, UserID: codeClaims.UserID}
 		timing.Start("jwtgen")
-		accessToken, _ = t.tokenService.GenerateAccessToken(user, codeClaims.UserID, clientID, codeClaims.Scope)
+		accessToken, _ = t.tokenService.GenerateAccessToken(user, codeClaims.UserID, client, codeClaims.Scope, codeClaims.ClaimsRequest, codeClaims.AuthMethods)
 		if strings.Contains(codeClaims.Scope, "offline_access") {
-			refreshToken, _ = t.tokenService.GenerateRefreshToken(codeClaims.UserID, clientID, codeClaims.Scope, codeClaims.Nonce)
+			var authTime = time.Now()
+			if codeClaims.AuthTime != nil {
+				authTime = codeClaims.AuthTime.Time()
+			}
+			refreshToken, err = t.issueRefreshToken(client, codeClaims.UserID, codeClaims.Scope, codeClaims.Nonce, "", "", authTime, codeClaims.ClaimsRequest, codeClaims.AuthMethods)
+			if errors.Is(err, ErrRefreshTokenLifetimeExceeded) {
+				// the login is too old for a refresh token, the access token is issued nonetheless
+				log.Printf("!!! %s, no refresh token issued for user_id=%s", err, codeClaims.UserID)
+			} else if err != nil {
+				log.Printf("!!! %s", err)
+				Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 		if strings.Contains(codeClaims.Scope, "openid") {
 			var hash = sha256.Sum256([]byte(accessToken))
-			idToken, _ = t.tokenService.GenerateIDToken(user, clientID, codeClaims.Scope, base64.RawURLEncoding.EncodeToString(hash[:16]), codeClaims.Nonce)
+			idToken, _ = t.tokenService.GenerateIDToken(user, client, codeClaims.Scope, base64.RawURLEncoding.EncodeToString(hash[:16]), codeClaims.Nonce, codeClaims.ClaimsRequest, codeClaims.AuthMethods)
 		}
 		timing.Stop("jwtgen")
 	case GrantTypeRefreshToken:
@@ -158,9 +301,19 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		var refreshClaims, refreshTokenErr = t.tokenService.Verify(refreshToken, TokenTypeRefreshToken)
+		if refreshTokenErr == nil && !strings.EqualFold(refreshClaims.ClientID, clientID) {
+			refreshTokenErr = errors.New("refresh token was issued to another client")
+		}
 		if refreshTokenErr == nil {
-			revokedToken, _ := t.trlStore.Lookup(refreshClaims.TokenID)
-			if revokedToken != nil {
+			refreshClaims.UserID, refreshTokenErr = t.tokenService.ResolveSubject(client, refreshClaims.UserID)
+		}
+		if refreshTokenErr == nil && refreshClaims.FamilyID != "" {
+			refreshTokenErr = t.verifyFamily(refreshClaims)
+		}
+		if refreshTokenErr == nil {
+			var revoked bool
+			revoked, refreshTokenErr = IsRevoked(t.trlStore, refreshClaims.TokenID, refreshClaims.UserID, refreshClaims.ClientID, refreshClaims.IssuedAt.Time())
+			if revoked {
 				refreshTokenErr = errors.New("refresh token has been revoked")
 			}
 		}
@@ -178,16 +331,25 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		timing.Stop("store")
 		var user = User{Person: *person, UserID: refreshClaims.UserID}
 		timing.Start("jwtgen")
-		accessToken, _ = t.tokenService.GenerateAccessToken(user, refreshClaims.UserID, clientID, refreshClaims.Scope)
+		accessToken, _ = t.tokenService.GenerateAccessToken(user, refreshClaims.UserID, client, refreshClaims.Scope, refreshClaims.ClaimsRequest, refreshClaims.AuthMethods)
 		if client.EnableRefreshTokenRotation && strings.Contains(refreshClaims.Scope, "offline_access") {
 			_ = t.trlStore.Put(refreshClaims.TokenID, refreshClaims.Expiry.Time())
-			refreshToken, _ = t.tokenService.GenerateRefreshToken(refreshClaims.UserID, clientID, refreshClaims.Scope, refreshClaims.Nonce)
+			var authTime = time.Now()
+			if refreshClaims.AuthTime != nil {
+				authTime = refreshClaims.AuthTime.Time()
+			}
+			refreshToken, err = t.issueRefreshToken(client, refreshClaims.UserID, refreshClaims.Scope, refreshClaims.Nonce, refreshClaims.FamilyID, refreshClaims.TokenID, authTime, refreshClaims.ClaimsRequest, refreshClaims.AuthMethods)
+			if err != nil {
+				log.Printf("!!! %s", err)
+				Error(w, ErrorInvalidGrant, err.Error(), http.StatusBadRequest)
+				return
+			}
 		} else {
 			refreshToken = ""
 		}
 		if strings.Contains(refreshClaims.Scope, "openid") {
 			var hash = sha256.Sum256([]byte(accessToken))
-			idToken, _ = t.tokenService.GenerateIDToken(user, clientID, refreshClaims.Scope, base64.RawURLEncoding.EncodeToString(hash[:16]), refreshClaims.Nonce)
+			idToken, _ = t.tokenService.GenerateIDToken(user, client, refreshClaims.Scope, base64.RawURLEncoding.EncodeToString(hash[:16]), refreshClaims.Nonce, refreshClaims.ClaimsRequest, refreshClaims.AuthMethods)
 		}
 		timing.Stop("jwtgen")
 	case GrantTypeClientCredentials:
@@ -200,7 +362,7 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		timing.Start("jwtgen")
-		accessToken, _ = t.tokenService.GenerateAccessToken(User{}, clientID, clientID, IntersectScope(t.scope, scope))
+		accessToken, _ = t.tokenService.GenerateAccessToken(User{}, clientID, client, ClientScope(client, t.scope, scope), nil, nil)
 		timing.Stop("jwtgen")
 	default:
 		Error(w, ErrorUnsupportedGrantType, "only grant types 'authorization_code', 'client_credentials', 'password' and 'refresh_token' are supported", http.StatusBadRequest)
@@ -210,7 +372,7 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var bytes, err = json.Marshal(TokenResponse{
 		AccessToken:  accessToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    t.tokenService.AccessTokenTTL(),
+		ExpiresIn:    t.tokenService.AccessTokenTTL(client),
 		RefreshToken: refreshToken,
 		IDToken:      idToken,
 	})
@@ -225,12 +387,15 @@ func (t *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
-func TokenHandler(tokenService TokenCreator, peopleStore people.Store, clientStore clients.Store, trlStore trl.Store, scope string) http.Handler {
+func TokenHandler(tokenService TokenCreator, peopleStore people.Store, clientStore clients.Store, trlStore trl.Store, familyStore families.Store, mfaPolicy MFAPolicy, lockoutGuard *lockout.Guard, scope string) http.Handler {
 	return &tokenHandler{
 		tokenService: tokenService,
 		peopleStore:  peopleStore,
 		clientStore:  clientStore,
 		trlStore:     trlStore,
+		familyStore:  familyStore,
+		mfaPolicy:    mfaPolicy,
+		lockoutGuard: lockoutGuard,
 		scope:        scope,
 	}
 }
@@ -0,0 +1,168 @@
+package oauth2
+
+import (
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestPeopleStore returns alice with the password "secret" and cookie sessions
+func newTestPeopleStore() people.Store {
+	return people.NewEmbeddedStore(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")), map[string]people.AuthenticPerson{
+		"alice": {Person: people.Person{GivenName: "Alice"}, PasswordHash: "$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe"},
+	}, 3600)
+}
+
+func (o *oauth2Test) tokenHandler() *tokenHandler {
+	var settings = lockout.Settings{}
+	return TokenHandler(o.tokenCreator, newTestPeopleStore(), o.clientStore, o.trlStore, o.familyStore, MFAPolicy{},
+		lockout.NewGuard(lockout.NewInMemoryStore(settings), settings), "openid profile email offline_access").(*tokenHandler)
+}
+
+func (o *oauth2Test) token(clientID string, form url.Values) (int, map[string]any) {
+	return o.post(o.tokenHandler(), clientID, form)
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var handler = o.tokenHandler()
+	var now = time.Now()
+	var authTime = now.Add(-time.Hour)
+
+	for _, tt := range []struct {
+		name   string
+		client clients.Client
+		scope  string
+		expiry time.Time
+	}{
+		{"idle", clients.Client{}, "offline_access", now.Add(time.Hour)},
+		{"client idle", clients.Client{RefreshTokenTTL: 60}, "offline_access", now.Add(time.Minute)},
+		{"max", clients.Client{RefreshTokenMaxTTL: 5400}, "offline_access", authTime.Add(90 * time.Minute)},
+		{"offline", clients.Client{OfflineSessionTTL: 5400}, "offline_access", authTime.Add(90 * time.Minute)},
+		{"offline shorter than max", clients.Client{RefreshTokenMaxTTL: 6000, OfflineSessionTTL: 5400}, "offline_access", authTime.Add(90 * time.Minute)},
+		{"max shorter than offline", clients.Client{RefreshTokenMaxTTL: 5400, OfflineSessionTTL: 6000}, "offline_access", authTime.Add(90 * time.Minute)},
+		{"offline without scope", clients.Client{OfflineSessionTTL: 5400}, "openid", now.Add(time.Hour)},
+	} {
+		if expiry := handler.refreshTokenExpiry(tt.client, tt.scope, authTime, now); !expiry.Equal(tt.expiry) {
+			t.Errorf("%s: expiry = %v, want %v", tt.name, expiry.Sub(now), tt.expiry.Sub(now))
+		}
+	}
+}
+
+func TestAuthorizationCodeAfterMaxLifetime(t *testing.T) {
+	var o = newOAuth2Test(t)
+	o.clientStore = clients.NewInMemoryClientStore(map[string]clients.Client{"app": {SecretHash: "secret", RefreshTokenMaxTTL: 60}})
+
+	var code, err = o.tokenCreator.GenerateAuthCode("alice", o.client("app"), "openid offline_access", "", "", time.Now().Add(-time.Hour), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status, response = o.token("app", url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code}})
+	if status != http.StatusOK || response["access_token"] == nil {
+		t.Fatalf("token: %d %v", status, response)
+	}
+	if _, found := response["refresh_token"]; found {
+		t.Errorf("refresh token issued after the maximum lifetime: %v", response)
+	}
+}
+
+func TestRefreshTokenOfUnknownFamily(t *testing.T) {
+	var o = newOAuth2Test(t)
+	// the family got lost, e.g. with a restart of the in-memory store
+	var refreshToken, tokenID, err = o.tokenCreator.GenerateRefreshToken("alice", o.client("app"), "openid offline_access", "", "family", time.Now(), time.Now().Add(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status, response = o.token("app", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {refreshToken}})
+	if status != http.StatusOK || response["refresh_token"] == nil {
+		t.Fatalf("refresh: %d %v", status, response)
+	}
+	if family, err := o.familyStore.Lookup("family"); err != nil || family.TokenID == tokenID || family.Revoked {
+		t.Fatalf("family = %+v, %v", family, err)
+	}
+
+	// the rotated token is reused
+	status, response = o.token("app", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {refreshToken}})
+	if status != http.StatusBadRequest || response["error"] != ErrorInvalidGrant {
+		t.Errorf("reuse: %d %v", status, response)
+	}
+	if family, err := o.familyStore.Lookup("family"); err != nil || !family.Revoked {
+		t.Errorf("family = %+v, %v", family, err)
+	}
+}
+
+func TestPasswordGrant(t *testing.T) {
+	var o = newOAuth2Test(t)
+
+	var status, response = o.token("app", url.Values{"grant_type": {GrantTypePassword}, "username": {"Alice"}, "password": {"secret"}, "scope": {"openid email"}})
+	if status != http.StatusOK {
+		t.Fatalf("token: %d %v", status, response)
+	}
+	var claims, err = o.tokenCreator.Verify(response["access_token"].(string), "")
+	if err != nil || claims.Subject != "alice" || claims.Scope != "openid email" {
+		t.Errorf("access token = %+v, %v", claims, err)
+	}
+
+	status, response = o.token("app", url.Values{"grant_type": {GrantTypePassword}, "username": {"alice"}, "password": {"wrong"}})
+	if status != http.StatusBadRequest || response["error"] != ErrorInvalidGrant {
+		t.Errorf("wrong password: %d %v", status, response)
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	var o = newOAuth2Test(t)
+
+	var status, response = o.token("app", url.Values{"grant_type": {GrantTypeClientCredentials}})
+	if status != http.StatusOK || response["refresh_token"] != nil {
+		t.Fatalf("token: %d %v", status, response)
+	}
+	if claims, err := o.tokenCreator.Verify(response["access_token"].(string), ""); err != nil || claims.Subject != "app" {
+		t.Errorf("access token = %+v, %v", claims, err)
+	}
+
+	o.clientStore = clients.NewInMemoryClientStore(map[string]clients.Client{
+		"app": {SecretHash: "secret", GrantTypes: []string{GrantTypeAuthorizationCode}},
+	})
+	status, response = o.token("app", url.Values{"grant_type": {GrantTypeClientCredentials}})
+	if status != http.StatusBadRequest || response["error"] != ErrorUnauthorizedClient {
+		t.Errorf("grant type not allowed: %d %v", status, response)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	var o = newOAuth2Test(t)
+	var code, err = o.tokenCreator.GenerateAuthCode("alice", o.client("app"), "openid offline_access", "", "", time.Now(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status, response = o.token("app", url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code}})
+	if status != http.StatusOK || response["refresh_token"] == nil || response["id_token"] == nil {
+		t.Fatalf("code: %d %v", status, response)
+	}
+	var first = response["refresh_token"].(string)
+
+	status, response = o.token("app", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {first}})
+	if status != http.StatusOK || response["refresh_token"] == nil || response["refresh_token"] == first {
+		t.Fatalf("refresh: %d %v", status, response)
+	}
+	var second = response["refresh_token"].(string)
+
+	// refresh tokens are bound to their client
+	if status, response = o.token("other", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {second}}); status != http.StatusBadRequest {
+		t.Errorf("refresh by other client: %d %v", status, response)
+	}
+
+	// reusing the rotated token revokes the family including the current token
+	if status, response = o.token("app", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {first}}); status != http.StatusBadRequest || response["error"] != ErrorInvalidGrant {
+		t.Errorf("reuse: %d %v", status, response)
+	}
+	if status, response = o.token("app", url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {second}}); status != http.StatusBadRequest || response["error"] != ErrorInvalidGrant {
+		t.Errorf("refresh after reuse: %d %v", status, response)
+	}
+}
@@ -2,12 +2,17 @@ package oauth2
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"errors"
+	"fmt"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/keys"
+	"github.com/cwkr/authd/internal/oauth2/opaque"
 	"github.com/cwkr/authd/internal/people"
+	"github.com/cwkr/authd/keyset"
 	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/oklog/ulid/v2"
+	"slices"
 	"strings"
 	"time"
 )
@@ -17,14 +22,22 @@ const (
 	GrantTypeClientCredentials = "client_credentials"
 	GrantTypeRefreshToken      = "refresh_token"
 	GrantTypePassword          = "password"
+	GrantTypeImplicit          = "implicit"
 
 	TokenTypeCode         = "code"
+	TokenTypeAccessToken  = "access_token"
 	TokenTypeRefreshToken = "refresh_token"
 	ResponseTypeCode      = "code"
 	ResponseTypeToken     = "token"
+
+	AccessTokenFormatJWT    = "jwt"
+	AccessTokenFormatOpaque = "opaque"
 )
 
-var ErrInvalidTokenType = errors.New("invalid token type (typ)")
+var (
+	ErrInvalidTokenType             = errors.New("invalid token type (typ)")
+	ErrRefreshTokenLifetimeExceeded = errors.New("maximum refresh token lifetime exceeded")
+)
 
 type User struct {
 	people.Person
@@ -32,14 +45,21 @@ type User struct {
 }
 
 type VerifiedClaims struct {
-	UserID    string           `json:"user_id"`
-	ClientID  string           `json:"client_id"`
-	TokenID   string           `json:"jti"`
-	Type      string           `json:"typ"`
-	Scope     string           `json:"scope"`
-	Challenge string           `json:"challenge"`
-	Nonce     string           `json:"nonce"`
-	Expiry    *jwt.NumericDate `json:"exp"`
+	Subject       string           `json:"sub"`
+	UserID        string           `json:"user_id"`
+	ClientID      string           `json:"client_id"`
+	TokenID       string           `json:"jti"`
+	Type          string           `json:"typ"`
+	Scope         string           `json:"scope"`
+	Challenge     string           `json:"challenge"`
+	Nonce         string           `json:"nonce"`
+	FamilyID      string           `json:"fid"`
+	AuthTime      *jwt.NumericDate `json:"auth_time"`
+	AuthMethods   []string         `json:"amr"`
+	AuthContext   string           `json:"acr"`
+	IssuedAt      *jwt.NumericDate `json:"iat"`
+	Expiry        *jwt.NumericDate `json:"exp"`
+	ClaimsRequest *ClaimsRequest   `json:"claims"`
 }
 
 func NewTokenID(timestamp time.Time) string {
@@ -48,102 +68,314 @@ func NewTokenID(timestamp time.Time) string {
 }
 
 type TokenCreator interface {
-	GenerateAccessToken(user User, subject, clientID, scope string) (string, error)
-	GenerateIDToken(user User, clientID, scope, accessTokenHash, nonce string) (string, error)
-	GenerateAuthCode(userID, clientID, scope, challenge, nonce string) (string, error)
-	GenerateRefreshToken(userID, clientID, scope, nonce string) (string, error)
+	GenerateAccessToken(user User, subject string, client clients.Client, scope string, claimsRequest *ClaimsRequest, authMethods []string) (string, error)
+	GenerateIDToken(user User, client clients.Client, scope, accessTokenHash, nonce string, claimsRequest *ClaimsRequest, authMethods []string) (string, error)
+	GenerateAuthCode(userID string, client clients.Client, scope, challenge, nonce string, authTime time.Time, claimsRequest *ClaimsRequest, authMethods []string) (string, error)
+	GenerateRefreshToken(userID string, client clients.Client, scope, nonce, familyID string, authTime, expiry time.Time, claimsRequest *ClaimsRequest, authMethods []string) (string, string, error)
 	Verify(rawToken, tokenType string) (*VerifiedClaims, error)
-	AccessTokenTTL() int64
+	AccessTokenTTL(client clients.Client) int64
+	RefreshTokenTTL() int64
+	GenerateUserInfoResponse(claims map[string]any, client clients.Client) (string, error)
+	ResolveSubject(client clients.Client, subject string) (string, error)
+	ValidateClient(client clients.Client) error
+	Introspect(rawToken string) (map[string]any, error)
 	Issuer() string
 }
 
 type tokenCreator struct {
-	privateKey             *rsa.PrivateKey
-	signer                 jose.Signer
+	keyManager             keys.Manager
+	clientKeySets          ClientKeySets
+	subjectMapper          SubjectMapper
+	opaqueStore            opaque.Store
 	issuer                 string
 	scope                  string
 	accessTokenTTL         int64
 	refreshTokenTTL        int64
 	idTokenTTL             int64
+	codeTTL                int64
 	accessTokenExtraClaims map[string]string
 	idTokenExtraClaims     map[string]string
 	roleMappings           RoleMappings
+	acrLevels              ACRLevels
 }
 
-func (t tokenCreator) AccessTokenTTL() int64 {
+func (t tokenCreator) AccessTokenTTL(client clients.Client) int64 {
+	if client.AccessTokenTTL > 0 {
+		return int64(client.AccessTokenTTL)
+	}
 	return t.accessTokenTTL
 }
 
+func (t tokenCreator) idTokenTTLFor(client clients.Client) int64 {
+	if client.IDTokenTTL > 0 {
+		return int64(client.IDTokenTTL)
+	}
+	return t.idTokenTTL
+}
+
+func (t tokenCreator) codeTTLFor(client clients.Client) int64 {
+	if client.CodeTTL > 0 {
+		return int64(client.CodeTTL)
+	}
+	return t.codeTTL
+}
+
+func (t tokenCreator) RefreshTokenTTL() int64 {
+	return t.refreshTokenTTL
+}
+
 func (t tokenCreator) Issuer() string {
 	return t.issuer
 }
 
-func (t tokenCreator) GenerateAccessToken(user User, subject, clientID, scope string) (string, error) {
+// Subject returns the subject identifier of the user as seen by the client
+func (t tokenCreator) Subject(client clients.Client, userID string) (string, error) {
+	return t.subjectMapper.Subject(client, userID)
+}
+
+// ResolveSubject maps a subject identifier issued to the client back to the internal user id
+func (t tokenCreator) ResolveSubject(client clients.Client, subject string) (string, error) {
+	return t.subjectMapper.UserID(client, subject)
+}
+
+// ValidateClient fails for clients the server is not configured for, such as pairwise clients without pairwise_salt
+func (t tokenCreator) ValidateClient(client clients.Client) error {
+	return t.subjectMapper.Validate(client)
+}
+
+func (t tokenCreator) GenerateAccessToken(user User, subject string, client clients.Client, scope string, claimsRequest *ClaimsRequest, authMethods []string) (string, error) {
 	var now = time.Now()
 
+	if user.UserID != "" {
+		var err error
+		if subject, err = t.Subject(client, user.UserID); err != nil {
+			return "", err
+		}
+	}
+
 	var claims = map[string]any{
 		ClaimIssuer:        t.issuer,
 		ClaimSubject:       subject,
 		ClaimIssuedAtTime:  now.Unix(),
 		ClaimNotBeforeTime: now.Unix(),
-		ClaimExpiryTime:    now.Unix() + t.accessTokenTTL,
-		ClaimAudience:      []string{t.issuer, clientID},
+		ClaimExpiryTime:    now.Unix() + t.AccessTokenTTL(client),
+		ClaimAudience:      []string{t.issuer, client.ClientID},
+		ClaimClientID:      client.ClientID,
 		ClaimTokenID:       NewTokenID(now),
 	}
 
 	if scope != "" {
 		claims[ClaimScope] = scope
 	}
+	// the userinfo endpoint reads requested claims from the access token
+	if userInfoClaimsRequest := claimsRequest.UserInfoOnly(); userInfoClaimsRequest != nil {
+		claims[ClaimClaims] = userInfoClaimsRequest
+	}
+	// resource servers demanding step-up authentication check acr
+	addAuthenticationClaims(claims, t.acrLevels, authMethods)
 
-	AddExtraClaims(claims, t.accessTokenExtraClaims, user, clientID, t.roleMappings)
+	AddExtraClaims(claims, MergeExtraClaims(t.accessTokenExtraClaims, client.AccessTokenExtraClaims), user, client, t.roleMappings)
 
-	return jwt.Signed(t.signer).Claims(claims).CompactSerialize()
+	if strings.EqualFold(client.AccessTokenFormat, AccessTokenFormatOpaque) {
+		return t.generateReferenceToken(claims, now.Add(time.Duration(t.AccessTokenTTL(client))*time.Second))
+	}
+
+	var signer, err = t.signer()
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
 }
 
-func (t tokenCreator) GenerateIDToken(user User, clientID, scope, accessTokenHash, nonce string) (string, error) {
+func (t tokenCreator) GenerateIDToken(user User, client clients.Client, scope, accessTokenHash, nonce string, claimsRequest *ClaimsRequest, authMethods []string) (string, error) {
 	var now = time.Now()
 
+	var subject, err = t.Subject(client, user.UserID)
+	if err != nil {
+		return "", err
+	}
+
 	var claims = map[string]any{
 		ClaimIssuer:          t.issuer,
-		ClaimSubject:         user.UserID,
+		ClaimSubject:         subject,
 		ClaimIssuedAtTime:    now.Unix(),
 		ClaimNotBeforeTime:   now.Unix(),
-		ClaimExpiryTime:      now.Unix() + t.idTokenTTL,
-		ClaimAudience:        []string{t.issuer, clientID},
+		ClaimExpiryTime:      now.Unix() + t.idTokenTTLFor(client),
+		ClaimAudience:        []string{t.issuer, client.ClientID},
 		ClaimAccessTokenHash: accessTokenHash,
 		ClaimNonce:           nonce,
 		ClaimTokenID:         NewTokenID(now),
 	}
+	addAuthenticationClaims(claims, t.acrLevels, authMethods)
 
+	var releasedUser = ReleasedUser(user, client)
 	if strings.Contains(scope, "profile") {
-		AddProfileClaims(claims, user)
+		AddProfileClaims(claims, releasedUser)
 	}
 	if strings.Contains(scope, "email") {
-		AddEmailClaims(claims, user)
+		AddEmailClaims(claims, releasedUser)
 	}
 	if strings.Contains(scope, "phone") {
-		AddPhoneClaims(claims, user)
+		AddPhoneClaims(claims, releasedUser)
 	}
 	if strings.Contains(scope, "address") {
-		AddAddressClaims(claims, user)
+		AddAddressClaims(claims, releasedUser)
+	}
+	if claimsRequest != nil {
+		AddRequestedClaims(claims, claimsRequest.IDToken, releasedUser)
+	}
+	AddExtraClaims(claims, MergeExtraClaims(t.idTokenExtraClaims, client.IDTokenExtraClaims), user, client, t.roleMappings)
+
+	signer, err := t.signer()
+	if err != nil {
+		return "", err
+	}
+
+	if client.IDTokenEncryptedResponseAlg != "" {
+		var encrypter, err = t.encrypterFor(client, client.IDTokenEncryptedResponseAlg, client.IDTokenEncryptedResponseEnc, "JWT")
+		if err != nil {
+			return "", err
+		}
+		return jwt.SignedAndEncrypted(signer, encrypter).Claims(claims).CompactSerialize()
+	}
+
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// GenerateUserInfoResponse signs and/or encrypts the userinfo claims as requested by the client registration.
+func (t tokenCreator) GenerateUserInfoResponse(claims map[string]any, client clients.Client) (string, error) {
+	var signer jose.Signer
+	if client.UserinfoSignedResponseAlg != "" {
+		var err error
+		if signer, err = t.signerFor(client.UserinfoSignedResponseAlg); err != nil {
+			return "", err
+		}
+		claims[ClaimIssuer] = t.issuer
+		claims[ClaimAudience] = client.ClientID
+	}
+
+	if client.UserinfoEncryptedResponseAlg == "" {
+		if signer == nil {
+			return "", ErrUnsupportedEncryption
+		}
+		return jwt.Signed(signer).Claims(claims).CompactSerialize()
+	}
+
+	var contentType string
+	if signer != nil {
+		contentType = "JWT"
+	}
+	var encrypter, err = t.encrypterFor(client, client.UserinfoEncryptedResponseAlg, client.UserinfoEncryptedResponseEnc, contentType)
+	if err != nil {
+		return "", err
+	}
+	if signer != nil {
+		return jwt.SignedAndEncrypted(signer, encrypter).Claims(claims).CompactSerialize()
+	}
+	return jwt.Encrypted(encrypter).Claims(claims).CompactSerialize()
+}
+
+// generateReferenceToken keeps the claims in the opaque token store and returns a random token referencing them
+func (t tokenCreator) generateReferenceToken(claims map[string]any, expirationTime time.Time) (string, error) {
+	if t.opaqueStore == nil {
+		return "", opaque.ErrTokenNotFound
+	}
+	var token, err = opaque.NewToken()
+	if err != nil {
+		return "", err
+	}
+	if err := t.opaqueStore.Put(opaque.Hash(token), claims, expirationTime); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Introspect returns the claims of a valid reference token or signed token issued by this server
+func (t tokenCreator) Introspect(rawToken string) (map[string]any, error) {
+	if opaque.IsOpaque(rawToken) {
+		if t.opaqueStore == nil {
+			return nil, opaque.ErrTokenNotFound
+		}
+		return t.opaqueStore.Lookup(opaque.Hash(rawToken))
 	}
-	AddExtraClaims(claims, t.idTokenExtraClaims, user, clientID, t.roleMappings)
 
-	return jwt.Signed(t.signer).Claims(claims).CompactSerialize()
+	var token, err = jwt.ParseSigned(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.Headers) == 0 {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+	key, err := t.keyManager.Lookup(token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if token.Headers[0].Algorithm != string(key.Algorithm) {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+	var claims = jwt.Claims{}
+	var allClaims = map[string]any{}
+	if err := token.Claims(key.Public(), &claims, &allClaims); err != nil {
+		return nil, err
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{Issuer: t.issuer, Time: time.Now()}, 0); err != nil {
+		return nil, err
+	}
+	return allClaims, nil
 }
 
-func (t tokenCreator) GenerateAuthCode(userID, clientID, scope, challenge, nonce string) (string, error) {
+// signer returns a signer for the currently active signing key
+func (t tokenCreator) signer() (jose.Signer, error) {
+	var key, err = t.keyManager.Current()
+	if err != nil {
+		return nil, err
+	}
+	return key.Signer()
+}
+
+func (t tokenCreator) signerFor(algorithm string) (jose.Signer, error) {
+	var key, err = t.keyManager.Current()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(keyset.SigningAlgorithms(key.Public()), jose.SignatureAlgorithm(algorithm)) {
+		return nil, fmt.Errorf("%w: %s", jose.ErrUnsupportedAlgorithm, algorithm)
+	}
+	return key.SignerWithAlgorithm(jose.SignatureAlgorithm(algorithm))
+}
+
+func (t tokenCreator) encrypterFor(client clients.Client, algorithm, encryption, contentType string) (jose.Encrypter, error) {
+	if t.clientKeySets == nil {
+		return nil, ErrClientKeysMissing
+	}
+	var publicKeys, err = t.clientKeySets.Get(client)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncrypter(publicKeys, algorithm, encryption, contentType)
+}
+
+// GenerateAuthCode returns a signed authorization code. The authentication time of the session is carried in the
+// auth_time claim so that refresh tokens issued for the code can not outlive the login.
+func (t tokenCreator) GenerateAuthCode(userID string, client clients.Client, scope, challenge, nonce string, authTime time.Time, claimsRequest *ClaimsRequest, authMethods []string) (string, error) {
 	var now = time.Now()
 
+	// codes and refresh tokens are readable by the client, so they carry the client specific subject as well
+	var subject, err = t.Subject(client, userID)
+	if err != nil {
+		return "", err
+	}
+
 	var claims = map[string]any{
 		ClaimIssuer:        t.issuer,
 		ClaimSubject:       NewTokenID(now),
 		ClaimType:          TokenTypeCode,
-		ClaimClientID:      clientID,
-		ClaimUserID:        userID,
+		ClaimClientID:      client.ClientID,
+		ClaimUserID:        subject,
 		ClaimIssuedAtTime:  now.Unix(),
 		ClaimNotBeforeTime: now.Unix(),
-		ClaimExpiryTime:    now.Unix() + 300,
+		ClaimExpiryTime:    now.Unix() + t.codeTTLFor(client),
+		ClaimAuthTime:      authTime.Unix(),
 	}
 
 	if scope != "" {
@@ -155,23 +387,41 @@ func (t tokenCreator) GenerateAuthCode(userID, clientID, scope, challenge, nonce
 	if nonce != "" {
 		claims[ClaimNonce] = nonce
 	}
+	if len(authMethods) > 0 {
+		claims[ClaimAuthMethods] = authMethods
+	}
+	if claimsRequest != nil {
+		claims[ClaimClaims] = claimsRequest
+	}
 
-	return jwt.Signed(t.signer).Claims(claims).CompactSerialize()
+	signer, err := t.signer()
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
 }
 
-func (t tokenCreator) GenerateRefreshToken(userID, clientID, scope, nonce string) (string, error) {
+// GenerateRefreshToken returns the signed refresh token and its token id (jti). The original authentication time is
+// carried in the auth_time claim so that an absolute lifetime can be enforced across rotations.
+func (t tokenCreator) GenerateRefreshToken(userID string, client clients.Client, scope, nonce, familyID string, authTime, expiry time.Time, claimsRequest *ClaimsRequest, authMethods []string) (string, string, error) {
 	var now = time.Now()
 	var tokenID = NewTokenID(now)
 
+	var subject, err = t.Subject(client, userID)
+	if err != nil {
+		return "", "", err
+	}
+
 	var claims = map[string]any{
 		ClaimIssuer:        t.issuer,
 		ClaimSubject:       tokenID,
 		ClaimType:          TokenTypeRefreshToken,
-		ClaimClientID:      clientID,
-		ClaimUserID:        userID,
+		ClaimClientID:      client.ClientID,
+		ClaimUserID:        subject,
 		ClaimIssuedAtTime:  now.Unix(),
 		ClaimNotBeforeTime: now.Unix(),
-		ClaimExpiryTime:    now.Unix() + t.refreshTokenTTL,
+		ClaimExpiryTime:    expiry.Unix(),
+		ClaimAuthTime:      authTime.Unix(),
 		ClaimTokenID:       tokenID,
 	}
 
@@ -181,8 +431,22 @@ func (t tokenCreator) GenerateRefreshToken(userID, clientID, scope, nonce string
 	if nonce != "" {
 		claims[ClaimNonce] = nonce
 	}
+	if len(authMethods) > 0 {
+		claims[ClaimAuthMethods] = authMethods
+	}
+	if familyID != "" {
+		claims[ClaimFamilyID] = familyID
+	}
+	if claimsRequest != nil {
+		claims[ClaimClaims] = claimsRequest
+	}
 
-	return jwt.Signed(t.signer).Claims(claims).CompactSerialize()
+	signer, err := t.signer()
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	return refreshToken, tokenID, err
 }
 
 func (t tokenCreator) Verify(rawToken, tokenType string) (*VerifiedClaims, error) {
@@ -192,7 +456,18 @@ func (t tokenCreator) Verify(rawToken, tokenType string) (*VerifiedClaims, error
 	}
 	var claims = jwt.Claims{}
 	var verifiedClaims = VerifiedClaims{}
-	if err := token.Claims(&t.privateKey.PublicKey, &claims, &verifiedClaims); err != nil {
+	if len(token.Headers) == 0 {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+	// tokens remain verifiable with retired keys until the keys expire
+	key, err := t.keyManager.Lookup(token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if token.Headers[0].Algorithm != string(key.Algorithm) {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+	if err := token.Claims(key.Public(), &claims, &verifiedClaims); err != nil {
 		return nil, err
 	}
 	if tokenType != "" && verifiedClaims.Type != tokenType {
@@ -209,28 +484,27 @@ func (t tokenCreator) Verify(rawToken, tokenType string) (*VerifiedClaims, error
 	}
 }
 
-func NewTokenCreator(privateKey *rsa.PrivateKey, keyID, issuer, scope string,
+func NewTokenCreator(keyManager keys.Manager, issuer, scope string,
 	accessTokenTTL, refreshTokenTTL, idTokenTTL int64,
 	accessTokenExtraClaims, idTokenExtraClaims map[string]string,
-	roleMappings RoleMappings, usePSS bool) (TokenCreator, error) {
-	var algorithm = jose.RS256
-	if usePSS {
-		algorithm = jose.PS256
-	}
-	var signer, err = jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: privateKey}, (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID))
-	if err != nil {
+	roleMappings RoleMappings, acrLevels ACRLevels, clientKeySets ClientKeySets, subjectMapper SubjectMapper, opaqueStore opaque.Store) (TokenCreator, error) {
+	if _, err := keyManager.Current(); err != nil {
 		return nil, err
 	}
 	return &tokenCreator{
-		privateKey:             privateKey,
-		signer:                 signer,
+		keyManager:             keyManager,
+		clientKeySets:          clientKeySets,
+		subjectMapper:          subjectMapper,
+		opaqueStore:            opaqueStore,
 		issuer:                 issuer,
 		scope:                  scope,
 		accessTokenTTL:         accessTokenTTL,
 		refreshTokenTTL:        refreshTokenTTL,
 		idTokenTTL:             idTokenTTL,
+		codeTTL:                300,
 		accessTokenExtraClaims: accessTokenExtraClaims,
 		idTokenExtraClaims:     idTokenExtraClaims,
 		roleMappings:           roleMappings,
+		acrLevels:              acrLevels,
 	}, nil
 }
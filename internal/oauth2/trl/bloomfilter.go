@@ -0,0 +1,62 @@
+package trl
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter answers whether a token id may be in the revocation list, false positives occur with the configured
+// probability but there are no false negatives
+type bloomFilter struct {
+	bits   []uint64
+	hashes uint64
+	// capacity is the number of keys the filter has been sized for, count the number of keys added
+	capacity int
+	count    int
+}
+
+func newBloomFilter(entries int, falsePositiveRate float64) *bloomFilter {
+	var n = math.Max(float64(entries), 1024)
+	var m = math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	var k = math.Max(math.Round(m/n*math.Ln2), 1)
+	return &bloomFilter{
+		bits:     make([]uint64, (uint64(m)+63)/64),
+		hashes:   uint64(k),
+		capacity: int(n),
+	}
+}
+
+// locations uses double hashing to derive the bit positions of a key
+func (b *bloomFilter) locations(key string, fn func(bit uint64)) {
+	var h = fnv.New64a()
+	h.Write([]byte(key))
+	var h1 = h.Sum64()
+	var h2 = h1>>32 | h1<<32 | 1
+	var size = uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.hashes; i++ {
+		fn((h1 + i*h2) % size)
+	}
+}
+
+func (b *bloomFilter) Add(key string) {
+	b.locations(key, func(bit uint64) {
+		b.bits[bit/64] |= 1 << (bit % 64)
+	})
+	b.count++
+}
+
+// Full reports whether more keys have been added than the filter has been sized for, the false positive rate rises
+// above the configured one
+func (b *bloomFilter) Full() bool {
+	return b.count > b.capacity
+}
+
+func (b *bloomFilter) MayContain(key string) bool {
+	var found = true
+	b.locations(key, func(bit uint64) {
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
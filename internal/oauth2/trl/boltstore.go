@@ -0,0 +1,200 @@
+package trl
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+// BoltURIPrefix marks store uris that name a bbolt database file, relative paths are resolved against the settings file
+const BoltURIPrefix = "bolt:"
+
+var (
+	bucketRevokedTokens = []byte("revoked_tokens")
+	bucketCutoffs       = []byte("cutoffs")
+)
+
+type boltStore struct {
+	db *bbolt.DB
+}
+
+func IsBoltURI(uri string) bool {
+	return strings.HasPrefix(uri, BoltURIPrefix)
+}
+
+func NewBoltStore(filename string) (Store, error) {
+	var db, err = bbolt.Open(filename, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketRevokedTokens); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketCutoffs)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Put(tokenID string, expirationTime time.Time) error {
+	var value, err = json.Marshal(RevokedToken{RevocationTime: time.Now(), ExpirationTime: expirationTime})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		var bucket = tx.Bucket(bucketRevokedTokens)
+		if bucket.Get([]byte(tokenID)) != nil {
+			return nil
+		}
+		return bucket.Put([]byte(tokenID), value)
+	})
+}
+
+func (s *boltStore) Lookup(tokenID string) (*RevokedToken, error) {
+	var revokedToken *RevokedToken
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket(bucketRevokedTokens).Get([]byte(tokenID)); value != nil {
+			revokedToken = &RevokedToken{}
+			return json.Unmarshal(value, revokedToken)
+		}
+		return nil
+	})
+	if err != nil || revokedToken == nil || revokedToken.ExpirationTime.Before(time.Now()) {
+		return nil, err
+	}
+	return revokedToken, nil
+}
+
+func cutoffKey(cutoff Cutoff) []byte {
+	return []byte(cutoff.UserID + "\x00" + cutoff.ClientID)
+}
+
+func (s *boltStore) PutCutoff(userID, clientID string, revokedBefore time.Time) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		var bucket = tx.Bucket(bucketCutoffs)
+		var key = cutoffKey(Cutoff{userID, clientID})
+		if value := bucket.Get(key); value != nil {
+			var existing time.Time
+			if err := existing.UnmarshalText(value); err == nil && existing.After(revokedBefore) {
+				return nil
+			}
+		}
+		var value, err = revokedBefore.MarshalText()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, value)
+	})
+}
+
+func (s *boltStore) LookupCutoff(userID, clientID string) (time.Time, error) {
+	var revokedBefore time.Time
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var bucket = tx.Bucket(bucketCutoffs)
+		for _, cutoff := range matchingCutoffs(userID, clientID) {
+			if value := bucket.Get(cutoffKey(cutoff)); value != nil {
+				var cutoffTime time.Time
+				if err := cutoffTime.UnmarshalText(value); err != nil {
+					return err
+				}
+				if cutoffTime.After(revokedBefore) {
+					revokedBefore = cutoffTime
+				}
+			}
+		}
+		return nil
+	})
+	return revokedBefore, err
+}
+
+// purgeBucket deletes the entries of the bucket that are expired, the caller holds a write transaction
+func purgeBucket(bucket *bbolt.Bucket, expired func(value []byte) bool) (int64, error) {
+	var keys [][]byte
+	err := bucket.ForEach(func(key, value []byte) error {
+		if expired(value) {
+			keys = append(keys, bytes.Clone(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// keys must not be deleted while iterating the bucket
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+func (s *boltStore) Purge(cutoffsBefore time.Time) (int64, error) {
+	var (
+		now    = time.Now()
+		purged int64
+	)
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var purgedTokens, err = purgeBucket(tx.Bucket(bucketRevokedTokens), func(value []byte) bool {
+			var revokedToken RevokedToken
+			return json.Unmarshal(value, &revokedToken) != nil || revokedToken.ExpirationTime.Before(now)
+		})
+		if err != nil {
+			return err
+		}
+		purgedCutoffs, err := purgeBucket(tx.Bucket(bucketCutoffs), func(value []byte) bool {
+			var revokedBefore time.Time
+			return revokedBefore.UnmarshalText(value) != nil || revokedBefore.Before(cutoffsBefore)
+		})
+		purged = purgedTokens + purgedCutoffs
+		return err
+	})
+	return purged, err
+}
+
+func (s *boltStore) Snapshot() (*Snapshot, error) {
+	var (
+		now      = time.Now()
+		snapshot = Snapshot{RevokedTokens: map[string]RevokedToken{}, Cutoffs: map[Cutoff]time.Time{}}
+	)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(bucketRevokedTokens).ForEach(func(key, value []byte) error {
+			var revokedToken RevokedToken
+			if err := json.Unmarshal(value, &revokedToken); err != nil {
+				return err
+			}
+			if !revokedToken.ExpirationTime.Before(now) {
+				snapshot.RevokedTokens[string(key)] = revokedToken
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketCutoffs).ForEach(func(key, value []byte) error {
+			var revokedBefore time.Time
+			if err := revokedBefore.UnmarshalText(value); err != nil {
+				return err
+			}
+			var userID, clientID, _ = strings.Cut(string(key), "\x00")
+			snapshot.Cutoffs[Cutoff{userID, clientID}] = revokedBefore
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *boltStore) Ping() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
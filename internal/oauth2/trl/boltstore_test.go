@@ -0,0 +1,102 @@
+package trl
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBoltStore(t *testing.T) Store {
+	var store, err = NewBoltStore(filepath.Join(t.TempDir(), "trl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.(*boltStore).db.Close() })
+	return store
+}
+
+// testStore checks the behaviour every persistent store shares
+func testStore(t *testing.T, store Store) {
+	var (
+		now     = time.Now()
+		expiry  = now.Add(time.Hour).Round(time.Microsecond)
+		expired = now.Add(-time.Minute)
+	)
+
+	if revokedToken, err := store.Lookup("revoked"); err != nil || revokedToken != nil {
+		t.Fatalf("Lookup before Put = %+v, %v", revokedToken, err)
+	}
+	for _, tokenID := range []string{"revoked", "expired"} {
+		var expirationTime = expiry
+		if tokenID == "expired" {
+			expirationTime = expired
+		}
+		if err := store.Put(tokenID, expirationTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var revokedToken, err = store.Lookup("revoked")
+	if err != nil || revokedToken == nil {
+		t.Fatalf("Lookup = %+v, %v", revokedToken, err)
+	}
+	if !revokedToken.ExpirationTime.Equal(expiry) || revokedToken.RevocationTime.Before(now.Add(-time.Second)) {
+		t.Errorf("Lookup = %+v", revokedToken)
+	}
+	if expiredToken, err := store.Lookup("expired"); err != nil || expiredToken != nil {
+		t.Errorf("Lookup of expired token = %+v, %v", expiredToken, err)
+	}
+
+	var (
+		old    = now.Add(-48 * time.Hour).Round(time.Microsecond)
+		recent = now.Add(-time.Hour).Round(time.Microsecond)
+	)
+	for _, cutoff := range []struct {
+		userID, clientID string
+		revokedBefore    time.Time
+	}{
+		{"alice", "app", old},
+		{"alice", AnyID, recent},
+		{AnyID, "other", old},
+		// cutoffs are never moved back
+		{"alice", AnyID, old},
+	} {
+		if err := store.PutCutoff(cutoff.userID, cutoff.clientID, cutoff.revokedBefore); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		userID, clientID string
+		want             time.Time
+	}{
+		{"alice", "app", recent},
+		{"alice", "other", recent},
+		{"bob", "other", old},
+		{"bob", "app", time.Time{}},
+	} {
+		if revokedBefore, err := store.LookupCutoff(tt.userID, tt.clientID); err != nil || !revokedBefore.Equal(tt.want) {
+			t.Errorf("LookupCutoff(%s, %s) = %v, %v, want %v", tt.userID, tt.clientID, revokedBefore, err, tt.want)
+		}
+	}
+
+	// the expired token and both old cutoffs
+	if purged, err := store.Purge(now.Add(-24 * time.Hour)); err != nil || purged != 3 {
+		t.Errorf("Purge = %d, %v", purged, err)
+	}
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := snapshot.RevokedTokens["revoked"]; !found || len(snapshot.RevokedTokens) != 1 {
+		t.Errorf("RevokedTokens = %v", snapshot.RevokedTokens)
+	}
+	if revokedBefore := snapshot.Cutoffs[Cutoff{"alice", AnyID}]; !revokedBefore.Equal(recent) || len(snapshot.Cutoffs) != 1 {
+		t.Errorf("Cutoffs = %v", snapshot.Cutoffs)
+	}
+	if revokedBefore, err := store.LookupCutoff("bob", "other"); err != nil || !revokedBefore.IsZero() {
+		t.Errorf("LookupCutoff of purged cutoff = %v, %v", revokedBefore, err)
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	testStore(t, newTestBoltStore(t))
+}
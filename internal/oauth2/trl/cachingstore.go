@@ -0,0 +1,187 @@
+package trl
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const bloomFilterFalsePositiveRate = 0.001
+
+type cachingStore struct {
+	store         Store
+	mu            sync.Mutex
+	cacheDuration time.Duration
+	bloomFilter   *bloomFilter
+	cutoffs       map[Cutoff]time.Time
+	lookups       *lruCache
+	loadedAt      time.Time
+	loading       bool
+	// pendingTokens and pendingCutoffs are put while a reload runs, the reloaded snapshot may not contain them
+	pendingTokens  []string
+	pendingCutoffs map[Cutoff]time.Time
+}
+
+// NewCachingStore keeps a Bloom filter of the revoked token ids and the cutoffs of the store, reloaded after
+// cacheDuration. Only possibly revoked token ids are looked up in the store, the results are kept in an LRU cache
+// of cacheSize entries.
+func NewCachingStore(store Store, cacheDuration time.Duration, cacheSize int) Store {
+	return &cachingStore{store: store, cacheDuration: cacheDuration, lookups: newLRUCache(cacheSize)}
+}
+
+// outdated reports whether the cache has to be reloaded, a full Bloom filter is rebuilt early but not more often than
+// every tenth of the cache duration, the caller holds the lock
+func (s *cachingStore) outdated() bool {
+	var age = time.Since(s.loadedAt)
+	return age >= s.cacheDuration || (s.bloomFilter != nil && s.bloomFilter.Full() && age >= s.cacheDuration/10)
+}
+
+// refresh reloads the Bloom filter and cutoffs when they are outdated or the filter is full. The snapshot is read
+// without holding the lock, lookups use the previous filter meanwhile and only one reload runs at a time.
+func (s *cachingStore) refresh() {
+	s.mu.Lock()
+	if s.loading || !s.outdated() {
+		s.mu.Unlock()
+		return
+	}
+	s.loading = true
+	s.pendingTokens = nil
+	s.pendingCutoffs = map[Cutoff]time.Time{}
+	s.mu.Unlock()
+
+	log.Print("Loading token revocation list into cache")
+	var snapshot, err = s.store.Snapshot()
+	var bloomFilter *bloomFilter
+	if err == nil {
+		// room for the revocations until the next reload
+		bloomFilter = newBloomFilter(2*len(snapshot.RevokedTokens), bloomFilterFalsePositiveRate)
+		for tokenID := range snapshot.RevokedTokens {
+			bloomFilter.Add(tokenID)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = false
+	// retry after cacheDuration instead of with every lookup
+	s.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("!!! %s", err)
+		metrics.Add("cache_load_errors", 1)
+		if s.bloomFilter != nil {
+			log.Print("Falling back to previously cached token revocation list")
+		}
+		return
+	}
+	for _, tokenID := range s.pendingTokens {
+		bloomFilter.Add(tokenID)
+	}
+	for cutoff, revokedBefore := range s.pendingCutoffs {
+		if revokedBefore.After(snapshot.Cutoffs[cutoff]) {
+			snapshot.Cutoffs[cutoff] = revokedBefore
+		}
+	}
+	s.pendingTokens, s.pendingCutoffs = nil, nil
+	s.bloomFilter = bloomFilter
+	s.cutoffs = snapshot.Cutoffs
+	// cached lookup results may have been revoked by other instances in the meantime
+	s.lookups.Clear()
+}
+
+func (s *cachingStore) Put(tokenID string, expirationTime time.Time) error {
+	if err := s.store.Put(tokenID, expirationTime); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bloomFilter != nil {
+		s.bloomFilter.Add(tokenID)
+	}
+	if s.loading {
+		s.pendingTokens = append(s.pendingTokens, tokenID)
+	}
+	s.lookups.Put(tokenID, &RevokedToken{RevocationTime: time.Now(), ExpirationTime: expirationTime})
+	return nil
+}
+
+func (s *cachingStore) Lookup(tokenID string) (*RevokedToken, error) {
+	s.refresh()
+	s.mu.Lock()
+	if s.bloomFilter != nil {
+		if !s.bloomFilter.MayContain(tokenID) {
+			s.mu.Unlock()
+			metrics.Add("cache_hits", 1)
+			return nil, nil
+		}
+		if revokedToken, found := s.lookups.Get(tokenID); found {
+			s.mu.Unlock()
+			metrics.Add("cache_hits", 1)
+			if revokedToken != nil && revokedToken.ExpirationTime.Before(time.Now()) {
+				return nil, nil
+			}
+			return revokedToken, nil
+		}
+	}
+	var loadedAt = s.loadedAt
+	s.mu.Unlock()
+
+	metrics.Add("cache_misses", 1)
+	var revokedToken, err = s.store.Lookup(tokenID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the result is outdated when the token has been revoked or the cache reloaded during the lookup
+	if _, found := s.lookups.Get(tokenID); !found && loadedAt.Equal(s.loadedAt) {
+		s.lookups.Put(tokenID, revokedToken)
+	}
+	return revokedToken, nil
+}
+
+func (s *cachingStore) PutCutoff(userID, clientID string, revokedBefore time.Time) error {
+	if err := s.store.PutCutoff(userID, clientID, revokedBefore); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cutoff = Cutoff{userID, clientID}
+	if s.cutoffs != nil && revokedBefore.After(s.cutoffs[cutoff]) {
+		s.cutoffs[cutoff] = revokedBefore
+	}
+	if s.loading && revokedBefore.After(s.pendingCutoffs[cutoff]) {
+		s.pendingCutoffs[cutoff] = revokedBefore
+	}
+	return nil
+}
+
+func (s *cachingStore) LookupCutoff(userID, clientID string) (time.Time, error) {
+	s.refresh()
+	s.mu.Lock()
+	if s.cutoffs == nil {
+		s.mu.Unlock()
+		metrics.Add("cache_misses", 1)
+		return s.store.LookupCutoff(userID, clientID)
+	}
+	defer s.mu.Unlock()
+	metrics.Add("cache_hits", 1)
+	var revokedBefore time.Time
+	for _, cutoff := range matchingCutoffs(userID, clientID) {
+		if cutoffTime := s.cutoffs[cutoff]; cutoffTime.After(revokedBefore) {
+			revokedBefore = cutoffTime
+		}
+	}
+	return revokedBefore, nil
+}
+
+func (s *cachingStore) Purge(cutoffsBefore time.Time) (int64, error) {
+	return s.store.Purge(cutoffsBefore)
+}
+
+func (s *cachingStore) Snapshot() (*Snapshot, error) {
+	return s.store.Snapshot()
+}
+
+func (s *cachingStore) Ping() error {
+	return s.store.Ping()
+}
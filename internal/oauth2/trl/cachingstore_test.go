@@ -0,0 +1,109 @@
+package trl
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// blockingStore holds Snapshot until released
+type blockingStore struct {
+	Store
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Snapshot() (*Snapshot, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Store.Snapshot()
+}
+
+func TestCachingStoreReloadDoesNotBlock(t *testing.T) {
+	var store = &blockingStore{Store: newTestBoltStore(t), started: make(chan struct{}), release: make(chan struct{})}
+	var expiry = time.Now().Add(time.Hour)
+	if err := store.Put("revoked", expiry); err != nil {
+		t.Fatal(err)
+	}
+	var cachingStore = NewCachingStore(store, time.Hour, 100).(*cachingStore)
+
+	// initial load
+	go cachingStore.Lookup("revoked")
+	<-store.started
+	store.release <- struct{}{}
+	for {
+		cachingStore.mu.Lock()
+		var loaded = cachingStore.bloomFilter != nil
+		cachingStore.mu.Unlock()
+		if loaded {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// lookups and revocations during a reload use the previous filter
+	cachingStore.mu.Lock()
+	cachingStore.loadedAt = time.Time{}
+	cachingStore.mu.Unlock()
+	var reloaded = make(chan struct{})
+	go func() {
+		cachingStore.refresh()
+		close(reloaded)
+	}()
+	<-store.started
+	if revokedToken, err := cachingStore.Lookup("revoked"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup during reload = %v, %v", revokedToken, err)
+	}
+	if err := cachingStore.Put("during-reload", expiry); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachingStore.PutCutoff("alice", AnyID, expiry); err != nil {
+		t.Fatal(err)
+	}
+	// the snapshot is taken after the revocations above, the store forgets them to check the pending ones are kept
+	store.Store = newTestBoltStore(t)
+	store.release <- struct{}{}
+	<-reloaded
+
+	if !cachingStore.bloomFilter.MayContain("during-reload") {
+		t.Error("token revoked during reload missing from the Bloom filter")
+	}
+	if revokedBefore, err := cachingStore.LookupCutoff("alice", "app"); err != nil || !revokedBefore.Equal(expiry) {
+		t.Errorf("cutoff put during reload = %v, %v", revokedBefore, err)
+	}
+}
+
+func TestCachingStoreResizesBloomFilter(t *testing.T) {
+	var store = newTestBoltStore(t)
+	var cachingStore = NewCachingStore(store, time.Hour, 100).(*cachingStore)
+	if _, err := cachingStore.Lookup("unknown"); err != nil {
+		t.Fatal(err)
+	}
+	var capacity = cachingStore.bloomFilter.capacity
+
+	var expiry = time.Now().Add(time.Hour)
+	for i := range capacity + 1 {
+		if err := cachingStore.Put(fmt.Sprintf("token-%d", i), expiry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !cachingStore.bloomFilter.Full() {
+		t.Fatalf("Bloom filter of capacity %d not full after %d revocations", capacity, capacity+1)
+	}
+
+	// full filters are rebuilt early
+	cachingStore.mu.Lock()
+	cachingStore.loadedAt = time.Now().Add(-time.Hour / 5)
+	cachingStore.mu.Unlock()
+	if revokedToken, err := cachingStore.Lookup("token-0"); err != nil || revokedToken == nil {
+		t.Fatalf("Lookup = %v, %v", revokedToken, err)
+	}
+	if cachingStore.bloomFilter.Full() || cachingStore.bloomFilter.capacity < 2*(capacity+1) {
+		t.Errorf("Bloom filter capacity %d for %d revoked tokens", cachingStore.bloomFilter.capacity, cachingStore.bloomFilter.count)
+	}
+	for i := range capacity + 1 {
+		if !cachingStore.bloomFilter.MayContain(fmt.Sprintf("token-%d", i)) {
+			t.Fatalf("token-%d missing from the rebuilt Bloom filter", i)
+		}
+	}
+}
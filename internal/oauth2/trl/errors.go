@@ -0,0 +1,9 @@
+package trl
+
+import "errors"
+
+var (
+	ErrCutoffsNotConfigured  = errors.New("revocation cutoffs not configured")
+	ErrPurgeNotConfigured    = errors.New("revocation list purge not configured")
+	ErrSnapshotNotConfigured = errors.New("revocation list snapshot not configured")
+)
@@ -0,0 +1,48 @@
+package trl
+
+import (
+	"container/list"
+)
+
+type lruEntry struct {
+	tokenID      string
+	revokedToken *RevokedToken
+}
+
+// lruCache keeps the results of the most recent lookups, nil results included
+type lruCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{capacity: capacity, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+func (c *lruCache) Get(tokenID string) (*RevokedToken, bool) {
+	if element, found := c.entries[tokenID]; found {
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry).revokedToken, true
+	}
+	return nil, false
+}
+
+func (c *lruCache) Put(tokenID string, revokedToken *RevokedToken) {
+	if element, found := c.entries[tokenID]; found {
+		element.Value.(*lruEntry).revokedToken = revokedToken
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[tokenID] = c.order.PushFront(&lruEntry{tokenID, revokedToken})
+	if c.order.Len() > c.capacity {
+		var oldest = c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).tokenID)
+	}
+}
+
+func (c *lruCache) Clear() {
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
@@ -0,0 +1,8 @@
+package trl
+
+import (
+	"expvar"
+)
+
+// metrics of the token revocation list, published as "trl" with expvar
+var metrics = expvar.NewMap("trl")
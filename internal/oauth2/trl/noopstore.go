@@ -21,6 +21,23 @@ func (s *noopStore) Lookup(tokenID string) (*RevokedToken, error) {
 	return nil, nil
 }
 
+func (s *noopStore) PutCutoff(userID, clientID string, revokedBefore time.Time) error {
+	log.Printf("tokens of user %s and client %s issued before %v revoked", userID, clientID, revokedBefore)
+	return nil
+}
+
+func (s *noopStore) LookupCutoff(userID, clientID string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *noopStore) Purge(cutoffsBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *noopStore) Snapshot() (*Snapshot, error) {
+	return &Snapshot{RevokedTokens: map[string]RevokedToken{}, Cutoffs: map[Cutoff]time.Time{}}, nil
+}
+
 func (s *noopStore) Ping() error {
 	return nil
 }
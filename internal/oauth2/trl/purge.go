@@ -0,0 +1,30 @@
+package trl
+
+import (
+	"expvar"
+	"log"
+	"time"
+)
+
+var lastPurge = new(expvar.Int)
+
+func init() {
+	metrics.Set("last_purge", lastPurge)
+}
+
+// PurgeExpired removes expired entries and cutoffs older than cutoffTTL from the store and records the outcome in the
+// trl metrics
+func PurgeExpired(store Store, cutoffTTL time.Duration) {
+	var started = time.Now()
+	metrics.Add("purge_runs", 1)
+	if purged, err := store.Purge(started.Add(-cutoffTTL)); err != nil {
+		metrics.Add("purge_errors", 1)
+		log.Printf("!!! Purging token revocation list failed: %v", err)
+	} else {
+		metrics.Add("purged_entries", purged)
+		lastPurge.Set(started.Unix())
+		if purged > 0 {
+			log.Printf("Purged %d expired entries from token revocation list in %v", purged, time.Since(started))
+		}
+	}
+}
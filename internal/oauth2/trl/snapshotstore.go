@@ -0,0 +1,117 @@
+package trl
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type snapshotStore struct {
+	store          Store
+	mu             sync.RWMutex
+	cacheDuration  time.Duration
+	cachedSnapshot *Snapshot
+	cachedAt       time.Time
+}
+
+// NewSnapshotStore answers lookups from a snapshot of the store that is reloaded after cacheDuration, revocations
+// made by other instances become visible with the next reload
+func NewSnapshotStore(store Store, cacheDuration time.Duration) Store {
+	return &snapshotStore{store: store, cacheDuration: cacheDuration}
+}
+
+func (s *snapshotStore) snapshot() (*Snapshot, error) {
+	s.mu.RLock()
+	if s.cachedSnapshot != nil && time.Since(s.cachedAt) < s.cacheDuration {
+		defer s.mu.RUnlock()
+		return s.cachedSnapshot, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cachedSnapshot != nil && time.Since(s.cachedAt) < s.cacheDuration {
+		return s.cachedSnapshot, nil
+	}
+	log.Print("Loading token revocation list snapshot")
+	if snapshot, err := s.store.Snapshot(); err != nil {
+		if s.cachedSnapshot != nil {
+			log.Printf("!!! %s", err)
+			log.Printf("Falling back to token revocation list snapshot loaded at %s", s.cachedAt.Format(time.DateTime))
+			return s.cachedSnapshot, nil
+		}
+		return nil, err
+	} else {
+		s.cachedSnapshot = snapshot
+		s.cachedAt = time.Now()
+		return snapshot, nil
+	}
+}
+
+func (s *snapshotStore) Put(tokenID string, expirationTime time.Time) error {
+	if err := s.store.Put(tokenID, expirationTime); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cachedSnapshot != nil {
+		s.cachedSnapshot.RevokedTokens[tokenID] = RevokedToken{RevocationTime: time.Now(), ExpirationTime: expirationTime}
+	}
+	return nil
+}
+
+func (s *snapshotStore) Lookup(tokenID string) (*RevokedToken, error) {
+	var snapshot, err = s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if revokedToken, found := snapshot.RevokedTokens[tokenID]; found && !revokedToken.ExpirationTime.Before(time.Now()) {
+		return &revokedToken, nil
+	}
+	return nil, nil
+}
+
+func (s *snapshotStore) PutCutoff(userID, clientID string, revokedBefore time.Time) error {
+	if err := s.store.PutCutoff(userID, clientID, revokedBefore); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cachedSnapshot != nil {
+		var cutoff = Cutoff{userID, clientID}
+		if revokedBefore.After(s.cachedSnapshot.Cutoffs[cutoff]) {
+			s.cachedSnapshot.Cutoffs[cutoff] = revokedBefore
+		}
+	}
+	return nil
+}
+
+func (s *snapshotStore) LookupCutoff(userID, clientID string) (time.Time, error) {
+	var revokedBefore time.Time
+	var snapshot, err = s.snapshot()
+	if err != nil {
+		return revokedBefore, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, cutoff := range matchingCutoffs(userID, clientID) {
+		if cutoffTime := snapshot.Cutoffs[cutoff]; cutoffTime.After(revokedBefore) {
+			revokedBefore = cutoffTime
+		}
+	}
+	return revokedBefore, nil
+}
+
+func (s *snapshotStore) Purge(cutoffsBefore time.Time) (int64, error) {
+	return s.store.Purge(cutoffsBefore)
+}
+
+func (s *snapshotStore) Snapshot() (*Snapshot, error) {
+	return s.store.Snapshot()
+}
+
+func (s *snapshotStore) Ping() error {
+	return s.store.Ping()
+}
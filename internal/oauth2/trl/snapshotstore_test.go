@@ -0,0 +1,129 @@
+package trl
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingStore fails to take snapshots while err is set
+type failingStore struct {
+	Store
+	err error
+}
+
+func (f *failingStore) Snapshot() (*Snapshot, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Store.Snapshot()
+}
+
+func TestSnapshotStoreLoad(t *testing.T) {
+	var (
+		store         = newTestBoltStore(t)
+		expiry        = time.Now().Add(time.Hour)
+		revokedBefore = time.Now().Round(0)
+	)
+	// revocations of other instances before the first lookup
+	if err := store.Put("first", expiry); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutCutoff("alice", AnyID, revokedBefore); err != nil {
+		t.Fatal(err)
+	}
+	var snapshotStore = NewSnapshotStore(store, time.Hour).(*snapshotStore)
+
+	if revokedToken, err := snapshotStore.Lookup("first"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup = %+v, %v", revokedToken, err)
+	}
+	if cutoff, err := snapshotStore.LookupCutoff("alice", "app"); err != nil || !cutoff.Equal(revokedBefore) {
+		t.Errorf("LookupCutoff = %v, %v", cutoff, err)
+	}
+
+	// revocations of other instances become visible with the next reload
+	if err := store.Put("second", expiry); err != nil {
+		t.Fatal(err)
+	}
+	if revokedToken, err := snapshotStore.Lookup("second"); err != nil || revokedToken != nil {
+		t.Errorf("Lookup before reload = %+v, %v", revokedToken, err)
+	}
+	snapshotStore.cachedAt = time.Now().Add(-time.Hour)
+	if revokedToken, err := snapshotStore.Lookup("second"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup after reload = %+v, %v", revokedToken, err)
+	}
+}
+
+func TestSnapshotStoreFallback(t *testing.T) {
+	var store = &failingStore{Store: newTestBoltStore(t), err: ErrSnapshotNotConfigured}
+	if err := store.Put("revoked", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var snapshotStore = NewSnapshotStore(store, time.Hour).(*snapshotStore)
+
+	if _, err := snapshotStore.Lookup("revoked"); !errors.Is(err, ErrSnapshotNotConfigured) {
+		t.Errorf("Lookup without snapshot = %v", err)
+	}
+	store.err = nil
+	if revokedToken, err := snapshotStore.Lookup("revoked"); err != nil || revokedToken == nil {
+		t.Fatalf("Lookup = %+v, %v", revokedToken, err)
+	}
+
+	// the last snapshot is used while reloading fails
+	store.err = errors.New("database down")
+	snapshotStore.cachedAt = time.Now().Add(-time.Hour)
+	if revokedToken, err := snapshotStore.Lookup("revoked"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup with failing reload = %+v, %v", revokedToken, err)
+	}
+}
+
+func TestSnapshotStorePersists(t *testing.T) {
+	var filename = filepath.Join(t.TempDir(), "trl.db")
+	var store, err = NewBoltStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		snapshotStore = NewSnapshotStore(store, time.Hour)
+		revokedBefore = time.Now().Round(0)
+	)
+	// revocations are visible at once and written to the store
+	if _, err := snapshotStore.Lookup("revoked"); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotStore.Put("revoked", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotStore.Put("expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotStore.PutCutoff(AnyID, "app", revokedBefore); err != nil {
+		t.Fatal(err)
+	}
+	if revokedToken, err := snapshotStore.Lookup("revoked"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup = %+v, %v", revokedToken, err)
+	}
+	if revokedToken, err := snapshotStore.Lookup("expired"); err != nil || revokedToken != nil {
+		t.Errorf("Lookup of expired token = %+v, %v", revokedToken, err)
+	}
+	if cutoff, err := snapshotStore.LookupCutoff("bob", "app"); err != nil || !cutoff.Equal(revokedBefore) {
+		t.Errorf("LookupCutoff = %v, %v", cutoff, err)
+	}
+
+	// a restarted instance loads them from the store
+	if err := store.(*boltStore).db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = NewBoltStore(filename); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.(*boltStore).db.Close() })
+	snapshotStore = NewSnapshotStore(store, time.Hour)
+	if revokedToken, err := snapshotStore.Lookup("revoked"); err != nil || revokedToken == nil {
+		t.Errorf("Lookup after restart = %+v, %v", revokedToken, err)
+	}
+	if cutoff, err := snapshotStore.LookupCutoff("bob", "app"); err != nil || !cutoff.Equal(revokedBefore) {
+		t.Errorf("LookupCutoff after restart = %v, %v", cutoff, err)
+	}
+}
@@ -3,6 +3,7 @@ package trl
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/blockloop/scan/v2"
 	"github.com/cwkr/authd/internal/sqlutil"
 	"log"
@@ -51,6 +52,116 @@ func (s *sqlStore) Lookup(tokenID string) (*RevokedToken, error) {
 	return &revokedToken, nil
 }
 
+func (s *sqlStore) PutCutoff(userID, clientID string, revokedBefore time.Time) error {
+	if s.settings.InsertCutoff == "" {
+		return ErrCutoffsNotConfigured
+	}
+	log.Printf("SQL: %s; -- %s, %s, %v", s.settings.InsertCutoff, userID, clientID, revokedBefore)
+	// INSERT INTO token_revocation_cutoffs (user_id, client_id, rvb) VALUES ($1, $2, $3)
+	// ON CONFLICT (user_id, client_id) DO UPDATE SET rvb = GREATEST(token_revocation_cutoffs.rvb, excluded.rvb)
+	_, err := s.dbconn.Exec(s.settings.InsertCutoff, userID, clientID, revokedBefore)
+	return err
+}
+
+func (s *sqlStore) LookupCutoff(userID, clientID string) (time.Time, error) {
+	var revokedBefore sql.NullTime
+
+	if s.settings.QueryCutoff == "" {
+		return time.Time{}, nil
+	}
+	log.Printf("SQL: %s; -- %s, %s", s.settings.QueryCutoff, userID, clientID)
+	// SELECT max(rvb) FROM token_revocation_cutoffs WHERE user_id IN ($1, '*') AND client_id IN ($2, '*')
+	if err := s.dbconn.QueryRow(s.settings.QueryCutoff, userID, clientID).Scan(&revokedBefore); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		log.Printf("!!! Query for revocation cutoff failed: %v", err)
+		return time.Time{}, err
+	}
+	return revokedBefore.Time, nil
+}
+
+func (s *sqlStore) Purge(cutoffsBefore time.Time) (int64, error) {
+	if s.settings.Purge == "" {
+		return 0, fmt.Errorf("%w: purge", ErrPurgeNotConfigured)
+	}
+	log.Printf("SQL: %s", s.settings.Purge)
+	// DELETE FROM token_revocation_list WHERE exp < current_timestamp
+	result, err := s.dbconn.Exec(s.settings.Purge)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil || s.settings.InsertCutoff == "" {
+		return purged, err
+	}
+	if s.settings.PurgeCutoffs == "" {
+		return purged, fmt.Errorf("%w: purge_cutoffs", ErrPurgeNotConfigured)
+	}
+	log.Printf("SQL: %s; -- %v", s.settings.PurgeCutoffs, cutoffsBefore)
+	// DELETE FROM token_revocation_cutoffs WHERE rvb < $1
+	if result, err = s.dbconn.Exec(s.settings.PurgeCutoffs, cutoffsBefore); err != nil {
+		return purged, err
+	}
+	purgedCutoffs, err := result.RowsAffected()
+	return purged + purgedCutoffs, err
+}
+
+func (s *sqlStore) Snapshot() (*Snapshot, error) {
+	var snapshot = Snapshot{RevokedTokens: map[string]RevokedToken{}, Cutoffs: map[Cutoff]time.Time{}}
+
+	if s.settings.QueryAll == "" {
+		return nil, ErrSnapshotNotConfigured
+	}
+
+	log.Printf("SQL: %s", s.settings.QueryAll)
+	// SELECT jti, rvt, exp FROM token_revocation_list WHERE exp >= current_timestamp
+	rows, err := s.dbconn.Query(s.settings.QueryAll)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			tokenID      string
+			revokedToken RevokedToken
+		)
+		if err := rows.Scan(&tokenID, &revokedToken.RevocationTime, &revokedToken.ExpirationTime); err != nil {
+			return nil, err
+		}
+		snapshot.RevokedTokens[tokenID] = revokedToken
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.settings.QueryAllCutoffs == "" {
+		return &snapshot, nil
+	}
+
+	log.Printf("SQL: %s", s.settings.QueryAllCutoffs)
+	// SELECT user_id, client_id, rvb FROM token_revocation_cutoffs
+	cutoffRows, err := s.dbconn.Query(s.settings.QueryAllCutoffs)
+	if err != nil {
+		return nil, err
+	}
+	defer cutoffRows.Close()
+	for cutoffRows.Next() {
+		var (
+			cutoff        Cutoff
+			revokedBefore time.Time
+		)
+		if err := cutoffRows.Scan(&cutoff.UserID, &cutoff.ClientID, &revokedBefore); err != nil {
+			return nil, err
+		}
+		snapshot.Cutoffs[cutoff] = revokedBefore
+	}
+	if err := cutoffRows.Err(); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
 func (s *sqlStore) Ping() error {
 	return s.dbconn.Ping()
 }
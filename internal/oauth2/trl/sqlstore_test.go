@@ -0,0 +1,218 @@
+package trl
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDatabase answers the statements of sqlStoreSettings like the example statements in the README
+type fakeDatabase struct {
+	mu            sync.Mutex
+	revokedTokens map[string]RevokedToken
+	cutoffs       map[Cutoff]time.Time
+}
+
+var sqlStoreSettings = StoreSettings{
+	URI:             "postgresql://fake",
+	Query:           "query",
+	Insert:          "insert",
+	QueryCutoff:     "query_cutoff",
+	InsertCutoff:    "insert_cutoff",
+	QueryAll:        "query_all",
+	QueryAllCutoffs: "query_all_cutoffs",
+	Purge:           "purge",
+	PurgeCutoffs:    "purge_cutoffs",
+}
+
+func (f *fakeDatabase) exec(query string, args []driver.Value) (int64, error) {
+	var now = time.Now()
+	switch query {
+	case "insert":
+		if _, found := f.revokedTokens[args[0].(string)]; !found {
+			f.revokedTokens[args[0].(string)] = RevokedToken{RevocationTime: now, ExpirationTime: args[1].(time.Time)}
+		}
+	case "insert_cutoff":
+		var cutoff = Cutoff{args[0].(string), args[1].(string)}
+		if revokedBefore := args[2].(time.Time); revokedBefore.After(f.cutoffs[cutoff]) {
+			f.cutoffs[cutoff] = revokedBefore
+		}
+	case "purge":
+		var purged int64
+		for tokenID, revokedToken := range f.revokedTokens {
+			if revokedToken.ExpirationTime.Before(now) {
+				delete(f.revokedTokens, tokenID)
+				purged++
+			}
+		}
+		return purged, nil
+	case "purge_cutoffs":
+		var purged int64
+		for cutoff, revokedBefore := range f.cutoffs {
+			if revokedBefore.Before(args[0].(time.Time)) {
+				delete(f.cutoffs, cutoff)
+				purged++
+			}
+		}
+		return purged, nil
+	default:
+		return 0, fmt.Errorf("unexpected statement %q", query)
+	}
+	return 1, nil
+}
+
+func (f *fakeDatabase) query(query string, args []driver.Value) (*fakeRows, error) {
+	var now = time.Now()
+	switch query {
+	case "query":
+		var rows = &fakeRows{columns: []string{"rvt", "exp"}}
+		if revokedToken, found := f.revokedTokens[args[0].(string)]; found && !revokedToken.ExpirationTime.Before(now) {
+			rows.values = append(rows.values, []driver.Value{revokedToken.RevocationTime, revokedToken.ExpirationTime})
+		}
+		return rows, nil
+	case "query_cutoff":
+		var revokedBefore driver.Value
+		for _, cutoff := range matchingCutoffs(args[0].(string), args[1].(string)) {
+			if cutoffTime, found := f.cutoffs[cutoff]; found && (revokedBefore == nil || cutoffTime.After(revokedBefore.(time.Time))) {
+				revokedBefore = cutoffTime
+			}
+		}
+		return &fakeRows{columns: []string{"max"}, values: [][]driver.Value{{revokedBefore}}}, nil
+	case "query_all":
+		var rows = &fakeRows{columns: []string{"jti", "rvt", "exp"}}
+		for tokenID, revokedToken := range f.revokedTokens {
+			if !revokedToken.ExpirationTime.Before(now) {
+				rows.values = append(rows.values, []driver.Value{tokenID, revokedToken.RevocationTime, revokedToken.ExpirationTime})
+			}
+		}
+		return rows, nil
+	case "query_all_cutoffs":
+		var rows = &fakeRows{columns: []string{"user_id", "client_id", "rvb"}}
+		for cutoff, revokedBefore := range f.cutoffs {
+			rows.values = append(rows.values, []driver.Value{cutoff.UserID, cutoff.ClientID, revokedBefore})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+func (f *fakeDatabase) Open(name string) (driver.Conn, error) {
+	return &fakeConn{f}, nil
+}
+
+type fakeConnector struct {
+	database *fakeDatabase
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{c.database}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return c.database
+}
+
+type fakeConn struct {
+	database *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.database, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeStmt struct {
+	database *fakeDatabase
+	query    string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.database.mu.Lock()
+	defer s.database.mu.Unlock()
+	var rowsAffected, err = s.database.exec(s.query, args)
+	return driver.RowsAffected(rowsAffected), err
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.database.mu.Lock()
+	defer s.database.mu.Unlock()
+	return s.database.query(s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newTestSqlStore(t *testing.T, settings StoreSettings) Store {
+	// every store gets a database of its own
+	var db = sql.OpenDB(&fakeConnector{&fakeDatabase{revokedTokens: map[string]RevokedToken{}, cutoffs: map[Cutoff]time.Time{}}})
+	t.Cleanup(func() { db.Close() })
+	var store, err = NewSqlStore(map[string]*sql.DB{settings.URI: db}, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSqlStore(t *testing.T) {
+	testStore(t, newTestSqlStore(t, sqlStoreSettings))
+}
+
+func TestSqlStorePurgeNotConfigured(t *testing.T) {
+	var settings = sqlStoreSettings
+	settings.PurgeCutoffs = ""
+	if _, err := newTestSqlStore(t, settings).Purge(time.Now()); !errors.Is(err, ErrPurgeNotConfigured) {
+		t.Errorf("Purge without purge_cutoffs = %v", err)
+	}
+
+	settings.Purge = ""
+	if _, err := newTestSqlStore(t, settings).Purge(time.Now()); !errors.Is(err, ErrPurgeNotConfigured) {
+		t.Errorf("Purge without purge = %v", err)
+	}
+
+	// without cutoffs there is nothing else to purge
+	settings = sqlStoreSettings
+	settings.InsertCutoff, settings.PurgeCutoffs = "", ""
+	if _, err := newTestSqlStore(t, settings).Purge(time.Now()); err != nil {
+		t.Errorf("Purge without cutoffs = %v", err)
+	}
+}
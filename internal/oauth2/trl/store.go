@@ -4,13 +4,46 @@ import (
 	"time"
 )
 
+// AnyID matches every user or every client in revocation cutoffs
+const AnyID = "*"
+
 type RevokedToken struct {
 	RevocationTime time.Time `db:"rvt"`
 	ExpirationTime time.Time `db:"exp"`
 }
 
+type Cutoff struct {
+	UserID   string `db:"user_id"`
+	ClientID string `db:"client_id"`
+}
+
+// Snapshot holds all revoked tokens and cutoffs of a store at one point in time
+type Snapshot struct {
+	RevokedTokens map[string]RevokedToken
+	Cutoffs       map[Cutoff]time.Time
+}
+
 type Store interface {
 	Put(tokenID string, expirationTime time.Time) error
 	Lookup(tokenID string) (*RevokedToken, error)
+	// PutCutoff revokes all tokens of a user and client issued before revokedBefore, AnyID matches all users or clients
+	PutCutoff(userID, clientID string, revokedBefore time.Time) error
+	// LookupCutoff returns the latest cutoff that applies to tokens of a user and client, the zero time if there is none
+	LookupCutoff(userID, clientID string) (time.Time, error)
+	// Purge removes revoked tokens past their expiration time and cutoffs before cutoffsBefore, tokens issued before
+	// these cutoffs have expired. It returns the number of removed entries.
+	Purge(cutoffsBefore time.Time) (int64, error)
+	// Snapshot returns all revoked tokens that have not expired and all cutoffs
+	Snapshot() (*Snapshot, error)
 	Ping() error
 }
+
+// matchingCutoffs returns the cutoffs that apply to tokens of a user and client
+func matchingCutoffs(userID, clientID string) []Cutoff {
+	return []Cutoff{
+		{userID, clientID},
+		{userID, AnyID},
+		{AnyID, clientID},
+		{AnyID, AnyID},
+	}
+}
@@ -1,7 +1,18 @@
 package trl
 
 type StoreSettings struct {
-	URI    string `json:"uri,omitempty"`
-	Query  string `json:"query,omitempty"`
-	Insert string `json:"insert,omitempty"`
+	URI             string `json:"uri,omitempty"`
+	Query           string `json:"query,omitempty"`
+	Insert          string `json:"insert,omitempty"`
+	QueryCutoff     string `json:"query_cutoff,omitempty"`
+	InsertCutoff    string `json:"insert_cutoff,omitempty"`
+	QueryAll        string `json:"query_all,omitempty"`
+	QueryAllCutoffs string `json:"query_all_cutoffs,omitempty"`
+	Purge           string `json:"purge,omitempty"`
+	PurgeCutoffs    string `json:"purge_cutoffs,omitempty"`
+	PurgeInterval   int    `json:"purge_interval,omitempty"`
+	// CutoffTTL is the number of seconds cutoffs are kept, it defaults to the longest token and session lifetime
+	CutoffTTL int `json:"cutoff_ttl,omitempty"`
+	CacheTTL  int `json:"cache_ttl,omitempty"`
+	CacheSize int `json:"cache_size,omitempty"`
 }
@@ -3,13 +3,17 @@ package oauth2
 import (
 	"encoding/json"
 	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2/clients"
 	"github.com/cwkr/authd/internal/people"
 	"log"
 	"net/http"
+	"strings"
 )
 
 type userInfoHandler struct {
+	tokenCreator TokenCreator
 	peopleStore  people.Store
+	clientStore  clients.Store
 	extraClaims  map[string]string
 	roleMappings RoleMappings
 }
@@ -25,20 +29,69 @@ func (u *userInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var userID = r.Context().Value("user_id").(string)
+	var clientID, _ = r.Context().Value("client_id").(string)
+	var scope, _ = r.Context().Value("scope").(string)
+	var claimsRequest, _ = r.Context().Value("claims").(*ClaimsRequest)
+
+	var client = clients.Client{ClientID: clientID}
+	if clientID != "" {
+		if c, err := u.clientStore.Lookup(clientID); err == nil {
+			client = *c
+		} else {
+			log.Printf("!!! %s", err)
+			Error(w, ErrorInvalidClient, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var subject = userID
+	if resolvedUserID, err := u.tokenCreator.ResolveSubject(client, subject); err == nil {
+		userID = resolvedUserID
+	} else {
+		log.Printf("!!! %s", err)
+		Error(w, ErrorInvalidToken, err.Error(), http.StatusUnauthorized)
+		return
+	}
 
 	if person, err := u.peopleStore.Lookup(userID); err == nil {
 
 		var user = User{*person, userID}
 
 		var claims = map[string]any{
-			ClaimSubject: userID,
+			ClaimSubject: subject,
 		}
 
-		AddProfileClaims(claims, user)
-		AddEmailClaims(claims, user)
-		AddPhoneClaims(claims, user)
-		AddAddressClaims(claims, user)
-		AddExtraClaims(claims, u.extraClaims, user, "", u.roleMappings)
+		var releasedUser = ReleasedUser(user, client)
+		if strings.Contains(scope, "profile") {
+			AddProfileClaims(claims, releasedUser)
+		}
+		if strings.Contains(scope, "email") {
+			AddEmailClaims(claims, releasedUser)
+		}
+		if strings.Contains(scope, "phone") {
+			AddPhoneClaims(claims, releasedUser)
+		}
+		if strings.Contains(scope, "address") {
+			AddAddressClaims(claims, releasedUser)
+		}
+		if claimsRequest != nil {
+			AddRequestedClaims(claims, claimsRequest.UserInfo, releasedUser)
+		}
+		AddExtraClaims(claims, MergeExtraClaims(u.extraClaims, client.AccessTokenExtraClaims), user, client, u.roleMappings)
+
+		httputil.NoCache(w)
+
+		if client.UserinfoSignedResponseAlg != "" || client.UserinfoEncryptedResponseAlg != "" {
+			var response, err = u.tokenCreator.GenerateUserInfoResponse(claims, client)
+			if err != nil {
+				log.Printf("!!! %s", err)
+				Error(w, ErrorInternal, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/jwt")
+			w.Write([]byte(response))
+			return
+		}
 
 		var bytes, err = json.Marshal(claims)
 		if err != nil {
@@ -46,7 +99,6 @@ func (u *userInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		httputil.NoCache(w)
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(bytes)
 	} else {
@@ -54,9 +106,11 @@ func (u *userInfoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func UserInfoHandler(peopleStore people.Store, extraClaims map[string]string, roleMappings RoleMappings) http.Handler {
+func UserInfoHandler(tokenCreator TokenCreator, peopleStore people.Store, clientStore clients.Store, extraClaims map[string]string, roleMappings RoleMappings) http.Handler {
 	return &userInfoHandler{
+		tokenCreator: tokenCreator,
 		peopleStore:  peopleStore,
+		clientStore:  clientStore,
 		extraClaims:  extraClaims,
 		roleMappings: roleMappings,
 	}
@@ -0,0 +1,94 @@
+package passkeys
+
+import (
+	"encoding/json"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+// BoltURIPrefix marks store uris that name a bbolt database file, relative paths are resolved against the settings file
+const BoltURIPrefix = "bolt:"
+
+var bucketCredentials = []byte("webauthn_credentials")
+
+type storedCredential struct {
+	UserID     string              `json:"user_id"`
+	Credential webauthn.Credential `json:"credential"`
+}
+
+type boltStore struct {
+	db *bbolt.DB
+}
+
+func IsBoltURI(uri string) bool {
+	return strings.HasPrefix(uri, BoltURIPrefix)
+}
+
+func NewBoltStore(filename string) (Store, error) {
+	var db, err = bbolt.Open(filename, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketCredentials)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) List(userID string) ([]webauthn.Credential, error) {
+	var credentials []webauthn.Credential
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketCredentials).ForEach(func(_, value []byte) error {
+			var stored storedCredential
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			if strings.EqualFold(stored.UserID, userID) {
+				credentials = append(credentials, stored.Credential)
+			}
+			return nil
+		})
+	})
+	return credentials, err
+}
+
+func (s *boltStore) Lookup(credentialID []byte) (string, *webauthn.Credential, error) {
+	var stored *storedCredential
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket(bucketCredentials).Get(credentialID); value != nil {
+			stored = &storedCredential{}
+			return json.Unmarshal(value, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if stored == nil {
+		return "", nil, ErrCredentialNotFound
+	}
+	return stored.UserID, &stored.Credential, nil
+}
+
+func (s *boltStore) Put(userID string, credential webauthn.Credential) error {
+	var value, err = json.Marshal(storedCredential{UserID: userID, Credential: credential})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketCredentials).Put(credential.ID, value)
+	})
+}
+
+func (s *boltStore) Ping() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
@@ -0,0 +1,8 @@
+package passkeys
+
+import "errors"
+
+var (
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrUserHandleMismatch = errors.New("user handle does not match credential owner")
+)
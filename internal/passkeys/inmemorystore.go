@@ -0,0 +1,63 @@
+package passkeys
+
+import (
+	"bytes"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"strings"
+	"sync"
+)
+
+type registeredCredential struct {
+	userID     string
+	credential webauthn.Credential
+}
+
+type inMemoryStore struct {
+	mu          sync.Mutex
+	credentials []registeredCredential
+}
+
+func NewInMemoryStore() Store {
+	return &inMemoryStore{}
+}
+
+func (s *inMemoryStore) List(userID string) ([]webauthn.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var credentials []webauthn.Credential
+	for _, c := range s.credentials {
+		if strings.EqualFold(c.userID, userID) {
+			credentials = append(credentials, c.credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (s *inMemoryStore) Lookup(credentialID []byte) (string, *webauthn.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.credentials {
+		if bytes.Equal(c.credential.ID, credentialID) {
+			var credential = c.credential
+			return c.userID, &credential, nil
+		}
+	}
+	return "", nil, ErrCredentialNotFound
+}
+
+func (s *inMemoryStore) Put(userID string, credential webauthn.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.credentials {
+		if bytes.Equal(c.credential.ID, credential.ID) {
+			s.credentials[i].credential = credential
+			return nil
+		}
+	}
+	s.credentials = append(s.credentials, registeredCredential{userID: userID, credential: credential})
+	return nil
+}
+
+func (s *inMemoryStore) Ping() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+package passkeys
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+	"net/url"
+)
+
+// Settings describe the relying party; the issuer host and origin are used when left empty
+type Settings struct {
+	RPID          string   `json:"rp_id,omitempty"`
+	RPDisplayName string   `json:"rp_display_name,omitempty"`
+	RPOrigins     []string `json:"rp_origins,omitempty"`
+}
+
+func NewWebAuthn(settings Settings, issuer, title string) (*webauthn.WebAuthn, error) {
+	var issuerURL, err = url.Parse(issuer)
+	if err != nil {
+		return nil, err
+	}
+	var config = webauthn.Config{
+		RPID:          settings.RPID,
+		RPDisplayName: settings.RPDisplayName,
+		RPOrigins:     settings.RPOrigins,
+	}
+	if config.RPID == "" {
+		config.RPID = issuerURL.Hostname()
+	}
+	if config.RPDisplayName == "" {
+		config.RPDisplayName = title
+	}
+	if config.RPDisplayName == "" {
+		config.RPDisplayName = config.RPID
+	}
+	if len(config.RPOrigins) == 0 {
+		config.RPOrigins = []string{issuerURL.Scheme + "://" + issuerURL.Host}
+	}
+	return webauthn.New(&config)
+}
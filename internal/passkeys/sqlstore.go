@@ -0,0 +1,96 @@
+package passkeys
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/cwkr/authd/internal/sqlutil"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"log"
+)
+
+type sqlStore struct {
+	dbconn   *sql.DB
+	settings *StoreSettings
+}
+
+func NewSqlStore(dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
+		return nil, err
+	} else {
+		return &sqlStore{
+			dbconn:   dbconn,
+			settings: settings,
+		}, nil
+	}
+}
+
+func (s *sqlStore) List(userID string) ([]webauthn.Credential, error) {
+	log.Printf("SQL: %s; -- %s", s.settings.Query, userID)
+	// SELECT credential FROM webauthn_credentials WHERE lower(user_id) = lower($1)
+	var rows, err = s.dbconn.Query(s.settings.Query, userID)
+	if err != nil {
+		log.Printf("!!! Query for webauthn credentials failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var credentials []webauthn.Credential
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(value), &credential); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+func (s *sqlStore) Lookup(credentialID []byte) (string, *webauthn.Credential, error) {
+	var id = base64.RawURLEncoding.EncodeToString(credentialID)
+	var userID, value string
+
+	log.Printf("SQL: %s; -- %s", s.settings.QueryByID, id)
+	// SELECT user_id, credential FROM webauthn_credentials WHERE credential_id = $1
+	if err := s.dbconn.QueryRow(s.settings.QueryByID, id).Scan(&userID, &value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrCredentialNotFound
+		}
+		log.Printf("!!! Query for webauthn credential failed: %v", err)
+		return "", nil, err
+	}
+	var credential webauthn.Credential
+	if err := json.Unmarshal([]byte(value), &credential); err != nil {
+		return "", nil, err
+	}
+	return userID, &credential, nil
+}
+
+func (s *sqlStore) Put(userID string, credential webauthn.Credential) error {
+	var id = base64.RawURLEncoding.EncodeToString(credential.ID)
+	var value, err = json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SQL: %s; -- %s", s.settings.Update, id)
+	// UPDATE webauthn_credentials SET credential = $2, last_used = now() WHERE credential_id = $1
+	if result, err := s.dbconn.Exec(s.settings.Update, id, string(value)); err != nil {
+		return err
+	} else if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+		return err
+	}
+
+	log.Printf("SQL: %s; -- %s, %s", s.settings.Insert, id, userID)
+	// INSERT INTO webauthn_credentials (credential_id, user_id, credential) VALUES ($1, $2, $3)
+	_, err = s.dbconn.Exec(s.settings.Insert, id, userID, string(value))
+	return err
+}
+
+func (s *sqlStore) Ping() error {
+	return s.dbconn.Ping()
+}
@@ -0,0 +1,16 @@
+package passkeys
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Store keeps the WebAuthn credentials users registered
+type Store interface {
+	// List returns the credentials registered by the user
+	List(userID string) ([]webauthn.Credential, error)
+	// Lookup returns the owner of the credential, ErrCredentialNotFound for unknown credentials
+	Lookup(credentialID []byte) (string, *webauthn.Credential, error)
+	// Put adds a credential or updates its signature counter
+	Put(userID string, credential webauthn.Credential) error
+	Ping() error
+}
@@ -0,0 +1,9 @@
+package passkeys
+
+type StoreSettings struct {
+	URI       string `json:"uri,omitempty"`
+	Query     string `json:"query,omitempty"`
+	QueryByID string `json:"query_by_id,omitempty"`
+	Insert    string `json:"insert,omitempty"`
+	Update    string `json:"update,omitempty"`
+}
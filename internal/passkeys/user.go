@@ -0,0 +1,55 @@
+package passkeys
+
+import (
+	"github.com/cwkr/authd/internal/people"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"strings"
+)
+
+// User adapts a person to the webauthn library, the user handle is the lower case user id
+type User struct {
+	UserID      string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (u User) WebAuthnID() []byte {
+	return []byte(strings.ToLower(u.UserID))
+}
+
+func (u User) WebAuthnName() string {
+	return u.UserID
+}
+
+func (u User) WebAuthnDisplayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.UserID
+}
+
+func (u User) WebAuthnIcon() string {
+	return ""
+}
+
+func (u User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// CredentialDescriptors lists the credentials to exclude from another registration
+func (u User) CredentialDescriptors() []protocol.CredentialDescriptor {
+	var descriptors = make([]protocol.CredentialDescriptor, 0, len(u.Credentials))
+	for _, credential := range u.Credentials {
+		descriptors = append(descriptors, credential.Descriptor())
+	}
+	return descriptors
+}
+
+// AuthMethod tells synced passkeys, whose private keys leave the device, from device-bound security keys
+func AuthMethod(credential webauthn.Credential) string {
+	if credential.Flags.BackupEligible {
+		return people.MethodSoftwareKey
+	}
+	return people.MethodHardwareKey
+}
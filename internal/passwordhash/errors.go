@@ -0,0 +1,8 @@
+package passwordhash
+
+import "errors"
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported password hash algorithm")
+	ErrMalformedHash        = errors.New("malformed password hash")
+)
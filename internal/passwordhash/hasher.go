@@ -0,0 +1,141 @@
+package passwordhash
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	AlgorithmBcrypt       = "bcrypt"
+	AlgorithmArgon2id     = "argon2id"
+	AlgorithmScrypt       = "scrypt"
+	AlgorithmPBKDF2SHA256 = "pbkdf2-sha256"
+
+	saltLength = 16
+	keyLength  = 32
+)
+
+// Settings select the algorithm new password hashes are created with. Cost is the bcrypt cost, the argon2id time
+// cost, the base 2 logarithm of the scrypt work factor N or the PBKDF2 iteration count. Memory is the argon2id memory
+// in KiB and Parallelism the argon2id threads or the scrypt parallelization.
+type Settings struct {
+	Algorithm   string `json:"algorithm,omitempty"`
+	Cost        int    `json:"cost,omitempty"`
+	Memory      int    `json:"memory,omitempty"`
+	Parallelism int    `json:"parallelism,omitempty"`
+}
+
+// Hasher creates password hashes with the configured algorithm and cost
+type Hasher struct {
+	settings Settings
+}
+
+// DefaultSettings are used when no password hashing is configured
+var DefaultSettings = Settings{Algorithm: AlgorithmBcrypt, Cost: 12}
+
+func NewHasher(settings Settings) (*Hasher, error) {
+	switch settings.Algorithm {
+	case "", AlgorithmBcrypt:
+		settings.Algorithm = AlgorithmBcrypt
+		if settings.Cost == 0 {
+			settings.Cost = 12
+		}
+		if settings.Cost < bcrypt.MinCost || settings.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost: %d", settings.Cost)
+		}
+	case AlgorithmArgon2id:
+		if settings.Cost == 0 {
+			settings.Cost = 3
+		}
+		if settings.Memory == 0 {
+			settings.Memory = 64 * 1024
+		}
+		if settings.Parallelism == 0 {
+			settings.Parallelism = 2
+		}
+		if settings.Cost < 1 || settings.Memory < 8*settings.Parallelism || settings.Parallelism < 1 || settings.Parallelism > 255 {
+			return nil, fmt.Errorf("invalid argon2id parameters: t=%d m=%d p=%d", settings.Cost, settings.Memory, settings.Parallelism)
+		}
+	case AlgorithmScrypt:
+		if settings.Cost == 0 {
+			settings.Cost = 15
+		}
+		if settings.Parallelism == 0 {
+			settings.Parallelism = 1
+		}
+		if settings.Cost < 1 || settings.Cost > 30 || settings.Parallelism < 1 {
+			return nil, fmt.Errorf("invalid scrypt parameters: ln=%d p=%d", settings.Cost, settings.Parallelism)
+		}
+	case AlgorithmPBKDF2SHA256:
+		if settings.Cost == 0 {
+			settings.Cost = 600_000
+		}
+		if settings.Cost < 1 {
+			return nil, fmt.Errorf("invalid pbkdf2 iterations: %d", settings.Cost)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, settings.Algorithm)
+	}
+	return &Hasher{settings: settings}, nil
+}
+
+// Hash returns the bcrypt hash or PHC string of the password
+func (h Hasher) Hash(password string) (string, error) {
+	if h.settings.Algorithm == AlgorithmBcrypt {
+		var hash, err = bcrypt.GenerateFromPassword([]byte(password), h.settings.Cost)
+		return string(hash), err
+	}
+
+	var salt = make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	var (
+		key    []byte
+		params string
+		err    error
+	)
+	switch h.settings.Algorithm {
+	case AlgorithmArgon2id:
+		key = argon2.IDKey([]byte(password), salt, uint32(h.settings.Cost), uint32(h.settings.Memory), uint8(h.settings.Parallelism), keyLength)
+		params = fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2.Version, h.settings.Memory, h.settings.Cost, h.settings.Parallelism)
+	case AlgorithmScrypt:
+		key, err = scrypt.Key([]byte(password), salt, 1<<h.settings.Cost, 8, h.settings.Parallelism, keyLength)
+		params = fmt.Sprintf("ln=%d,r=8,p=%d", h.settings.Cost, h.settings.Parallelism)
+	case AlgorithmPBKDF2SHA256:
+		key, err = pbkdf2.Key(sha256.New, password, salt, h.settings.Cost, keyLength)
+		params = fmt.Sprintf("i=%d", h.settings.Cost)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$%s$%s$%s$%s", h.settings.Algorithm, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// NeedsRehash reports whether the hash was created with another algorithm or cost than configured
+func (h Hasher) NeedsRehash(hash string) bool {
+	var parsed, err = parse(hash)
+	if err != nil || parsed.algorithm != h.settings.Algorithm {
+		return true
+	}
+	switch parsed.algorithm {
+	case AlgorithmBcrypt:
+		var cost, err = bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.settings.Cost
+	case AlgorithmArgon2id:
+		return parsed.version != argon2.Version || parsed.param("t") != h.settings.Cost ||
+			parsed.param("m") != h.settings.Memory || parsed.param("p") != h.settings.Parallelism
+	case AlgorithmScrypt:
+		return parsed.param("ln") != h.settings.Cost || parsed.param("r") != 8 || parsed.param("p") != h.settings.Parallelism
+	case AlgorithmPBKDF2SHA256:
+		return parsed.param("i") != h.settings.Cost
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package passwordhash
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHashVerify(t *testing.T) {
+	for _, settings := range []Settings{
+		{Algorithm: AlgorithmBcrypt, Cost: 4},
+		{Algorithm: AlgorithmArgon2id, Cost: 1, Memory: 64, Parallelism: 1},
+		{Algorithm: AlgorithmScrypt, Cost: 4, Parallelism: 1},
+		{Algorithm: AlgorithmPBKDF2SHA256, Cost: 1000},
+	} {
+		t.Run(settings.Algorithm, func(t *testing.T) {
+			var hasher, err = NewHasher(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := hasher.Hash("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsHash(hash) {
+				t.Errorf("IsHash(%q) = false", hash)
+			}
+			if match, err := Verify(hash, "secret"); err != nil || !match {
+				t.Errorf("Verify = %v, %v", match, err)
+			}
+			if match, err := Verify(hash, "Secret"); err != nil || match {
+				t.Errorf("Verify of wrong password = %v, %v", match, err)
+			}
+			if other, _ := hasher.Hash("secret"); other == hash {
+				t.Error("hashes are not salted")
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Error("NeedsRehash with the same settings")
+			}
+			var stronger = settings
+			stronger.Cost++
+			if hasher, _ := NewHasher(stronger); !hasher.NeedsRehash(hash) {
+				t.Error("NeedsRehash with a higher cost = false")
+			}
+		})
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, tt := range []struct {
+		settings Settings
+		valid    bool
+	}{
+		{Settings{}, true},
+		{DefaultSettings, true},
+		{Settings{Algorithm: AlgorithmBcrypt, Cost: 3}, false},
+		{Settings{Algorithm: AlgorithmArgon2id}, true},
+		{Settings{Algorithm: AlgorithmArgon2id, Memory: 4, Parallelism: 1}, false},
+		{Settings{Algorithm: AlgorithmScrypt, Cost: 31}, false},
+		{Settings{Algorithm: AlgorithmPBKDF2SHA256, Cost: -1}, false},
+		{Settings{Algorithm: "md5"}, false},
+	} {
+		if _, err := NewHasher(tt.settings); (err == nil) != tt.valid {
+			t.Errorf("NewHasher(%+v) = %v", tt.settings, err)
+		}
+	}
+	if _, err := NewHasher(Settings{Algorithm: "md5"}); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("NewHasher(md5) = %v", err)
+	}
+}
+
+func TestNeedsRehashOtherAlgorithm(t *testing.T) {
+	var hasher, _ = NewHasher(Settings{Algorithm: AlgorithmArgon2id})
+	for _, hash := range []string{"$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe", "{SSHA}1G904nLkTkGWjKNnQuB/hpWXC/hzYWx0c2FsdA==", "secret"} {
+		if !hasher.NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = false", hash)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package passwordhash
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+type parsedHash struct {
+	algorithm string
+	version   int
+	params    map[string]int
+	salt      []byte
+	key       []byte
+}
+
+func (p parsedHash) param(name string) int {
+	return p.params[name]
+}
+
+// decodeBase64 accepts standard base64 with or without padding and the adapted base64 of passlib, which uses . instead
+// of +
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.ReplaceAll(s, ".", "+"), "="))
+}
+
+var ldapSchemes = map[string]func() hash.Hash{
+	"{SHA}":     sha1.New,
+	"{SSHA}":    sha1.New,
+	"{SHA256}":  sha256.New,
+	"{SSHA256}": sha256.New,
+	"{SHA512}":  sha512.New,
+	"{SSHA512}": sha512.New,
+}
+
+var pbkdf2Digests = map[string]func() hash.Hash{
+	"pbkdf2":        sha1.New,
+	"pbkdf2-sha1":   sha1.New,
+	"pbkdf2-sha256": sha256.New,
+	"pbkdf2-sha512": sha512.New,
+}
+
+func parse(encoded string) (*parsedHash, error) {
+	if upper := strings.ToUpper(encoded); strings.HasPrefix(upper, "{CRYPT}") || strings.HasPrefix(upper, "{ARGON2}") {
+		// OpenLDAP wraps crypt(3) and argon2 hashes
+		encoded = encoded[strings.Index(encoded, "}")+1:]
+	} else if strings.HasPrefix(encoded, "{") {
+		var end = strings.Index(encoded, "}")
+		if end < 0 {
+			return nil, ErrMalformedHash
+		}
+		var scheme = strings.ToUpper(encoded[:end+1])
+		var newHash, found = ldapSchemes[scheme]
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, scheme)
+		}
+		var decoded, err = base64.StdEncoding.DecodeString(encoded[end+1:])
+		var size = newHash().Size()
+		if err != nil || len(decoded) < size || (!strings.HasPrefix(scheme, "{SS") && len(decoded) != size) {
+			return nil, ErrMalformedHash
+		}
+		return &parsedHash{algorithm: scheme, key: decoded[:size], salt: decoded[size:]}, nil
+	}
+
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return &parsedHash{algorithm: AlgorithmBcrypt}, nil
+	}
+
+	var fields = strings.Split(encoded, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return nil, ErrMalformedHash
+	}
+	var parsed = parsedHash{algorithm: fields[1], params: map[string]int{}}
+	if parsed.algorithm != AlgorithmArgon2id && parsed.algorithm != AlgorithmScrypt && pbkdf2Digests[parsed.algorithm] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, parsed.algorithm)
+	}
+	fields = fields[2:]
+	if strings.HasPrefix(fields[0], "v=") && len(fields) == 4 {
+		if version, err := strconv.Atoi(strings.TrimPrefix(fields[0], "v=")); err != nil {
+			return nil, ErrMalformedHash
+		} else {
+			parsed.version = version
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return nil, ErrMalformedHash
+	}
+	if rounds, err := strconv.Atoi(fields[0]); err == nil {
+		// passlib writes the PBKDF2 rounds without parameter name
+		parsed.params["i"] = rounds
+	} else {
+		for _, param := range strings.Split(fields[0], ",") {
+			var name, value, _ = strings.Cut(param, "=")
+			if number, err := strconv.Atoi(value); err != nil {
+				return nil, ErrMalformedHash
+			} else {
+				parsed.params[name] = number
+			}
+		}
+	}
+	var err error
+	if parsed.salt, err = decodeBase64(fields[1]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if parsed.key, err = decodeBase64(fields[2]); err != nil || len(parsed.key) == 0 {
+		return nil, ErrMalformedHash
+	}
+	return &parsed, nil
+}
+
+// IsHash reports whether the value is a password hash in one of the supported formats
+func IsHash(value string) bool {
+	var _, err = parse(value)
+	return err == nil
+}
+
+// Verify compares the password with a bcrypt hash, a PHC string of argon2id, scrypt or PBKDF2, or an LDAP {SHA},
+// {SSHA}, {SSHA256}, {SSHA512} or {CRYPT} value
+func Verify(encoded, password string) (bool, error) {
+	var parsed, err = parse(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	var key []byte
+	switch {
+	case parsed.algorithm == AlgorithmBcrypt:
+		var start = strings.Index(encoded, "$")
+		err = bcrypt.CompareHashAndPassword([]byte(encoded[start:]), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case parsed.algorithm == AlgorithmArgon2id:
+		var t, m, p = parsed.param("t"), parsed.param("m"), parsed.param("p")
+		if parsed.version != argon2.Version || t < 1 || m < 1 || p < 1 || p > 255 {
+			return false, ErrMalformedHash
+		}
+		key = argon2.IDKey([]byte(password), parsed.salt, uint32(t), uint32(m), uint8(p), uint32(len(parsed.key)))
+	case parsed.algorithm == AlgorithmScrypt:
+		var ln, r, p = parsed.param("ln"), parsed.param("r"), parsed.param("p")
+		if ln < 1 || ln > 30 {
+			return false, ErrMalformedHash
+		}
+		if key, err = scrypt.Key([]byte(password), parsed.salt, 1<<ln, r, p, len(parsed.key)); err != nil {
+			return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+	case pbkdf2Digests[parsed.algorithm] != nil:
+		if parsed.param("i") < 1 {
+			return false, ErrMalformedHash
+		}
+		if key, err = pbkdf2.Key(pbkdf2Digests[parsed.algorithm], password, parsed.salt, parsed.param("i"), len(parsed.key)); err != nil {
+			return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+	case ldapSchemes[parsed.algorithm] != nil:
+		var h = ldapSchemes[parsed.algorithm]()
+		h.Write([]byte(password))
+		h.Write(parsed.salt)
+		key = h.Sum(nil)
+	default:
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, parsed.algorithm)
+	}
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1, nil
+}
@@ -0,0 +1,53 @@
+package passwordhash
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	// hashes of "secret" created with OpenLDAP slappasswd, passlib and crypt(3) conventions
+	for _, tt := range []struct {
+		name string
+		hash string
+	}{
+		{"bcrypt", "$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe"},
+		{"bcrypt crypt", "{CRYPT}$2a$04$7AnCRCAOM29Njl9WGEz5yOsTnSDeGNdvoJEtPEUoqESXNenli8bYe"},
+		{"ldap sha", "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ="},
+		{"ldap ssha", "{SSHA}1G904nLkTkGWjKNnQuB/hpWXC/hzYWx0c2FsdA=="},
+		{"ldap ssha lower case", "{ssha}1G904nLkTkGWjKNnQuB/hpWXC/hzYWx0c2FsdA=="},
+		{"ldap ssha512", "{SSHA512}aCu7JRc+kLsuEmFs1zTY+AiP7DSGnjjG+dH28Dp+E5usqoAixeTPihKqZmkWal4mUfp63tqvCAkFV1LKTDFH6XNhbHRzYWx0"},
+		{"passlib pbkdf2-sha256", "$pbkdf2-sha256$1000$MDEyMzQ1Njc4OWFiY2RlZg$tiKWHy4FAGCWE8gn6GtKhaxD2OeeAUUWXFT/p1aaNl8"},
+		{"passlib pbkdf2", "$pbkdf2$1000$MDEyMzQ1Njc4OWFiY2RlZg$21EupWTmSOvnK3Sp99FL7THUyuQ"},
+		{"scrypt", "$scrypt$ln=4,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$gEeb/KeWbm5g+kBQOFr1yJbkjBxxxDOkhSmrSXFFwOg"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if match, err := Verify(tt.hash, "secret"); err != nil || !match {
+				t.Errorf("Verify = %v, %v", match, err)
+			}
+			if match, err := Verify(tt.hash, "wrong"); err != nil || match {
+				t.Errorf("Verify of wrong password = %v, %v", match, err)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	for _, tt := range []struct {
+		hash string
+		err  error
+	}{
+		{"secret", ErrMalformedHash},
+		{"{MD5}Xr4ilOzQ4PCOq3aQ0qbuaQ==", ErrUnsupportedAlgorithm},
+		{"{SHA}c2hvcnQ=", ErrMalformedHash},
+		{"{SHA", ErrMalformedHash},
+		{"$md5$i=1$c2FsdA$a2V5", ErrUnsupportedAlgorithm},
+		{"$pbkdf2-sha256$i=0$c2FsdA$a2V5", ErrMalformedHash},
+		{"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5", ErrMalformedHash},
+		{"$scrypt$ln=4,r=8,p=1$c2FsdA$", ErrMalformedHash},
+	} {
+		if match, err := Verify(tt.hash, "secret"); match || !errors.Is(err, tt.err) {
+			t.Errorf("Verify(%q) = %v, %v, want %v", tt.hash, match, err, tt.err)
+		}
+	}
+}
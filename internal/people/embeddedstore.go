@@ -1,8 +1,8 @@
 package people
 
 import (
+	"github.com/cwkr/authd/internal/passwordhash"
 	"github.com/gorilla/sessions"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
 	"strings"
@@ -11,6 +11,7 @@ import (
 
 type AuthenticPerson struct {
 	Person
+	OTPCredentials
 	PasswordHash string `json:"password_hash"`
 }
 
@@ -33,9 +34,9 @@ func (e embeddedStore) Authenticate(userID, password string) (string, error) {
 	var authenticPerson, foundUser = e.users[strings.ToLower(lowercaseUserID)]
 
 	if foundUser {
-		if err := bcrypt.CompareHashAndPassword([]byte(authenticPerson.PasswordHash), []byte(password)); err != nil {
+		if match, err := passwordhash.Verify(authenticPerson.PasswordHash, password); err != nil {
 			log.Printf("!!! password comparison failed: %v", err)
-		} else {
+		} else if match {
 			return lowercaseUserID, nil
 		}
 	}
@@ -43,22 +44,31 @@ func (e embeddedStore) Authenticate(userID, password string) (string, error) {
 	return "", ErrAuthenticationFailed
 }
 
-func (e embeddedStore) IsSessionActive(r *http.Request, sessionName string) (string, bool) {
+func (e embeddedStore) IsSessionActive(r *http.Request, sessionName string) (*Session, bool) {
 	var session, _ = e.sessionStore.Get(r, sessionName)
 
-	var uid, sct = session.Values["uid"], session.Values["sct"]
+	var uid, sct, amr = session.Values["uid"], session.Values["sct"], session.Values["amr"]
 
 	if uid != nil && sct != nil && time.Unix(sct.(int64), 0).Add(time.Duration(e.sessionTTL)*time.Second).After(time.Now()) {
-		return uid.(string), true
+		// sessions created before the nanoseconds were recorded started at the full second
+		var nsec, _ = session.Values["sct_nsec"].(int64)
+		// sessions created before authentication methods were recorded used passwords
+		var methods = []string{MethodPassword}
+		if amr, ok := amr.(string); ok && amr != "" {
+			methods = strings.Fields(amr)
+		}
+		return &Session{UserID: uid.(string), AuthTime: time.Unix(sct.(int64), nsec), Methods: methods}, true
 	}
 
-	return "", false
+	return nil, false
 }
 
-func (e embeddedStore) SaveSession(r *http.Request, w http.ResponseWriter, authTime time.Time, userID, sessionName string) error {
+func (e embeddedStore) SaveSession(r *http.Request, w http.ResponseWriter, activeSession Session, sessionName string) error {
 	var session, _ = e.sessionStore.Get(r, sessionName)
-	session.Values["uid"] = userID
-	session.Values["sct"] = authTime.Unix()
+	session.Values["uid"] = activeSession.UserID
+	session.Values["sct"] = activeSession.AuthTime.Unix()
+	session.Values["sct_nsec"] = int64(activeSession.AuthTime.Nanosecond())
+	session.Values["amr"] = strings.Join(activeSession.Methods, " ")
 	if err := session.Save(r, w); err != nil {
 		return err
 	}
@@ -75,6 +85,16 @@ func (e embeddedStore) Lookup(userID string) (*Person, error) {
 	return nil, ErrPersonNotFound
 }
 
+func (e embeddedStore) PasswordHash(userID string) (string, error) {
+	var authenticPerson, found = e.users[strings.ToLower(userID)]
+
+	if found {
+		return authenticPerson.PasswordHash, nil
+	}
+
+	return "", ErrPersonNotFound
+}
+
 func (e embeddedStore) Ping() error {
 	return nil
 }
@@ -90,3 +110,17 @@ func (e embeddedStore) Put(userID string, person *Person) error {
 func (e embeddedStore) SetPassword(userID, password string) error {
 	return ErrReadOnly
 }
+
+func (e embeddedStore) LookupOTP(userID string) (*OTPCredentials, error) {
+	var authenticPerson, found = e.users[strings.ToLower(userID)]
+
+	if found && authenticPerson.Secret != "" {
+		return &authenticPerson.OTPCredentials, nil
+	}
+
+	return nil, ErrOTPNotEnrolled
+}
+
+func (e embeddedStore) PutOTP(userID string, credentials *OTPCredentials) error {
+	return ErrReadOnly
+}
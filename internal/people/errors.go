@@ -6,4 +6,5 @@ var (
 	ErrAuthenticationFailed = errors.New("invalid username and/or password")
 	ErrPersonNotFound       = errors.New("person not found in store")
 	ErrReadOnly             = errors.New("store is read-only")
+	ErrOTPNotEnrolled       = errors.New("user is not enrolled for one-time passwords")
 )
@@ -0,0 +1,14 @@
+package people
+
+// OTPCredentials are the TOTP secret of a user and the bcrypt hashes of the unused recovery codes
+type OTPCredentials struct {
+	Secret        string   `json:"otp_secret,omitempty"`
+	RecoveryCodes []string `json:"otp_recovery_codes,omitempty"`
+}
+
+// OTPStore is implemented by people stores that keep one-time password credentials
+type OTPStore interface {
+	// LookupOTP returns ErrOTPNotEnrolled when the user has no TOTP secret
+	LookupOTP(userID string) (*OTPCredentials, error)
+	PutOTP(userID string, credentials *OTPCredentials) error
+}
@@ -0,0 +1,151 @@
+package people
+
+import (
+	"fmt"
+	"github.com/cwkr/authd/internal/passwordhash"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Character classes of passwords
+const (
+	CharacterClassLower  = "lower"
+	CharacterClassUpper  = "upper"
+	CharacterClassDigit  = "digit"
+	CharacterClassSymbol = "symbol"
+)
+
+// Codes of password policy violations
+const (
+	ViolationTooShort              = "too_short"
+	ViolationTooLong               = "too_long"
+	ViolationMissingCharacterClass = "missing_character_class"
+	ViolationTooFewCharacterClass  = "too_few_character_classes"
+	ViolationBannedWord            = "banned_word"
+	ViolationContainsUserID        = "contains_user_id"
+	ViolationReused                = "reused"
+)
+
+type PasswordPolicy struct {
+	MinLength                int      `json:"min_length,omitempty"`
+	MaxLength                int      `json:"max_length,omitempty"`
+	RequiredCharacterClasses []string `json:"required_character_classes,omitempty"`
+	MinCharacterClasses      int      `json:"min_character_classes,omitempty"`
+	BannedWords              []string `json:"banned_words,omitempty"`
+	// History is the number of previous passwords that can not be reused, it requires a people store keeping them
+	History int `json:"history,omitempty"`
+}
+
+// DefaultPasswordPolicy is used when no password policy is configured
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 64}
+
+// PolicyViolation is a rule of the password policy the password does not follow
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists all violations of the password policy
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	var messages = make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// PasswordHistoryStore is implemented by people stores that keep the hashes of previous passwords
+type PasswordHistoryStore interface {
+	// PasswordHistory returns the hashes of the last passwords of the user, the most recent first
+	PasswordHistory(userID string, limit int) ([]string, error)
+}
+
+// Validate returns an error for unknown character classes
+func (p PasswordPolicy) Validate() error {
+	for _, class := range p.RequiredCharacterClasses {
+		if !slices.Contains([]string{CharacterClassLower, CharacterClassUpper, CharacterClassDigit, CharacterClassSymbol}, class) {
+			return fmt.Errorf("unknown character class: %s", class)
+		}
+	}
+	return nil
+}
+
+func characterClass(r rune) string {
+	switch {
+	case unicode.IsLower(r):
+		return CharacterClassLower
+	case unicode.IsUpper(r):
+		return CharacterClassUpper
+	case unicode.IsDigit(r):
+		return CharacterClassDigit
+	case unicode.IsLetter(r):
+		return ""
+	default:
+		return CharacterClassSymbol
+	}
+}
+
+// Check returns a PolicyError when the new password of the user violates the policy, previous passwords are looked
+// up in the people store
+func (p PasswordPolicy) Check(peopleStore Store, userID, password string) error {
+	var violations []PolicyViolation
+
+	var length = utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, PolicyViolation{ViolationTooShort, fmt.Sprintf("password must be at least %d characters long", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PolicyViolation{ViolationTooLong, fmt.Sprintf("password must be at most %d characters long", p.MaxLength)})
+	}
+
+	var classes []string
+	for _, r := range password {
+		if class := characterClass(r); class != "" && !slices.Contains(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	for _, class := range p.RequiredCharacterClasses {
+		if !slices.Contains(classes, class) {
+			violations = append(violations, PolicyViolation{ViolationMissingCharacterClass, fmt.Sprintf("password must contain a %s character", class)})
+		}
+	}
+	if p.MinCharacterClasses > 0 && len(classes) < p.MinCharacterClasses {
+		violations = append(violations, PolicyViolation{ViolationTooFewCharacterClass,
+			fmt.Sprintf("password must contain characters of at least %d of the classes lower, upper, digit and symbol", p.MinCharacterClasses)})
+	}
+
+	var lowerPassword = strings.ToLower(password)
+	for _, word := range p.BannedWords {
+		if word != "" && strings.Contains(lowerPassword, strings.ToLower(word)) {
+			violations = append(violations, PolicyViolation{ViolationBannedWord, "password must not contain common words"})
+			break
+		}
+	}
+	if utf8.RuneCountInString(userID) >= 3 && strings.Contains(lowerPassword, strings.ToLower(userID)) {
+		violations = append(violations, PolicyViolation{ViolationContainsUserID, "password must not contain the user id"})
+	}
+
+	if historyStore, ok := peopleStore.(PasswordHistoryStore); ok && p.History > 0 {
+		var hashes, err = historyStore.PasswordHistory(userID, p.History)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(hashes, func(hash string) bool {
+			var match, _ = passwordhash.Verify(hash, password)
+			return match
+		}) {
+			violations = append(violations, PolicyViolation{ViolationReused, fmt.Sprintf("password must differ from the last %d passwords", p.History)})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package people
+
+import (
+	"errors"
+	"github.com/cwkr/authd/internal/passwordhash"
+	"slices"
+	"testing"
+)
+
+// historyStore keeps the password history of every user
+type historyStore struct {
+	Store
+	hashes []string
+}
+
+func (h *historyStore) PasswordHistory(userID string, limit int) ([]string, error) {
+	return h.hashes[:min(limit, len(h.hashes))], nil
+}
+
+func violations(err error) []string {
+	var policyError *PolicyError
+	if !errors.As(err, &policyError) {
+		return nil
+	}
+	var codes []string
+	for _, violation := range policyError.Violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	var strict = PasswordPolicy{
+		MinLength:                10,
+		MaxLength:                20,
+		RequiredCharacterClasses: []string{CharacterClassDigit},
+		MinCharacterClasses:      3,
+		BannedWords:              []string{"Password", ""},
+	}
+	for _, tt := range []struct {
+		name       string
+		policy     PasswordPolicy
+		userID     string
+		password   string
+		violations []string
+	}{
+		{"default", DefaultPasswordPolicy, "alice", "correct horse", nil},
+		{"default too short", DefaultPasswordPolicy, "alice", "horse", []string{ViolationTooShort}},
+		{"length in characters", DefaultPasswordPolicy, "alice", "äöüßäöüß", nil},
+		{"empty policy", PasswordPolicy{}, "alice", "x", nil},
+		{"strict", strict, "alice", "Correct-Horse-9", nil},
+		{"too long", strict, "alice", "Correct-Horse-Battery-9", []string{ViolationTooLong}},
+		{"missing digit", strict, "alice", "Correct-Horse", []string{ViolationMissingCharacterClass}},
+		{"too few classes", strict, "alice", "correcthorse9", []string{ViolationTooFewCharacterClass}},
+		{"banned word", strict, "alice", "My-PASSWORD-99", []string{ViolationBannedWord}},
+		{"user id", strict, "Alice", "alice-Horse-9", []string{ViolationContainsUserID}},
+		{"short user id", strict, "al", "Al-Horse-Battery-9", nil},
+		{"all", strict, "alice", "alice", []string{ViolationTooShort, ViolationMissingCharacterClass, ViolationTooFewCharacterClass, ViolationContainsUserID}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var err = tt.policy.Check(nil, tt.userID, tt.password)
+			if got := violations(err); !slices.Equal(got, tt.violations) {
+				t.Errorf("Check = %v, want %v", err, tt.violations)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	var hasher, err = passwordhash.NewHasher(passwordhash.Settings{Cost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var store = &historyStore{}
+	for _, password := range []string{"third-password", "second-password", "first-password"} {
+		var hash, err = hasher.Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.hashes = append(store.hashes, hash)
+	}
+
+	for _, tt := range []struct {
+		history    int
+		password   string
+		violations []string
+	}{
+		{2, "second-password", []string{ViolationReused}},
+		{2, "first-password", nil},
+		{3, "first-password", []string{ViolationReused}},
+		{0, "third-password", nil},
+	} {
+		var policy = PasswordPolicy{History: tt.history}
+		if got := violations(policy.Check(store, "alice", tt.password)); !slices.Equal(got, tt.violations) {
+			t.Errorf("Check(%s) with history %d = %v, want %v", tt.password, tt.history, got, tt.violations)
+		}
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	if err := (PasswordPolicy{RequiredCharacterClasses: []string{CharacterClassLower, CharacterClassSymbol}}).Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (PasswordPolicy{RequiredCharacterClasses: []string{"emoji"}}).Validate(); err == nil {
+		t.Error("unknown character class accepted")
+	}
+}
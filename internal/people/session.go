@@ -0,0 +1,29 @@
+package people
+
+import (
+	"slices"
+	"time"
+)
+
+// Authentication method references (amr) as per RFC 8176
+const (
+	MethodPassword    = "pwd"
+	MethodOTP         = "otp"
+	MethodHardwareKey = "hwk"
+	MethodSoftwareKey = "swk"
+	// MethodEmail is not registered, it marks logins confirmed by a link or code sent by email
+	MethodEmail = "email"
+)
+
+// Session is the state of an authenticated user kept in the session cookie
+type Session struct {
+	UserID   string
+	AuthTime time.Time
+	Methods  []string
+}
+
+// MultiFactor reports whether the session was started with more than one factor, passkeys verify the user on the
+// authenticator and count as two
+func (s Session) MultiFactor() bool {
+	return len(s.Methods) > 1 || slices.Contains(s.Methods, MethodHardwareKey) || slices.Contains(s.Methods, MethodSoftwareKey)
+}
@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/blockloop/scan/v2"
+	"github.com/cwkr/authd/internal/passwordhash"
 	"github.com/cwkr/authd/internal/sqlutil"
 	"github.com/gorilla/sessions"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"strings"
 )
@@ -15,6 +15,7 @@ type sqlStore struct {
 	embeddedStore
 	dbconn   *sql.DB
 	settings *StoreSettings
+	hasher   *passwordhash.Hasher
 }
 
 type PersonDetails struct {
@@ -43,7 +44,7 @@ func (p PersonDetails) Person() *Person {
 	}
 }
 
-func NewSqlStore(sessionStore sessions.Store, users map[string]AuthenticPerson, sessionTTL int64, dbs map[string]*sql.DB, settings *StoreSettings) (Store, error) {
+func NewSqlStore(sessionStore sessions.Store, users map[string]AuthenticPerson, sessionTTL int64, dbs map[string]*sql.DB, settings *StoreSettings, hasher *passwordhash.Hasher) (Store, error) {
 	if dbconn, err := sqlutil.GetDB(dbs, settings.URI); err != nil {
 		return nil, err
 	} else {
@@ -55,6 +56,7 @@ func NewSqlStore(sessionStore sessions.Store, users map[string]AuthenticPerson,
 			},
 			dbconn:   dbconn,
 			settings: settings,
+			hasher:   hasher,
 		}, nil
 	}
 }
@@ -110,9 +112,12 @@ func (p sqlStore) Authenticate(userID, password string) (string, error) {
 	var row = p.dbconn.QueryRow(p.settings.CredentialsQuery, userID)
 	var passwordHash string
 	if err := row.Scan(&realUserID, &passwordHash); err == nil {
-		if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		if match, err := passwordhash.Verify(passwordHash, password); err != nil {
 			log.Printf("!!! password comparison failed: %v", err)
-		} else {
+		} else if match {
+			if p.hasher.NeedsRehash(passwordHash) {
+				p.rehash(realUserID, password)
+			}
 			return realUserID, nil
 		}
 	} else {
@@ -183,8 +188,24 @@ func (p sqlStore) Put(userID string, person *Person) error {
 	return nil
 }
 
+// rehash replaces the password hash of the user by one using the configured algorithm and cost, failures are only
+// logged because the user has been authenticated already
+func (p sqlStore) rehash(userID, password string) {
+	if p.settings.SetPassword == "" {
+		return
+	}
+	if passwordHash, err := p.hasher.Hash(password); err != nil {
+		log.Printf("!!! password rehash failed: %v", err)
+	} else {
+		log.Printf("SQL: %s; -- %s", p.settings.SetPassword, userID)
+		if _, err := p.dbconn.Exec(p.settings.SetPassword, userID, passwordHash); err != nil {
+			log.Printf("!!! password rehash failed: %v", err)
+		}
+	}
+}
+
 func (p sqlStore) SetPassword(userID, password string) error {
-	if passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 5); err != nil {
+	if passwordHash, err := p.hasher.Hash(password); err != nil {
 		return err
 	} else {
 		// UPDATE people SET password_hash = $2, last_modified = now() WHERE lower(user_id) = lower($1)
@@ -192,6 +213,84 @@ func (p sqlStore) SetPassword(userID, password string) error {
 		if _, err := p.dbconn.Exec(p.settings.SetPassword, userID, passwordHash); err != nil {
 			return err
 		}
+		if p.settings.HistoryInsert != "" {
+			log.Printf("SQL: %s; -- %s", p.settings.HistoryInsert, userID)
+			// INSERT INTO password_history (user_id, password_hash) VALUES (lower($1), $2)
+			if _, err := p.dbconn.Exec(p.settings.HistoryInsert, userID, passwordHash); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
+
+func (p sqlStore) PasswordHash(userID string) (string, error) {
+	var passwordHash, err = p.embeddedStore.PasswordHash(userID)
+	if err == nil {
+		return passwordHash, nil
+	}
+
+	// SELECT user_id, password_hash FROM people WHERE lower(user_id) = lower($1)
+	log.Printf("SQL: %s; -- %s", p.settings.CredentialsQuery, userID)
+	var realUserID string
+	if err := p.dbconn.QueryRow(p.settings.CredentialsQuery, userID).Scan(&realUserID, &passwordHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrPersonNotFound
+		}
+		log.Printf("!!! Query for person failed: %v", err)
+		return "", err
+	}
+	return passwordHash, nil
+}
+
+func (p sqlStore) PasswordHistory(userID string, limit int) ([]string, error) {
+	if _, found := p.users[strings.ToLower(userID)]; found || p.settings.HistoryQuery == "" {
+		return nil, nil
+	}
+
+	var hashes []string
+
+	log.Printf("SQL: %s; -- %s, %d", p.settings.HistoryQuery, userID, limit)
+	// SELECT password_hash FROM password_history WHERE user_id = lower($1) ORDER BY created DESC LIMIT $2
+	if rows, err := p.dbconn.Query(p.settings.HistoryQuery, userID, limit); err == nil {
+		if err := scan.Rows(&hashes, rows); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("!!! Query for password history failed: %v", err)
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (p sqlStore) LookupOTP(userID string) (*OTPCredentials, error) {
+	if _, found := p.users[strings.ToLower(userID)]; found || p.settings.OTPQuery == "" {
+		return p.embeddedStore.LookupOTP(userID)
+	}
+
+	var secret, recoveryCodes sql.NullString
+
+	// SELECT otp_secret, otp_recovery_codes FROM people WHERE lower(user_id) = lower($1)
+	log.Printf("SQL: %s; -- %s", p.settings.OTPQuery, userID)
+	if err := p.dbconn.QueryRow(p.settings.OTPQuery, userID).Scan(&secret, &recoveryCodes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOTPNotEnrolled
+		}
+		log.Printf("!!! Query for one-time password credentials failed: %v", err)
+		return nil, err
+	}
+	if secret.String == "" {
+		return nil, ErrOTPNotEnrolled
+	}
+	return &OTPCredentials{Secret: secret.String, RecoveryCodes: strings.Fields(recoveryCodes.String)}, nil
+}
+
+func (p sqlStore) PutOTP(userID string, credentials *OTPCredentials) error {
+	if _, found := p.users[strings.ToLower(userID)]; found || p.settings.OTPUpdate == "" {
+		return ErrReadOnly
+	}
+	// UPDATE people SET otp_secret = $2, otp_recovery_codes = $3, last_modified = now() WHERE lower(user_id) = lower($1)
+	log.Printf("SQL: %s; -- %s", p.settings.OTPUpdate, userID)
+	_, err := p.dbconn.Exec(p.settings.OTPUpdate, userID, credentials.Secret, strings.Join(credentials.RecoveryCodes, " "))
+	return err
+}
@@ -2,16 +2,20 @@ package people
 
 import (
 	"net/http"
-	"time"
 )
 
 type Store interface {
 	Authenticate(userID, password string) (string, error)
-	IsSessionActive(r *http.Request, sessionName string) (string, bool)
-	SaveSession(r *http.Request, w http.ResponseWriter, authTime time.Time, userID, sessionName string) error
+	IsSessionActive(r *http.Request, sessionName string) (*Session, bool)
+	SaveSession(r *http.Request, w http.ResponseWriter, session Session, sessionName string) error
 	Lookup(userID string) (*Person, error)
 	Ping() error
 	ReadOnly() bool
 	Put(userID string, person *Person) error
 	SetPassword(userID, password string) error
 }
+
+// PasswordHashStore is implemented by people stores that tell the current password hash of a user
+type PasswordHashStore interface {
+	PasswordHash(userID string) (string, error)
+}
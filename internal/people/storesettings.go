@@ -8,4 +8,8 @@ type StoreSettings struct {
 	Parameters       map[string]string `json:"parameters,omitempty"`
 	Update           string            `json:"update,omitempty"`
 	SetPassword      string            `json:"set_password,omitempty"`
+	OTPQuery         string            `json:"otp_query,omitempty"`
+	OTPUpdate        string            `json:"otp_update,omitempty"`
+	HistoryQuery     string            `json:"password_history_query,omitempty"`
+	HistoryInsert    string            `json:"password_history_insert,omitempty"`
 }
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/mail"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/cwkr/authd/internal/stringutil"
+	"github.com/cwkr/authd/settings"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCodeAttempts is the number of wrong codes after which a login email becomes invalid
+const maxCodeAttempts = 5
+
+//go:embed templates/emaillogin.gohtml
+var emailLoginTpl string
+
+// emailChallenge is a login email waiting to be confirmed by its link or its code
+type emailChallenge struct {
+	userID   string
+	clientID string
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+type emailLoginHandler struct {
+	basePath     string
+	peopleStore  people.Store
+	clientStore  clients.Store
+	sessionStore sessions.Store
+	mfaPolicy    oauth2.MFAPolicy
+	mailer       mail.Mailer
+	settings     settings.EmailLogin
+	secret       []byte
+	issuer       string
+	sessionName  string
+	tpl          *template.Template
+	mutex        sync.Mutex
+	challenges   map[string]*emailChallenge
+	sent         map[string][]time.Time
+}
+
+func (e *emailLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	httputil.NoCache(w)
+
+	var clientID = strings.ToLower(r.FormValue("client_id"))
+	if clientID == "" {
+		htmlutil.Error(w, e.basePath, "client_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	var client, err = e.clientStore.Lookup(clientID)
+	if err != nil {
+		htmlutil.Error(w, e.basePath, "invalid_client", http.StatusForbidden)
+		return
+	}
+	var sessionName = e.sessionName
+	if client.SessionName != "" {
+		sessionName = client.SessionName
+	}
+	var session, _ = e.sessionStore.Get(r, sessionName)
+
+	var message string
+	var codeSent bool
+	if token := r.URL.Query().Get("token"); token != "" && r.Method == http.MethodGet {
+		if challenge, valid := e.verifyLink(token, clientID); valid {
+			e.login(w, r, *client, sessionName, challenge.userID)
+			return
+		}
+		message = "the login link is invalid or expired"
+	} else if r.Method == http.MethodPost {
+		if code := strings.TrimSpace(r.PostFormValue("code")); code != "" {
+			var challengeID, _ = session.Values["email_challenge"].(string)
+			if challenge, valid := e.verifyCode(challengeID, clientID, code); valid {
+				delete(session.Values, "email_challenge")
+				e.login(w, r, *client, sessionName, challenge.userID)
+				return
+			}
+			message = "invalid or expired code"
+			codeSent = true
+		} else if userID := strings.TrimSpace(r.PostFormValue("user_id")); userID != "" {
+			// unknown users get the same answer and a challenge no mail refers to
+			session.Values["email_challenge"] = e.send(r, clientID, userID)
+			if err := session.Save(r, w); err != nil {
+				htmlutil.Error(w, e.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			codeSent = true
+		} else {
+			message = "username must not be empty"
+		}
+	}
+
+	var params = r.URL.Query()
+	params.Del("token")
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	err = e.tpl.ExecuteTemplate(w, "emaillogin", map[string]any{
+		"base_path": e.basePath,
+		"query":     template.HTML("?" + params.Encode()),
+		"message":   message,
+		"code_sent": codeSent,
+	})
+	if err != nil {
+		htmlutil.Error(w, e.basePath, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (e *emailLoginHandler) login(w http.ResponseWriter, r *http.Request, client clients.Client, sessionName, userID string) {
+	log.Printf("user_id=%s confirmed login email", userID)
+	var path, err = startSession(e.peopleStore, e.sessionStore, e.mfaPolicy, r, w, client, sessionName, userID, people.MethodEmail)
+	if err != nil {
+		htmlutil.Error(w, e.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var params = r.URL.Query()
+	params.Del("token")
+	httputil.RedirectQuery(w, r, strings.TrimRight(e.issuer, "/")+path, params)
+}
+
+// send mails a link and a code to the user in the background, so neither the answer nor its timing tells whether the
+// account exists; the challenge id is returned for unknown users and exceeded limits as well
+func (e *emailLoginHandler) send(r *http.Request, clientID, userID string) string {
+	var challengeID = stringutil.RandomAlphanumericString(32)
+	var person, err = e.peopleStore.Lookup(userID)
+	if err != nil || person.Email == "" {
+		log.Printf("!!! no email address for user_id=%s", userID)
+		return challengeID
+	}
+	var code = randomCode()
+
+	e.mutex.Lock()
+	var now = time.Now()
+	e.purge(now)
+	var key = strings.ToLower(userID)
+	if len(e.sent[key]) >= e.settings.MaxMessages {
+		e.mutex.Unlock()
+		log.Printf("!!! too many login emails for user_id=%s", userID)
+		return challengeID
+	}
+	e.sent[key] = append(e.sent[key], now)
+	e.challenges[challengeID] = &emailChallenge{
+		userID:   userID,
+		clientID: clientID,
+		code:     code,
+		expires:  now.Add(time.Duration(e.settings.LinkTTL) * time.Second),
+	}
+	e.mutex.Unlock()
+
+	var params = r.URL.Query()
+	params.Set("token", e.sign(challengeID))
+	var link = strings.TrimRight(e.issuer, "/") + "/login/email?" + params.Encode()
+	var body = fmt.Sprintf("Open the following link to log in:\n\n%s\n\nor enter the code %s on the login page.\n\n"+
+		"The link and the code are valid for %d minutes and can be used once. If you did not ask to log in, ignore this email.\n",
+		link, code, e.settings.LinkTTL/60)
+	go func() {
+		if err := e.mailer.Send(person.Email, e.settings.Subject, body); err != nil {
+			log.Printf("!!! sending login email failed: %v", err)
+		}
+	}()
+	return challengeID
+}
+
+// purge drops expired challenges and mails sent more than an hour ago, the caller holds the lock
+func (e *emailLoginHandler) purge(now time.Time) {
+	for challengeID, challenge := range e.challenges {
+		if challenge.expires.Before(now) {
+			delete(e.challenges, challengeID)
+		}
+	}
+	for userID, sent := range e.sent {
+		for len(sent) > 0 && sent[0].Add(time.Hour).Before(now) {
+			sent = sent[1:]
+		}
+		if len(sent) == 0 {
+			delete(e.sent, userID)
+		} else {
+			e.sent[userID] = sent
+		}
+	}
+}
+
+func (e *emailLoginHandler) sign(challengeID string) string {
+	var mac = hmac.New(sha256.New, e.secret)
+	mac.Write([]byte("email_login:" + challengeID))
+	return challengeID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (e *emailLoginHandler) verifyLink(token, clientID string) (*emailChallenge, bool) {
+	var challengeID, _, _ = strings.Cut(token, ".")
+	if !hmac.Equal([]byte(e.sign(challengeID)), []byte(token)) {
+		return nil, false
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.purge(time.Now())
+	var challenge, found = e.challenges[challengeID]
+	if !found || challenge.clientID != clientID {
+		return nil, false
+	}
+	delete(e.challenges, challengeID)
+	return challenge, true
+}
+
+func (e *emailLoginHandler) verifyCode(challengeID, clientID, code string) (*emailChallenge, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.purge(time.Now())
+	var challenge, found = e.challenges[challengeID]
+	if !found || challenge.clientID != clientID {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge.code), []byte(code)) != 1 {
+		if challenge.attempts++; challenge.attempts >= maxCodeAttempts {
+			delete(e.challenges, challengeID)
+		}
+		return nil, false
+	}
+	delete(e.challenges, challengeID)
+	return challenge, true
+}
+
+func randomCode() string {
+	num, _ := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	return fmt.Sprintf("%06d", num.Int64())
+}
+
+func EmailLoginHandler(basePath string, peopleStore people.Store, clientStore clients.Store, sessionStore sessions.Store, mfaPolicy oauth2.MFAPolicy,
+	mailer mail.Mailer, emailLogin settings.EmailLogin, secret []byte, issuer, sessionName string) http.Handler {
+	return &emailLoginHandler{
+		basePath:     basePath,
+		peopleStore:  peopleStore,
+		clientStore:  clientStore,
+		sessionStore: sessionStore,
+		mfaPolicy:    mfaPolicy,
+		mailer:       mailer,
+		settings:     emailLogin,
+		secret:       secret,
+		issuer:       issuer,
+		sessionName:  sessionName,
+		tpl:          template.Must(template.New("emaillogin").Parse(emailLoginTpl)),
+		challenges:   make(map[string]*emailChallenge),
+		sent:         make(map[string][]time.Time),
+	}
+}
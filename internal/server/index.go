@@ -1,7 +1,6 @@
 package server
 
 import (
-	"crypto/rsa"
 	_ "embed"
 	"fmt"
 	"github.com/cwkr/authd/internal/htmlutil"
@@ -10,6 +9,7 @@ import (
 	"github.com/cwkr/authd/internal/oauth2/pkce"
 	"github.com/cwkr/authd/internal/people"
 	"github.com/cwkr/authd/internal/stringutil"
+	"github.com/cwkr/authd/keyset"
 	"github.com/cwkr/authd/settings"
 	"html/template"
 	"log"
@@ -24,7 +24,6 @@ var indexTpl string
 type indexHandler struct {
 	basePath       string
 	serverSettings *settings.Server
-	publicKey      *rsa.PublicKey
 	peopleStore    people.Store
 	clientStore    clients.Store
 	scope          string
@@ -46,9 +45,9 @@ func (i *indexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if clientsPerSessionName, err := i.clientStore.PerSessionNameMap(i.serverSettings.SessionName); err == nil {
 		for sessionName, sessionClients := range clientsPerSessionName {
 			clientIDs = append(clientIDs, sessionClients...)
-			if uid, active := i.peopleStore.IsSessionActive(r, sessionName); active == true {
+			if session, active := i.peopleStore.IsSessionActive(r, sessionName); active == true {
 				for _, cid := range sessionClients {
-					activeSessions = append(activeSessions, activeSession{ClientID: cid, UserID: uid})
+					activeSessions = append(activeSessions, activeSession{ClientID: cid, UserID: session.UserID})
 				}
 			}
 		}
@@ -63,11 +62,15 @@ func (i *indexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		title = "Auth Server"
 	}
 	var codeVerifier = stringutil.RandomAlphanumericString(10)
+	var publicKeyPEM string
+	if key, err := i.serverSettings.KeyManager().Current(); err == nil {
+		publicKeyPEM = keyset.EncodePublicKeyPEM(key.Public(), key.KeyID)
+	}
 	var err = i.tpl.ExecuteTemplate(w, "index", map[string]any{
 		"base_path":       i.basePath,
 		"issuer":          strings.TrimRight(i.serverSettings.Issuer, "/"),
 		"title":           title,
-		"public_key":      i.serverSettings.PublicKeyPEM(),
+		"public_key":      publicKeyPEM,
 		"state":           fmt.Sprint(rand.Int()),
 		"nonce":           stringutil.RandomAlphanumericString(10),
 		"scopes":          strings.Fields(i.scope),
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UnlockPersonHandler lifts the lockout of a user after failed logins, it is restricted to the admin clients
+func UnlockPersonHandler(clientStore clients.Store, lockoutGuard *lockout.Guard, adminClients []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+
+		httputil.AllowCORS(w, r, []string{http.MethodOptions, http.MethodDelete}, true)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var clientID, clientSecret, basicAuth = r.BasicAuth()
+		if !basicAuth {
+			w.Header().Set("WWW-Authenticate", "Basic")
+			oauth2.Error(w, oauth2.ErrorInvalidClient, "client authentication required", http.StatusUnauthorized)
+			return
+		}
+		if _, err := clientStore.Authenticate(clientID, clientSecret); err != nil {
+			oauth2.Error(w, oauth2.ErrorInvalidClient, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !slices.ContainsFunc(adminClients, func(adminClient string) bool { return strings.EqualFold(adminClient, clientID) }) {
+			oauth2.Error(w, ErrorAccessDenied, "", http.StatusForbidden)
+			return
+		}
+
+		// unknown users are unlocked as well, the answer does not reveal whether the account exists
+		if err := lockoutGuard.Unlock(mux.Vars(r)["user_id"]); err != nil {
+			log.Printf("!!! Unlock failed: %v", err)
+			oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -2,17 +2,20 @@ package server
 
 import (
 	_ "embed"
+	"errors"
 	"github.com/cwkr/authd/internal/htmlutil"
 	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2"
 	"github.com/cwkr/authd/internal/oauth2/clients"
 	"github.com/cwkr/authd/internal/people"
 	"github.com/cwkr/authd/internal/stringutil"
+	"github.com/gorilla/sessions"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 )
 
 //go:embed templates/login.gohtml
@@ -28,12 +31,17 @@ func LoadLoginTemplate(filename string) error {
 }
 
 type loginHandler struct {
-	basePath    string
-	peopleStore people.Store
-	clientStore clients.Store
-	issuer      string
-	sessionName string
-	tpl         *template.Template
+	basePath      string
+	peopleStore   people.Store
+	clientStore   clients.Store
+	sessionStore  sessions.Store
+	mfaPolicy     oauth2.MFAPolicy
+	lockoutGuard  *lockout.Guard
+	emailLogin    bool
+	passwordReset bool
+	issuer        string
+	sessionName   string
+	tpl           *template.Template
 }
 
 func (j *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -58,22 +66,33 @@ func (j *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if stringutil.IsAnyEmpty(userID, password) {
 			message = "username and password must not be empty"
 		} else {
-			if client, err := j.clientStore.Lookup(clientID); err == nil {
-				if client.SessionName != "" {
-					sessionName = client.SessionName
-				}
-			} else {
+			var client, err = j.clientStore.Lookup(clientID)
+			if err != nil {
 				htmlutil.Error(w, j.basePath, "invalid_client", http.StatusForbidden)
 				return
 			}
+			if client.SessionName != "" {
+				sessionName = client.SessionName
+			}
 
-			if realUserID, err := j.peopleStore.Authenticate(userID, password); err == nil {
-				if err := j.peopleStore.SaveSession(r, w, time.Now(), realUserID, sessionName); err != nil {
+			var addr = httputil.RemoteAddr(r)
+			if _, err := j.lockoutGuard.Reserve(userID, addr); errors.Is(err, lockout.ErrTooManyFailures) {
+				message = err.Error()
+			} else if err != nil {
+				htmlutil.Error(w, j.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			} else if realUserID, err := j.peopleStore.Authenticate(userID, password); err == nil {
+				log.Printf("user_id=%s", realUserID)
+				if err := j.lockoutGuard.Succeeded(userID, addr); err != nil {
 					htmlutil.Error(w, j.basePath, err.Error(), http.StatusInternalServerError)
 					return
 				}
-				log.Printf("user_id=%s", realUserID)
-				httputil.RedirectQuery(w, r, strings.TrimRight(j.issuer, "/")+"/authorize", r.URL.Query())
+				var path, err = startSession(j.peopleStore, j.sessionStore, j.mfaPolicy, r, w, *client, sessionName, realUserID, people.MethodPassword)
+				if err != nil {
+					htmlutil.Error(w, j.basePath, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				httputil.RedirectQuery(w, r, strings.TrimRight(j.issuer, "/")+path, r.URL.Query())
 				return
 			} else {
 				message = err.Error()
@@ -92,19 +111,27 @@ func (j *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"message":        message,
 		"user_id":        userID,
 		"password_empty": password == "",
+		"passkeys":       j.mfaPolicy.PasskeyStore != nil,
+		"email_login":    j.emailLogin,
+		"password_reset": j.passwordReset,
 	})
 	if err != nil {
 		htmlutil.Error(w, j.basePath, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func LoginHandler(basePath string, peopleStore people.Store, clientStore clients.Store, issuer, sessionName string) http.Handler {
+func LoginHandler(basePath string, peopleStore people.Store, clientStore clients.Store, sessionStore sessions.Store, mfaPolicy oauth2.MFAPolicy, lockoutGuard *lockout.Guard, emailLogin, passwordReset bool, issuer, sessionName string) http.Handler {
 	return &loginHandler{
-		basePath:    basePath,
-		peopleStore: peopleStore,
-		clientStore: clientStore,
-		issuer:      issuer,
-		sessionName: sessionName,
-		tpl:         template.Must(template.New("login").Parse(loginTpl)),
+		basePath:      basePath,
+		peopleStore:   peopleStore,
+		clientStore:   clientStore,
+		sessionStore:  sessionStore,
+		mfaPolicy:     mfaPolicy,
+		lockoutGuard:  lockoutGuard,
+		emailLogin:    emailLogin,
+		passwordReset: passwordReset,
+		issuer:        issuer,
+		sessionName:   sessionName,
+		tpl:           template.Must(template.New("login").Parse(loginTpl)),
 	}
 }
@@ -0,0 +1,265 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/cwkr/authd/internal/totp"
+	"github.com/gorilla/sessions"
+	"github.com/skip2/go-qrcode"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+//go:embed templates/otp.gohtml
+var otpTpl string
+
+type otpHandler struct {
+	basePath     string
+	peopleStore  people.Store
+	clientStore  clients.Store
+	sessionStore sessions.Store
+	issuer       string
+	issuerName   string
+	sessionName  string
+	mfaPolicy    oauth2.MFAPolicy
+	lockoutGuard *lockout.Guard
+	tpl          *template.Template
+	mutex        sync.Mutex
+	// usedSteps holds the last accepted time step per user so a passcode can not be replayed
+	usedSteps map[string]int64
+}
+
+func (o *otpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	httputil.NoCache(w)
+
+	var clientID = strings.ToLower(r.FormValue("client_id"))
+	if clientID == "" {
+		htmlutil.Error(w, o.basePath, "client_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	var sessionName, err = clientSessionName(o.clientStore, clientID, o.sessionName)
+	if err != nil {
+		htmlutil.Error(w, o.basePath, "invalid_client", http.StatusForbidden)
+		return
+	}
+
+	var issuer = strings.TrimRight(o.issuer, "/")
+	var session, _ = o.sessionStore.Get(r, sessionName)
+	var userID, pending = pendingLogin(session)
+	if !pending {
+		httputil.RedirectQuery(w, r, issuer+"/login", r.URL.Query())
+		return
+	}
+
+	var otpStore, ok = o.peopleStore.(people.OTPStore)
+	if !ok {
+		htmlutil.Error(w, o.basePath, "multi-factor authentication required but not supported by people store", http.StatusForbidden)
+		return
+	}
+
+	credentials, err := otpStore.LookupOTP(userID)
+	if err != nil && !errors.Is(err, people.ErrOTPNotEnrolled) {
+		htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var enrolled = err == nil
+
+	// users with a passkey have to use it, enrolling a one-time password would let the password alone add a factor
+	if !enrolled && o.mfaPolicy.PasskeyStore != nil {
+		if passkeyCredentials, err := o.mfaPolicy.PasskeyStore.List(userID); err != nil {
+			htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+			return
+		} else if len(passkeyCredentials) > 0 {
+			httputil.RedirectQuery(w, r, issuer+"/login/webauthn", r.URL.Query())
+			return
+		}
+	}
+
+	var message, secret string
+	if !enrolled {
+		if secret, _ = session.Values["mfa_secret"].(string); secret == "" {
+			if secret, err = totp.GenerateSecret(); err != nil {
+				htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			session.Values["mfa_secret"] = secret
+			if err := session.Save(r, w); err != nil {
+				htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		var passcode = strings.TrimSpace(r.PostFormValue("code"))
+		if enrolled {
+			// wrong codes count like wrong passwords, the pending login alone could be replayed with a copy of the cookie
+			var addr = httputil.RemoteAddr(r)
+			if _, err := o.lockoutGuard.Reserve(userID, addr); errors.Is(err, lockout.ErrTooManyFailures) {
+				message = err.Error()
+			} else if err != nil {
+				htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			} else if o.verify(userID, credentials, passcode) {
+				if o.succeeded(w, r, session, userID, addr) {
+					httputil.RedirectQuery(w, r, issuer+"/authorize", r.URL.Query())
+				}
+				return
+			} else if i := totp.MatchRecoveryCode(credentials.RecoveryCodes, passcode); i >= 0 {
+				// recovery codes can only be used once
+				credentials.RecoveryCodes = slices.Delete(credentials.RecoveryCodes, i, i+1)
+				if err := otpStore.PutOTP(userID, credentials); errors.Is(err, people.ErrReadOnly) {
+					htmlutil.Error(w, o.basePath, "recovery codes can not be used with a read-only people store", http.StatusForbidden)
+					return
+				} else if err != nil {
+					htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				log.Printf("user_id=%s used recovery code, %d left", userID, len(credentials.RecoveryCodes))
+				if o.succeeded(w, r, session, userID, addr) {
+					httputil.RedirectQuery(w, r, issuer+"/authorize", r.URL.Query())
+				}
+				return
+			} else {
+				message = "invalid code"
+			}
+		} else if step, valid := totp.Validate(secret, passcode, time.Now()); valid && o.useStep(userID, step) {
+			var codes, hashes, err = totp.GenerateRecoveryCodes(recoveryCodeCount)
+			if err != nil {
+				htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := otpStore.PutOTP(userID, &people.OTPCredentials{Secret: secret, RecoveryCodes: hashes}); errors.Is(err, people.ErrReadOnly) {
+				htmlutil.Error(w, o.basePath, "one-time passwords can not be enrolled with a read-only people store", http.StatusForbidden)
+				return
+			} else if err != nil {
+				htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("user_id=%s enrolled for one-time passwords", userID)
+			if !o.completeLogin(w, r, session, userID) {
+				return
+			}
+			o.render(w, map[string]any{
+				"base_path":      o.basePath,
+				"recovery_codes": codes,
+				"continue":       template.URL(issuer + "/authorize?" + r.URL.RawQuery),
+			})
+			return
+		} else {
+			message = "invalid code"
+		}
+
+		// the pending login ends after too many wrong codes, the user has to start over with the password
+		var failures, _ = session.Values["mfa_failures"].(int)
+		if failures++; failures >= maxCodeAttempts {
+			log.Printf("!!! too many wrong codes for user_id=%s, pending login dropped", userID)
+			dropPendingLogin(session)
+		} else {
+			session.Values["mfa_failures"] = failures
+		}
+		if err := session.Save(r, w); err != nil {
+			htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if failures >= maxCodeAttempts {
+			httputil.RedirectQuery(w, r, issuer+"/login", r.URL.Query())
+			return
+		}
+	}
+
+	var data = map[string]any{
+		"base_path": o.basePath,
+		"query":     template.HTML("?" + r.URL.RawQuery),
+		"message":   message,
+		"enrolled":  enrolled,
+		"passkeys":  o.mfaPolicy.PasskeyStore != nil,
+	}
+	if !enrolled {
+		var png, err = qrcode.Encode(totp.KeyURI(o.issuerName, userID, secret), qrcode.Medium, 256)
+		if err != nil {
+			htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["qr_code"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		data["secret"] = secret
+	}
+	o.render(w, data)
+}
+
+func (o *otpHandler) verify(userID string, credentials *people.OTPCredentials, passcode string) bool {
+	if step, valid := totp.Validate(credentials.Secret, passcode, time.Now()); valid {
+		return o.useStep(userID, step)
+	}
+	return false
+}
+
+// useStep accepts every time step only once per user
+func (o *otpHandler) useStep(userID string, step int64) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var key = strings.ToLower(userID)
+	if lastStep, found := o.usedSteps[key]; found && step <= lastStep {
+		log.Printf("!!! one-time password replayed for user_id=%s", userID)
+		return false
+	}
+	o.usedSteps[key] = step
+	return true
+}
+
+// succeeded forgets the failed attempts of the user and completes the login
+func (o *otpHandler) succeeded(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID, addr string) bool {
+	if err := o.lockoutGuard.Succeeded(userID, addr); err != nil {
+		htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return o.completeLogin(w, r, session, userID)
+}
+
+func (o *otpHandler) completeLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID string) bool {
+	var methods = append(pendingMethods(session), people.MethodOTP)
+	if err := completePendingLogin(o.peopleStore, r, w, session, userID, methods); err != nil {
+		htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (o *otpHandler) render(w http.ResponseWriter, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if err := o.tpl.ExecuteTemplate(w, "otp", data); err != nil {
+		htmlutil.Error(w, o.basePath, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func OTPHandler(basePath string, peopleStore people.Store, clientStore clients.Store, sessionStore sessions.Store, mfaPolicy oauth2.MFAPolicy, lockoutGuard *lockout.Guard, issuer, issuerName, sessionName string) http.Handler {
+	return &otpHandler{
+		basePath:     basePath,
+		peopleStore:  peopleStore,
+		clientStore:  clientStore,
+		sessionStore: sessionStore,
+		issuer:       issuer,
+		issuerName:   issuerName,
+		sessionName:  sessionName,
+		mfaPolicy:    mfaPolicy,
+		lockoutGuard: lockoutGuard,
+		tpl:          template.Must(template.New("otp").Parse(otpTpl)),
+		usedSteps:    make(map[string]int64),
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"github.com/cwkr/authd/internal/totp"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testOTPSecret = "TFYQH6WRILYOPHQHURSRFTF5A5GDKKQC"
+
+func (w *webAuthnTest) otp(client *http.Client, code string) (int, []byte) {
+	return w.do(client, http.MethodPost, "/login/otp?client_id=app", "application/x-www-form-urlencoded", []byte("code="+code))
+}
+
+func TestOTPLogin(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	var client = test.browser()
+	test.passwordLogin(client, "bob")
+
+	var code, err = totp.Code(testOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := test.otp(client, code); status != http.StatusFound {
+		t.Fatalf("otp: %d", status)
+	}
+	if session := test.whoami(client); session == nil || !session.MultiFactor() {
+		t.Fatalf("session after otp: %+v", session)
+	}
+}
+
+func TestOTPAttemptsLimited(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	var client = test.browser()
+	test.passwordLogin(client, "bob")
+	var status, _ = test.do(client, http.MethodGet, "/login/otp?client_id=app", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("otp page: %d", status)
+	}
+	// keep a copy of the pending login to replay it later
+	var replayed = test.browser()
+	var serverURL, _ = http.NewRequest(http.MethodGet, test.server.URL, nil)
+	replayed.Jar.SetCookies(serverURL.URL, client.Jar.Cookies(serverURL.URL))
+
+	for i := 1; i < maxCodeAttempts; i++ {
+		if status, body := test.otp(client, "000000"); status != http.StatusOK {
+			t.Fatalf("wrong code %d: %d", i, status)
+		} else if !bytes.Contains(body, []byte("invalid code")) && !bytes.Contains(body, []byte("too many failed")) {
+			t.Fatalf("wrong code %d: no message", i)
+		}
+	}
+	if status, _ := test.otp(client, "000000"); status != http.StatusFound {
+		t.Fatalf("last wrong code: %d", status)
+	}
+	// the pending login is gone
+	if status, _ := test.do(client, http.MethodGet, "/login/otp?client_id=app", "", nil); status != http.StatusFound {
+		t.Errorf("otp page after too many codes: %d", status)
+	}
+
+	// a copy of the pending login can not be used for further guesses, even with the right code
+	var code, err = totp.Code(testOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := test.otp(replayed, code); status != http.StatusOK || !strings.Contains(string(body), "too many failed") {
+		t.Errorf("replayed pending login: %d", status)
+	}
+	if session := test.whoami(replayed); session != nil {
+		t.Errorf("replayed pending login logged in: %+v", session)
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/mail"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/cwkr/authd/settings"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates/passwordreset.gohtml
+var passwordResetTpl string
+
+type passwordResetHandler struct {
+	basePath       string
+	peopleStore    people.Store
+	hashStore      people.PasswordHashStore
+	trlStore       trl.Store
+	lockoutGuard   *lockout.Guard
+	passwordPolicy people.PasswordPolicy
+	mailer         mail.Mailer
+	settings       settings.PasswordReset
+	secret         []byte
+	issuer         string
+	tpl            *template.Template
+	mutex          sync.Mutex
+	sent           map[string][]time.Time
+}
+
+func (p *passwordResetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	httputil.NoCache(w)
+	// keep the token out of referrer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if r.FormValue("client_id") == "" {
+		htmlutil.Error(w, p.basePath, "client_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	var message string
+	var userID string
+	var tokenValid, mailSent, passwordChanged bool
+	if token := r.URL.Query().Get("token"); token != "" {
+		if userID, tokenValid = p.verify(token); !tokenValid {
+			message = "the reset link is invalid or expired"
+		} else if r.Method == http.MethodPost {
+			var password = r.PostFormValue("password")
+			if password != r.PostFormValue("password_confirmation") {
+				message = "passwords do not match"
+			} else if err := p.reset(userID, password); err != nil {
+				var policyError *people.PolicyError
+				if !errors.As(err, &policyError) {
+					htmlutil.Error(w, p.basePath, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				message = policyError.Error()
+			} else {
+				passwordChanged = true
+			}
+		}
+	} else if r.Method == http.MethodPost {
+		if userID = strings.TrimSpace(r.PostFormValue("user_id")); userID != "" {
+			p.send(r, userID)
+			mailSent = true
+		} else {
+			message = "username must not be empty"
+		}
+	}
+
+	var params = r.URL.Query()
+	params.Del("token")
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	var err = p.tpl.ExecuteTemplate(w, "passwordreset", map[string]any{
+		"base_path":        p.basePath,
+		"query":            template.HTML("?" + r.URL.RawQuery),
+		"login_query":      template.HTML("?" + params.Encode()),
+		"message":          message,
+		"token_valid":      tokenValid && !passwordChanged,
+		"mail_sent":        mailSent,
+		"password_changed": passwordChanged,
+	})
+	if err != nil {
+		htmlutil.Error(w, p.basePath, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// reset sets the new password, which invalidates the reset link, and revokes all sessions and tokens of the user
+func (p *passwordResetHandler) reset(userID, password string) error {
+	if err := p.passwordPolicy.Check(p.peopleStore, userID, password); err != nil {
+		return err
+	}
+	if err := p.peopleStore.SetPassword(userID, password); err != nil {
+		return err
+	}
+	log.Printf("user_id=%s reset password", userID)
+	if err := oauth2.RevokeTokens(p.trlStore, userID, "", time.Now()); err != nil {
+		return err
+	}
+	return p.lockoutGuard.Unlock(userID)
+}
+
+// send mails a reset link to the user, unknown users and exceeded limits are only logged and the mail is sent in the
+// background, so the answer does not tell whether the account exists
+func (p *passwordResetHandler) send(r *http.Request, userID string) {
+	var person, err = p.peopleStore.Lookup(userID)
+	if err != nil || person.Email == "" {
+		log.Printf("!!! no email address for user_id=%s", userID)
+		return
+	}
+
+	p.mutex.Lock()
+	var now = time.Now()
+	p.purge(now)
+	var key = strings.ToLower(userID)
+	if len(p.sent[key]) >= p.settings.MaxMessages {
+		p.mutex.Unlock()
+		log.Printf("!!! too many password reset emails for user_id=%s", userID)
+		return
+	}
+	p.sent[key] = append(p.sent[key], now)
+	p.mutex.Unlock()
+
+	passwordHash, err := p.hashStore.PasswordHash(userID)
+	if err != nil {
+		log.Printf("!!! no password hash for user_id=%s: %v", userID, err)
+		return
+	}
+
+	var params = r.URL.Query()
+	params.Set("token", p.sign(userID, passwordHash, now))
+	var link = strings.TrimRight(p.issuer, "/") + "/login/reset?" + params.Encode()
+	var body = fmt.Sprintf("Open the following link to choose a new password:\n\n%s\n\n"+
+		"The link is valid for %d minutes and can be used once. If you did not ask to reset your password, ignore this email.\n",
+		link, p.settings.LinkTTL/60)
+	go func() {
+		if err := p.mailer.Send(person.Email, p.settings.Subject, body); err != nil {
+			log.Printf("!!! sending password reset email failed: %v", err)
+		}
+	}()
+}
+
+// purge drops mails sent more than an hour ago, the caller holds the lock
+func (p *passwordResetHandler) purge(now time.Time) {
+	for userID, sent := range p.sent {
+		for len(sent) > 0 && sent[0].Add(time.Hour).Before(now) {
+			sent = sent[1:]
+		}
+		if len(sent) == 0 {
+			delete(p.sent, userID)
+		} else {
+			p.sent[userID] = sent
+		}
+	}
+}
+
+// mac binds the payload to the current password hash of the user, so every password change invalidates the token
+func (p *passwordResetHandler) mac(payload, passwordHash string) string {
+	var mac = hmac.New(sha256.New, p.secret)
+	mac.Write([]byte("password_reset:" + payload + "|" + passwordHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sign returns a token holding the user id and the time it was issued at
+func (p *passwordResetHandler) sign(userID, passwordHash string, issuedAt time.Time) string {
+	var payload = base64.RawURLEncoding.EncodeToString([]byte(strings.ToLower(userID) + "|" + strconv.FormatInt(issuedAt.Unix(), 10)))
+	return payload + "." + p.mac(payload, passwordHash)
+}
+
+// verify returns the user id of a token that has not expired yet and was issued for the current password of the user,
+// which makes it single-use
+func (p *passwordResetHandler) verify(token string) (string, bool) {
+	var payload, signature, _ = strings.Cut(token, ".")
+	var decoded, err = base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	var userID, iat, _ = strings.Cut(string(decoded), "|")
+	var seconds, _ = strconv.ParseInt(iat, 10, 64)
+	if time.Unix(seconds, 0).Add(time.Duration(p.settings.LinkTTL) * time.Second).Before(time.Now()) {
+		return "", false
+	}
+	passwordHash, err := p.hashStore.PasswordHash(userID)
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal([]byte(p.mac(payload, passwordHash)), []byte(signature)) {
+		return "", false
+	}
+	return userID, true
+}
+
+func PasswordResetHandler(basePath string, peopleStore people.Store, hashStore people.PasswordHashStore, trlStore trl.Store, lockoutGuard *lockout.Guard, passwordPolicy people.PasswordPolicy,
+	mailer mail.Mailer, passwordReset settings.PasswordReset, secret []byte, issuer string) http.Handler {
+	return &passwordResetHandler{
+		basePath:       basePath,
+		peopleStore:    peopleStore,
+		hashStore:      hashStore,
+		trlStore:       trlStore,
+		lockoutGuard:   lockoutGuard,
+		passwordPolicy: passwordPolicy,
+		mailer:         mailer,
+		settings:       passwordReset,
+		secret:         secret,
+		issuer:         issuer,
+		tpl:            template.Must(template.New("passwordreset").Parse(passwordResetTpl)),
+		sent:           make(map[string][]time.Time),
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"github.com/cwkr/authd/internal/passwordhash"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/cwkr/authd/settings"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writablePeopleStore keeps password hashes of embedded users in memory
+type writablePeopleStore struct {
+	people.Store
+	mutex  sync.Mutex
+	hashes map[string]string
+}
+
+func (w *writablePeopleStore) ReadOnly() bool {
+	return false
+}
+
+func (w *writablePeopleStore) SetPassword(userID, password string) error {
+	var hasher, _ = passwordhash.NewHasher(passwordhash.Settings{Algorithm: "bcrypt", Cost: 4})
+	var hash, err = hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.hashes[strings.ToLower(userID)] = hash
+	return nil
+}
+
+func (w *writablePeopleStore) PasswordHash(userID string) (string, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if hash, found := w.hashes[strings.ToLower(userID)]; found {
+		return hash, nil
+	}
+	return "", people.ErrPersonNotFound
+}
+
+type testMailer chan string
+
+func (m testMailer) Send(to, subject, body string) error {
+	m <- body
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	var peopleStore = &writablePeopleStore{
+		Store: people.NewEmbeddedStore(nil, map[string]people.AuthenticPerson{
+			"alice": {Person: people.Person{Email: "alice@example.com"}},
+		}, 3600),
+		hashes: map[string]string{"alice": "$2a$04$initial"},
+	}
+	var mailer = make(testMailer, 1)
+	var handler = PasswordResetHandler("", peopleStore, peopleStore, trl.NewNoopStore(), lockout.NewGuard(lockout.NewInMemoryStore(lockout.Settings{}), lockout.Settings{}),
+		people.DefaultPasswordPolicy, mailer, settings.PasswordReset{LinkTTL: 900, MaxMessages: 3, Subject: "Reset"}, []byte("secret"), "http://localhost")
+
+	var post = func(query string, form url.Values) string {
+		var r = httptest.NewRequest(http.MethodPost, "/login/reset?"+query, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s: %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	post("client_id=app", url.Values{"user_id": {"Alice"}})
+	var body string
+	select {
+	case body = <-mailer:
+	case <-time.After(time.Second):
+		t.Fatal("no reset email sent")
+	}
+	var link = regexp.MustCompile(`http://localhost/login/reset\?\S+`).FindString(body)
+	var linkURL, err = url.Parse(link)
+	if err != nil || linkURL.Query().Get("token") == "" {
+		t.Fatalf("no reset link in %q", body)
+	}
+
+	var password = url.Values{"password": {"Correct-Horse-42"}, "password_confirmation": {"Correct-Horse-42"}}
+	if page := post(linkURL.RawQuery, password); !strings.Contains(page, "Your password has been changed") {
+		t.Fatalf("reset failed: %s", page)
+	}
+	if page := post(linkURL.RawQuery, password); !strings.Contains(page, "the reset link is invalid or expired") {
+		t.Errorf("reset link used twice: %s", page)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pendingLoginTTL is how long a password login waits for the second factor
+const pendingLoginTTL = 5 * time.Minute
+
+// enrollmentMaxAge is how long after a multi-factor login another factor can be added to the active session
+const enrollmentMaxAge = 5 * time.Minute
+
+// clientSessionName returns the session name of the client or the default session name
+func clientSessionName(clientStore clients.Store, clientID, sessionName string) (string, error) {
+	var client, err = clientStore.Lookup(clientID)
+	if err != nil {
+		return "", err
+	}
+	if client.SessionName != "" {
+		return client.SessionName, nil
+	}
+	return sessionName, nil
+}
+
+// savePendingLogin remembers a user who passed the first factor, or a step-up user with the methods of the active
+// session, until the next factor is verified
+func savePendingLogin(sessionStore sessions.Store, r *http.Request, w http.ResponseWriter, sessionName, userID string, methods []string, authTime time.Time) error {
+	var session, _ = sessionStore.Get(r, sessionName)
+	session.Values["mfa_uid"] = userID
+	session.Values["mfa_at"] = authTime.Unix()
+	session.Values["mfa_amr"] = strings.Join(methods, " ")
+	delete(session.Values, "mfa_secret")
+	delete(session.Values, "mfa_failures")
+	return session.Save(r, w)
+}
+
+// pendingLogin returns the user waiting for the second factor
+func pendingLogin(session *sessions.Session) (string, bool) {
+	var userID, _ = session.Values["mfa_uid"].(string)
+	var authTime, _ = session.Values["mfa_at"].(int64)
+	if userID == "" || time.Unix(authTime, 0).Add(pendingLoginTTL).Before(time.Now()) {
+		return "", false
+	}
+	return userID, true
+}
+
+// otpEnrolled reports whether the user has a TOTP secret
+func otpEnrolled(peopleStore people.Store, userID string) (bool, error) {
+	var otpStore, ok = peopleStore.(people.OTPStore)
+	if !ok {
+		return false, nil
+	}
+	if _, err := otpStore.LookupOTP(userID); err == nil {
+		return true, nil
+	} else if errors.Is(err, people.ErrOTPNotEnrolled) {
+		return false, nil
+	} else {
+		return false, err
+	}
+}
+
+// pendingMethods returns the authentication methods the pending login already passed
+func pendingMethods(session *sessions.Session) []string {
+	if methods, _ := session.Values["mfa_amr"].(string); strings.TrimSpace(methods) != "" {
+		return strings.Fields(methods)
+	}
+	return []string{people.MethodPassword}
+}
+
+// startSession saves the session of a user who passed the first factor or, when the user needs a second factor, a
+// pending login, it returns the path to continue with
+func startSession(peopleStore people.Store, sessionStore sessions.Store, mfaPolicy oauth2.MFAPolicy, r *http.Request, w http.ResponseWriter,
+	client clients.Client, sessionName, userID, firstFactor string) (string, error) {
+	if required, err := mfaPolicy.SecondFactorRequired(peopleStore, client, userID); err != nil {
+		return "", err
+	} else if required {
+		if err := savePendingLogin(sessionStore, r, w, sessionName, userID, []string{firstFactor}, time.Now()); err != nil {
+			return "", err
+		}
+		// passkeys are preferred over one-time passwords
+		if mfaPolicy.PasskeyStore != nil {
+			if credentials, err := mfaPolicy.PasskeyStore.List(userID); err == nil && len(credentials) > 0 {
+				return "/login/webauthn", nil
+			}
+		}
+		return "/login/otp", nil
+	}
+	var session = people.Session{UserID: userID, AuthTime: time.Now(), Methods: []string{firstFactor}}
+	return "/authorize", peopleStore.SaveSession(r, w, session, sessionName)
+}
+
+// dropPendingLogin forgets the pending login, the session has to be saved afterwards
+func dropPendingLogin(session *sessions.Session) {
+	delete(session.Values, "mfa_uid")
+	delete(session.Values, "mfa_at")
+	delete(session.Values, "mfa_amr")
+	delete(session.Values, "mfa_secret")
+	delete(session.Values, "mfa_failures")
+}
+
+// completePendingLogin replaces the pending login by an active session
+func completePendingLogin(peopleStore people.Store, r *http.Request, w http.ResponseWriter, session *sessions.Session, userID string, methods []string) error {
+	dropPendingLogin(session)
+	return peopleStore.SaveSession(r, w, people.Session{UserID: userID, AuthTime: time.Now(), Methods: methods}, session.Name())
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/lockout"
 	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
 	"github.com/cwkr/authd/internal/people"
 	"github.com/cwkr/authd/internal/stringutil"
 	"github.com/cwkr/authd/settings"
@@ -16,7 +18,10 @@ import (
 	"strings"
 )
 
-const ErrorAccessDenied = "access_denied"
+const (
+	ErrorAccessDenied    = "access_denied"
+	ErrorInvalidPassword = "invalid_password"
+)
 
 type peopleAPIHandler struct {
 	peopleStore    people.Store
@@ -65,7 +70,7 @@ func (p *peopleAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var err error
 		if customVersion, found := p.customVersions[apiVersion]; found {
 			var claims = make(map[string]any)
-			oauth2.AddExtraClaims(claims, customVersion.Attributes, user, "", p.roleMappings)
+			oauth2.AddExtraClaims(claims, customVersion.Attributes, user, clients.Client{}, p.roleMappings)
 			if filterParamName := strings.TrimSpace(customVersion.FilterParam); filterParamName != "" {
 				var attrsToFetch = cleanup(strings.Split(strings.Join(r.URL.Query()[filterParamName], ","), ","))
 				if len(attrsToFetch) > 0 {
@@ -76,7 +81,7 @@ func (p *peopleAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
-			oauth2.AddExtraClaims(claims, customVersion.FixedAttributes, user, "", p.roleMappings)
+			oauth2.AddExtraClaims(claims, customVersion.FixedAttributes, user, clients.Client{}, p.roleMappings)
 			bytes, err = json.Marshal(claims)
 		} else if apiVersion == "v1" {
 			bytes, err = json.Marshal(personWithRoles{Person: *person, Roles: p.roleMappings.Roles(user)})
@@ -153,7 +158,26 @@ type PasswordChange struct {
 	NewPassword string `json:"new_password"`
 }
 
-func ChangePasswordHandler(peopleStore people.Store) http.Handler {
+// PasswordPolicyErrorResponse lists every rule of the password policy the new password violates
+type PasswordPolicyErrorResponse struct {
+	oauth2.ErrorResponse
+	Violations []people.PolicyViolation `json:"violations"`
+}
+
+func passwordPolicyError(w http.ResponseWriter, policyError *people.PolicyError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	httputil.NoCache(w)
+
+	w.WriteHeader(http.StatusBadRequest)
+	var bytes, _ = json.Marshal(PasswordPolicyErrorResponse{
+		ErrorResponse: oauth2.ErrorResponse{Error: ErrorInvalidPassword, ErrorDescription: policyError.Error()},
+		Violations:    policyError.Violations,
+	})
+	w.Write(bytes)
+}
+
+func ChangePasswordHandler(peopleStore people.Store, passwordPolicy people.PasswordPolicy, lockoutGuard *lockout.Guard) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s", r.Method, r.URL)
 
@@ -188,10 +212,32 @@ func ChangePasswordHandler(peopleStore people.Store) http.Handler {
 			return
 		}
 
+		// the old password can be guessed with a stolen access token
+		var addr = httputil.RemoteAddr(r)
+		if _, err := lockoutGuard.Reserve(userID, addr); errors.Is(err, lockout.ErrTooManyFailures) {
+			oauth2.Error(w, oauth2.ErrorInvalidRequest, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		if _, err := peopleStore.Authenticate(userID, passwordChange.OldPassword); err != nil {
 			oauth2.Error(w, oauth2.ErrorInvalidRequest, "", http.StatusBadRequest)
 			return
 		}
+		if err := lockoutGuard.Succeeded(userID, addr); err != nil {
+			oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var policyError *people.PolicyError
+		if err := passwordPolicy.Check(peopleStore, userID, passwordChange.NewPassword); errors.As(err, &policyError) {
+			passwordPolicyError(w, policyError)
+			return
+		} else if err != nil {
+			oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		if err := peopleStore.SetPassword(userID, passwordChange.NewPassword); err != nil {
 			log.Printf("!!! Update failed: %v", err)
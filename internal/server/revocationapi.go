@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Revocation struct {
+	UserID        string `json:"user_id,omitempty"`
+	ClientID      string `json:"client_id,omitempty"`
+	RevokedBefore int64  `json:"revoked_before,omitempty"`
+}
+
+// RevokeTokensHandler revokes all tokens of a user, a client or a user and client, it is restricted to the admin clients
+func RevokeTokensHandler(clientStore clients.Store, trlStore trl.Store, adminClients []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+
+		httputil.AllowCORS(w, r, []string{http.MethodOptions, http.MethodPost}, true)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var clientID, clientSecret, basicAuth = r.BasicAuth()
+		if !basicAuth {
+			w.Header().Set("WWW-Authenticate", "Basic")
+			oauth2.Error(w, oauth2.ErrorInvalidClient, "client authentication required", http.StatusUnauthorized)
+			return
+		}
+		if _, err := clientStore.Authenticate(clientID, clientSecret); err != nil {
+			oauth2.Error(w, oauth2.ErrorInvalidClient, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !slices.ContainsFunc(adminClients, func(adminClient string) bool { return strings.EqualFold(adminClient, clientID) }) {
+			oauth2.Error(w, ErrorAccessDenied, "", http.StatusForbidden)
+			return
+		}
+
+		var revocation Revocation
+
+		if bytes, err := io.ReadAll(r.Body); err == nil {
+			if err := json.Unmarshal(bytes, &revocation); err != nil {
+				oauth2.Error(w, oauth2.ErrorInvalidRequest, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			oauth2.Error(w, oauth2.ErrorInvalidRequest, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if strings.TrimSpace(revocation.UserID) == "" && strings.TrimSpace(revocation.ClientID) == "" {
+			oauth2.Error(w, oauth2.ErrorInvalidRequest, "user_id or client_id is required", http.StatusBadRequest)
+			return
+		}
+
+		var revokedBefore = time.Now()
+		if revocation.RevokedBefore > 0 {
+			revokedBefore = time.Unix(revocation.RevokedBefore, 0)
+		}
+
+		log.Printf("revoking tokens of user %q and client %q issued before %v", revocation.UserID, revocation.ClientID, revokedBefore)
+		if err := oauth2.RevokeTokens(trlStore, revocation.UserID, revocation.ClientID, revokedBefore); err != nil {
+			log.Printf("!!! Revocation failed: %v", err)
+			oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -12,6 +12,8 @@ import (
 var (
 	//go:embed scripts/main.js
 	mainScriptContent string
+	//go:embed scripts/webauthn.js
+	webAuthnScriptContent string
 )
 
 func MainScriptHandler() http.Handler {
@@ -23,3 +25,13 @@ func MainScriptHandler() http.Handler {
 		fmt.Fprint(w, mainScriptContent)
 	})
 }
+
+func WebAuthnScriptHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Header().Set("Content-Length", fmt.Sprint(len(webAuthnScriptContent)))
+		httputil.Cache(w, 120*time.Hour)
+		fmt.Fprint(w, webAuthnScriptContent)
+	})
+}
@@ -0,0 +1,90 @@
+function base64UrlToBuffer(value) {
+    const base64 = value.replaceAll("-", "+").replaceAll("_", "/");
+    const text = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, "="));
+    const bytes = new Uint8Array(text.length);
+    for (let i = 0; i < text.length; i++) {
+        bytes[i] = text.charCodeAt(i);
+    }
+    return bytes.buffer;
+}
+
+function bufferToBase64Url(buffer) {
+    const bytes = new Uint8Array(buffer);
+    let text = "";
+    for (let i = 0; i < bytes.length; i++) {
+        text += String.fromCharCode(bytes[i]);
+    }
+    return btoa(text).replaceAll("+", "-").replaceAll("/", "_").replace(/=+$/, "");
+}
+
+async function postJSON(url, body) {
+    const response = await fetch(url, {
+        method: "POST",
+        headers: {"Content-Type": "application/json"},
+        body: body ? JSON.stringify(body) : undefined,
+    });
+    const result = await response.json();
+    if (!response.ok) {
+        throw new Error(result.error_description || result.error);
+    }
+    return result;
+}
+
+async function register(basePath, query) {
+    const options = await postJSON(`${basePath}/login/webauthn/begin${query}&ceremony=register`);
+    const publicKey = options.publicKey;
+    publicKey.challenge = base64UrlToBuffer(publicKey.challenge);
+    publicKey.user.id = base64UrlToBuffer(publicKey.user.id);
+    publicKey.excludeCredentials?.forEach(credential => credential.id = base64UrlToBuffer(credential.id));
+    const credential = await navigator.credentials.create({publicKey});
+    return postJSON(`${basePath}/login/webauthn/finish${query}`, {
+        id: credential.id,
+        rawId: bufferToBase64Url(credential.rawId),
+        type: credential.type,
+        authenticatorAttachment: credential.authenticatorAttachment,
+        response: {
+            clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+            attestationObject: bufferToBase64Url(credential.response.attestationObject),
+            transports: credential.response.getTransports?.() ?? [],
+        },
+    });
+}
+
+async function login(basePath, query) {
+    const options = await postJSON(`${basePath}/login/webauthn/begin${query}&ceremony=login`);
+    const publicKey = options.publicKey;
+    publicKey.challenge = base64UrlToBuffer(publicKey.challenge);
+    publicKey.allowCredentials?.forEach(credential => credential.id = base64UrlToBuffer(credential.id));
+    const credential = await navigator.credentials.get({publicKey});
+    return postJSON(`${basePath}/login/webauthn/finish${query}`, {
+        id: credential.id,
+        rawId: bufferToBase64Url(credential.rawId),
+        type: credential.type,
+        authenticatorAttachment: credential.authenticatorAttachment,
+        response: {
+            clientDataJSON: bufferToBase64Url(credential.response.clientDataJSON),
+            authenticatorData: bufferToBase64Url(credential.response.authenticatorData),
+            signature: bufferToBase64Url(credential.response.signature),
+            userHandle: credential.response.userHandle ? bufferToBase64Url(credential.response.userHandle) : null,
+        },
+    });
+}
+
+document.querySelectorAll("button[data-ceremony]").forEach(button => {
+    if (!window.PublicKeyCredential) {
+        button.disabled = true;
+        return;
+    }
+    button.addEventListener("click", async event => {
+        event.preventDefault();
+        const message = document.getElementById("webauthn_message");
+        message.textContent = "";
+        const ceremony = button.dataset.ceremony === "register" ? register : login;
+        try {
+            const result = await ceremony(button.dataset.basePath, window.location.search);
+            window.location.href = result.redirect_uri;
+        } catch (error) {
+            message.textContent = error.message;
+        }
+    });
+});
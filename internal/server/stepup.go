@@ -0,0 +1,123 @@
+package server
+
+import (
+	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrorUnmetAuthenticationRequirements is returned when the requested acr can not be reached with the factors
+// available to the user
+const ErrorUnmetAuthenticationRequirements = "unmet_authentication_requirements"
+
+type stepUpHandler struct {
+	basePath     string
+	peopleStore  people.Store
+	clientStore  clients.Store
+	sessionStore sessions.Store
+	mfaPolicy    oauth2.MFAPolicy
+	issuer       string
+	sessionName  string
+}
+
+func (s *stepUpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	httputil.NoCache(w)
+
+	var clientID = strings.ToLower(r.FormValue("client_id"))
+	if clientID == "" {
+		htmlutil.Error(w, s.basePath, "client_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	var sessionName, err = clientSessionName(s.clientStore, clientID, s.sessionName)
+	if err != nil {
+		htmlutil.Error(w, s.basePath, "invalid_client", http.StatusForbidden)
+		return
+	}
+
+	var issuer = strings.TrimRight(s.issuer, "/")
+	var session, active = s.peopleStore.IsSessionActive(r, sessionName)
+	if !active {
+		httputil.RedirectQuery(w, r, issuer+"/login", r.URL.Query())
+		return
+	}
+	var level, unmet = s.mfaPolicy.ACRLevels.Unmet(r.FormValue("acr_values"), session.Methods)
+	if !unmet {
+		httputil.RedirectQuery(w, r, issuer+"/authorize", r.URL.Query())
+		return
+	}
+
+	// levels demanding a password are reached by logging in again
+	if level.Requires(people.MethodPassword) && !slices.Contains(session.Methods, people.MethodPassword) {
+		httputil.RedirectQuery(w, r, issuer+"/login", r.URL.Query())
+		return
+	}
+
+	path, err := s.nextFactor(level, *session)
+	if err != nil {
+		htmlutil.Error(w, s.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if path == "" {
+		log.Printf("!!! user_id=%s amr=%v can not step up to acr=%s", session.UserID, session.Methods, level.ACR)
+		htmlutil.Error(w, s.basePath, ErrorUnmetAuthenticationRequirements, http.StatusForbidden)
+		return
+	}
+
+	if err := savePendingLogin(s.sessionStore, r, w, sessionName, session.UserID, session.Methods, time.Now()); err != nil {
+		htmlutil.Error(w, s.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	httputil.RedirectQuery(w, r, issuer+path, r.URL.Query())
+}
+
+// nextFactor returns the path of the factor the session has not used yet or an empty string when there is none
+func (s *stepUpHandler) nextFactor(level oauth2.ACRLevel, session people.Session) (string, error) {
+	var (
+		passkeysEnabled = s.mfaPolicy.PasskeyStore != nil
+		passkeyUsed     = slices.Contains(session.Methods, people.MethodHardwareKey) || slices.Contains(session.Methods, people.MethodSoftwareKey)
+		otpUsed         = slices.Contains(session.Methods, people.MethodOTP)
+		_, otpSupported = s.peopleStore.(people.OTPStore)
+	)
+	if level.Requires(people.MethodHardwareKey, people.MethodSoftwareKey) {
+		if passkeysEnabled && !passkeyUsed {
+			return "/login/webauthn", nil
+		}
+		return "", nil
+	}
+	// passkeys are preferred over one-time passwords when the user has registered one
+	if passkeysEnabled && !passkeyUsed {
+		if credentials, err := s.mfaPolicy.PasskeyStore.List(session.UserID); err != nil {
+			return "", err
+		} else if len(credentials) > 0 {
+			return "/login/webauthn", nil
+		}
+	}
+	if otpSupported && !otpUsed {
+		return "/login/otp", nil
+	}
+	if passkeysEnabled && !passkeyUsed {
+		return "/login/webauthn", nil
+	}
+	return "", nil
+}
+
+func StepUpHandler(basePath string, peopleStore people.Store, clientStore clients.Store, sessionStore sessions.Store, mfaPolicy oauth2.MFAPolicy, issuer, sessionName string) http.Handler {
+	return &stepUpHandler{
+		basePath:     basePath,
+		peopleStore:  peopleStore,
+		clientStore:  clientStore,
+		sessionStore: sessionStore,
+		mfaPolicy:    mfaPolicy,
+		issuer:       issuer,
+		sessionName:  sessionName,
+	}
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/cwkr/authd/internal/htmlutil"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/passkeys"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	CeremonyLogin        = "login"
+	CeremonyRegistration = "register"
+)
+
+var errRegistrationDenied = errors.New("passkeys can only be added shortly after a login with a second factor")
+
+//go:embed templates/webauthn.gohtml
+var webAuthnTpl string
+
+type webAuthnHandler struct {
+	basePath     string
+	webAuthn     *webauthn.WebAuthn
+	passkeyStore passkeys.Store
+	peopleStore  people.Store
+	clientStore  clients.Store
+	sessionStore sessions.Store
+	issuer       string
+	sessionName  string
+	tpl          *template.Template
+}
+
+func (h *webAuthnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	httputil.NoCache(w)
+
+	var clientID = strings.ToLower(r.FormValue("client_id"))
+	if clientID == "" {
+		h.error(w, r, oauth2.ErrorInvalidRequest, "client_id parameter is required", http.StatusBadRequest)
+		return
+	}
+	var sessionName, err = clientSessionName(h.clientStore, clientID, h.sessionName)
+	if err != nil {
+		h.error(w, r, oauth2.ErrorInvalidClient, "invalid_client", http.StatusForbidden)
+		return
+	}
+	var session, _ = h.sessionStore.Get(r, sessionName)
+
+	switch mux.Vars(r)["step"] {
+	case "begin":
+		h.begin(w, r, session)
+	case "finish":
+		h.finish(w, r, session)
+	default:
+		h.page(w, r, session)
+	}
+}
+
+// error answers the ceremony steps with JSON and the page with HTML
+func (h *webAuthnHandler) error(w http.ResponseWriter, r *http.Request, error, description string, code int) {
+	if mux.Vars(r)["step"] == "" {
+		htmlutil.Error(w, h.basePath, description, code)
+	} else {
+		oauth2.Error(w, error, description, code)
+	}
+}
+
+// user returns the user waiting for the second factor, the user of the active session is only used with registrations
+func (h *webAuthnHandler) user(r *http.Request, session *sessions.Session, ceremony string) (*passkeys.User, bool, error) {
+	var userID, pending = pendingLogin(session)
+	if !pending {
+		if activeSession, active := h.peopleStore.IsSessionActive(r, session.Name()); active && ceremony == CeremonyRegistration {
+			userID = activeSession.UserID
+		} else {
+			return nil, false, nil
+		}
+	}
+	var person, err = h.peopleStore.Lookup(userID)
+	if err != nil {
+		return nil, pending, err
+	}
+	credentials, err := h.passkeyStore.List(userID)
+	if err != nil {
+		return nil, pending, err
+	}
+	var displayName = strings.TrimSpace(person.GivenName + " " + person.FamilyName)
+	return &passkeys.User{UserID: userID, DisplayName: displayName, Credentials: credentials}, pending, nil
+}
+
+// mayRegister reports whether another authenticator can be registered for the user. While a login is pending only
+// users without any second factor enroll one, otherwise the password alone would be enough to add a factor. Active
+// sessions have to be multi-factor and recent.
+func (h *webAuthnHandler) mayRegister(r *http.Request, session *sessions.Session, user *passkeys.User, pending bool) (bool, error) {
+	if pending {
+		if len(user.Credentials) > 0 {
+			return false, nil
+		}
+		var enrolled, err = otpEnrolled(h.peopleStore, user.UserID)
+		return !enrolled, err
+	}
+	var activeSession, active = h.peopleStore.IsSessionActive(r, session.Name())
+	return active && activeSession.MultiFactor() && time.Since(activeSession.AuthTime) <= enrollmentMaxAge, nil
+}
+
+func (h *webAuthnHandler) page(w http.ResponseWriter, r *http.Request, session *sessions.Session) {
+	var user, pending, err = h.user(r, session, CeremonyRegistration)
+	if err != nil {
+		htmlutil.Error(w, h.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		httputil.RedirectQuery(w, r, strings.TrimRight(h.issuer, "/")+"/login", r.URL.Query())
+		return
+	}
+	var ceremony = CeremonyRegistration
+	if pending && len(user.Credentials) > 0 {
+		ceremony = CeremonyLogin
+	} else if allowed, err := h.mayRegister(r, session, user, pending); err != nil {
+		htmlutil.Error(w, h.basePath, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !allowed && pending {
+		// the user has to pass the one-time password enrolled before
+		httputil.RedirectQuery(w, r, strings.TrimRight(h.issuer, "/")+"/login/otp", r.URL.Query())
+		return
+	} else if !allowed {
+		htmlutil.Error(w, h.basePath, errRegistrationDenied.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	err = h.tpl.ExecuteTemplate(w, "webauthn", map[string]any{
+		"base_path":   h.basePath,
+		"query":       template.HTML("?" + r.URL.RawQuery),
+		"ceremony":    ceremony,
+		"pending":     pending,
+		"credentials": len(user.Credentials),
+	})
+	if err != nil {
+		htmlutil.Error(w, h.basePath, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *webAuthnHandler) begin(w http.ResponseWriter, r *http.Request, session *sessions.Session) {
+	if r.Method != http.MethodPost {
+		h.error(w, r, oauth2.ErrorInvalidRequest, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var ceremony = r.FormValue("ceremony")
+	var user, pending, err = h.user(r, session, ceremony)
+	if err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		options     any
+		sessionData *webauthn.SessionData
+	)
+	switch {
+	case ceremony == CeremonyLogin && user == nil:
+		// passwordless login with a discoverable credential, the authenticator has to verify the user
+		options, sessionData, err = h.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	case ceremony == CeremonyLogin && pending && len(user.Credentials) > 0:
+		options, sessionData, err = h.webAuthn.BeginLogin(user)
+	case ceremony == CeremonyRegistration && user != nil:
+		if allowed, err := h.mayRegister(r, session, user, pending); err != nil {
+			h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !allowed {
+			h.error(w, r, ErrorAccessDenied, errRegistrationDenied.Error(), http.StatusForbidden)
+			return
+		}
+		options, sessionData, err = h.webAuthn.BeginRegistration(user,
+			webauthn.WithExclusions(user.CredentialDescriptors()),
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	default:
+		h.error(w, r, oauth2.ErrorInvalidRequest, "unsupported ceremony", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessionBytes, err := json.Marshal(sessionData)
+	if err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["webauthn"] = string(sessionBytes)
+	session.Values["webauthn_ceremony"] = ceremony
+	if err := session.Save(r, w); err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, options)
+}
+
+func (h *webAuthnHandler) finish(w http.ResponseWriter, r *http.Request, session *sessions.Session) {
+	if r.Method != http.MethodPost {
+		h.error(w, r, oauth2.ErrorInvalidRequest, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var sessionValue, _ = session.Values["webauthn"].(string)
+	var ceremony, _ = session.Values["webauthn_ceremony"].(string)
+	// every challenge can only be answered once
+	delete(session.Values, "webauthn")
+	delete(session.Values, "webauthn_ceremony")
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal([]byte(sessionValue), &sessionData); err != nil || sessionValue == "" {
+		h.error(w, r, oauth2.ErrorInvalidRequest, "no webauthn ceremony in progress", http.StatusBadRequest)
+		return
+	}
+	var user, pending, err = h.user(r, session, ceremony)
+	if err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		userID     string
+		credential *webauthn.Credential
+		methods    []string
+	)
+	switch {
+	case ceremony == CeremonyLogin && user == nil:
+		credential, err = h.webAuthn.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			var owner, _, err = h.passkeyStore.Lookup(rawID)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.EqualFold(owner, string(userHandle)) {
+				return nil, passkeys.ErrUserHandleMismatch
+			}
+			credentials, err := h.passkeyStore.List(owner)
+			if err != nil {
+				return nil, err
+			}
+			userID = owner
+			return passkeys.User{UserID: owner, Credentials: credentials}, nil
+		}, sessionData, r)
+	case ceremony == CeremonyLogin && pending:
+		userID = user.UserID
+		credential, err = h.webAuthn.FinishLogin(user, sessionData, r)
+		methods = pendingMethods(session)
+	case ceremony == CeremonyRegistration && user != nil:
+		if allowed, err := h.mayRegister(r, session, user, pending); err != nil {
+			h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !allowed {
+			h.error(w, r, ErrorAccessDenied, errRegistrationDenied.Error(), http.StatusForbidden)
+			return
+		}
+		userID = user.UserID
+		credential, err = h.webAuthn.FinishRegistration(user, sessionData, r)
+		if pending {
+			methods = pendingMethods(session)
+		}
+	default:
+		h.error(w, r, oauth2.ErrorInvalidRequest, "unsupported ceremony", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		var protocolError *protocol.Error
+		if errors.As(err, &protocolError) {
+			log.Printf("!!! webauthn %s failed: %s", ceremony, protocolError.DevInfo)
+		}
+		h.error(w, r, ErrorAccessDenied, err.Error(), http.StatusForbidden)
+		return
+	}
+	if credential.Authenticator.CloneWarning {
+		log.Printf("!!! signature counter of webauthn credential of user_id=%s went backwards, authenticator may be cloned", userID)
+		h.error(w, r, ErrorAccessDenied, "authenticator may be cloned", http.StatusForbidden)
+		return
+	}
+	if err := h.passkeyStore.Put(userID, *credential); err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user_id=%s webauthn %s", userID, ceremony)
+
+	if user == nil || pending {
+		methods = append(methods, passkeys.AuthMethod(*credential))
+		if err := completePendingLogin(h.peopleStore, r, w, session, userID, methods); err != nil {
+			h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if err := session.Save(r, w); err != nil {
+		h.error(w, r, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var params = r.URL.Query()
+	params.Del("ceremony")
+	h.writeJSON(w, map[string]string{"redirect_uri": strings.TrimRight(h.issuer, "/") + "/authorize?" + params.Encode()})
+}
+
+func (h *webAuthnHandler) writeJSON(w http.ResponseWriter, value any) {
+	var bytes, err = json.Marshal(value)
+	if err != nil {
+		oauth2.Error(w, oauth2.ErrorInternal, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(bytes)
+}
+
+// WebAuthnHandler serves the passkey page and the begin and finish steps of the registration and login ceremonies
+func WebAuthnHandler(basePath string, webAuthn *webauthn.WebAuthn, passkeyStore passkeys.Store, peopleStore people.Store, clientStore clients.Store, sessionStore sessions.Store, issuer, sessionName string) http.Handler {
+	return &webAuthnHandler{
+		basePath:     basePath,
+		webAuthn:     webAuthn,
+		passkeyStore: passkeyStore,
+		peopleStore:  peopleStore,
+		clientStore:  clientStore,
+		sessionStore: sessionStore,
+		issuer:       issuer,
+		sessionName:  sessionName,
+		tpl:          template.Must(template.New("webauthn").Parse(webAuthnTpl)),
+	}
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cwkr/authd/internal/lockout"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/clients"
+	"github.com/cwkr/authd/internal/passkeys"
+	"github.com/cwkr/authd/internal/people"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSessionName = "ASESSION"
+
+// softAuthenticator is a software authenticator holding one P-256 key
+type softAuthenticator struct {
+	t            *testing.T
+	rpID         string
+	origin       string
+	credentialID []byte
+	userHandle   []byte
+	key          *ecdsa.PrivateKey
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var credentialID = make([]byte, 16)
+	rand.Read(credentialID)
+	var originURL, _ = url.Parse(origin)
+	return &softAuthenticator{t: t, rpID: originURL.Hostname(), origin: origin, credentialID: credentialID, key: key}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, options map[string]any) []byte {
+	var publicKey = options["publicKey"].(map[string]any)
+	var clientData, _ = json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": publicKey["challenge"],
+		"origin":    a.origin,
+	})
+	return clientData
+}
+
+// authenticatorData returns the rp id hash, flags (user present, user verified, backup eligible) and counter
+func (a *softAuthenticator) authenticatorData(attested bool) []byte {
+	var rpIDHash = sha256.Sum256([]byte(a.rpID))
+	var data = append([]byte{}, rpIDHash[:]...)
+	var flags byte = 0x01 | 0x04 | 0x08
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	a.counter++
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		var coseKey, err = cbor.Marshal(map[int]any{
+			1:  2,
+			3:  -7,
+			-1: 1,
+			-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+			-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		data = append(data, coseKey...)
+	}
+	return data
+}
+
+// create answers registration options with a none attestation
+func (a *softAuthenticator) create(options map[string]any) []byte {
+	var user = options["publicKey"].(map[string]any)["user"].(map[string]any)
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(user["id"].(string))
+	var attestationObject, err = cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(true),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var response, _ = json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", options)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		},
+	})
+	return response
+}
+
+// get answers login options with an assertion signed by the key
+func (a *softAuthenticator) get(options map[string]any) []byte {
+	var clientData = a.clientData("webauthn.get", options)
+	var authenticatorData = a.authenticatorData(false)
+	var clientDataHash = sha256.Sum256(clientData)
+	var digest = sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	var signature, err = ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var response, _ = json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authenticatorData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	return response
+}
+
+type webAuthnTest struct {
+	t           *testing.T
+	server      *httptest.Server
+	peopleStore people.Store
+}
+
+// newWebAuthnTest serves the webauthn and otp handlers next to helpers that create pending logins and sessions, alice
+// has no second factor and bob has enrolled one-time passwords
+func newWebAuthnTest(t *testing.T) *webAuthnTest {
+	var sessionStore = sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	var peopleStore = people.NewEmbeddedStore(sessionStore, map[string]people.AuthenticPerson{
+		"alice": {Person: people.Person{GivenName: "Alice"}},
+		"bob":   {Person: people.Person{GivenName: "Bob"}, OTPCredentials: people.OTPCredentials{Secret: testOTPSecret}},
+	}, 3600)
+	var clientStore = clients.NewInMemoryClientStore(map[string]clients.Client{"app": {}})
+	var passkeyStore = passkeys.NewInMemoryStore()
+
+	var router = mux.NewRouter()
+	var test = &webAuthnTest{t: t, server: httptest.NewServer(router), peopleStore: peopleStore}
+	t.Cleanup(test.server.Close)
+
+	var webAuthn, err = passkeys.NewWebAuthn(passkeys.Settings{}, test.server.URL, "Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mfaPolicy = oauth2.MFAPolicy{PasskeyStore: passkeyStore}
+	var webAuthnHandler = WebAuthnHandler("", webAuthn, passkeyStore, peopleStore, clientStore, sessionStore, test.server.URL, testSessionName)
+	router.Handle("/login/webauthn", webAuthnHandler)
+	router.Handle("/login/webauthn/{step:begin|finish}", webAuthnHandler)
+	router.Handle("/login/otp", OTPHandler("", peopleStore, clientStore, sessionStore, mfaPolicy, lockout.NewGuard(lockout.NewInMemoryStore(lockout.Settings{}), lockout.Settings{}), test.server.URL, "Test", testSessionName))
+	router.HandleFunc("/test/password", func(w http.ResponseWriter, r *http.Request) {
+		if err := savePendingLogin(sessionStore, r, w, testSessionName, r.FormValue("user_id"), []string{people.MethodPassword}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	router.HandleFunc("/test/session", func(w http.ResponseWriter, r *http.Request) {
+		var age, _ = time.ParseDuration(r.FormValue("age"))
+		var session = people.Session{UserID: r.FormValue("user_id"), AuthTime: time.Now().Add(-age), Methods: strings.Fields(r.FormValue("amr"))}
+		if err := peopleStore.SaveSession(r, w, session, testSessionName); err != nil {
+			t.Fatal(err)
+		}
+	})
+	router.HandleFunc("/test/whoami", func(w http.ResponseWriter, r *http.Request) {
+		var session, active = peopleStore.IsSessionActive(r, testSessionName)
+		if !active {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(session)
+	})
+	return test
+}
+
+// browser returns a client with its own cookies that does not follow redirects
+func (w *webAuthnTest) browser() *http.Client {
+	var jar, _ = cookiejar.New(nil)
+	return &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+func (w *webAuthnTest) do(client *http.Client, method, path, contentType string, body []byte) (int, []byte) {
+	var req, err = http.NewRequest(method, w.server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		w.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		w.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.Bytes()
+}
+
+func (w *webAuthnTest) begin(client *http.Client, ceremony string) (int, map[string]any) {
+	var status, body = w.do(client, http.MethodPost, "/login/webauthn/begin?client_id=app", "application/x-www-form-urlencoded",
+		[]byte("ceremony="+ceremony))
+	var options map[string]any
+	if status == http.StatusOK {
+		if err := json.Unmarshal(body, &options); err != nil {
+			w.t.Fatal(err)
+		}
+	}
+	return status, options
+}
+
+func (w *webAuthnTest) finish(client *http.Client, response []byte) int {
+	var status, body = w.do(client, http.MethodPost, "/login/webauthn/finish?client_id=app", "application/json", response)
+	if status != http.StatusOK {
+		w.t.Logf("finish: %d %s", status, body)
+	}
+	return status
+}
+
+func (w *webAuthnTest) passwordLogin(client *http.Client, userID string) {
+	if status, _ := w.do(client, http.MethodPost, "/test/password?user_id="+userID, "", nil); status != http.StatusOK {
+		w.t.Fatalf("pending login failed: %d", status)
+	}
+}
+
+func (w *webAuthnTest) session(client *http.Client, userID, amr string, age time.Duration) {
+	var path = "/test/session?" + url.Values{"user_id": {userID}, "amr": {amr}, "age": {age.String()}}.Encode()
+	if status, _ := w.do(client, http.MethodPost, path, "", nil); status != http.StatusOK {
+		w.t.Fatalf("session failed: %d", status)
+	}
+}
+
+func (w *webAuthnTest) whoami(client *http.Client) *people.Session {
+	var status, body = w.do(client, http.MethodGet, "/test/whoami", "", nil)
+	if status != http.StatusOK {
+		return nil
+	}
+	var session people.Session
+	if err := json.Unmarshal(body, &session); err != nil {
+		w.t.Fatal(err)
+	}
+	return &session
+}
+
+// register enrolls a new authenticator for alice as first second factor
+func (w *webAuthnTest) register() *softAuthenticator {
+	var client = w.browser()
+	w.passwordLogin(client, "alice")
+	var status, options = w.begin(client, CeremonyRegistration)
+	if status != http.StatusOK {
+		w.t.Fatalf("begin registration: %d", status)
+	}
+	var authenticator = newSoftAuthenticator(w.t, w.server.URL)
+	if status := w.finish(client, authenticator.create(options)); status != http.StatusOK {
+		w.t.Fatalf("finish registration: %d", status)
+	}
+	var session = w.whoami(client)
+	if session == nil || session.UserID != "alice" || !session.MultiFactor() {
+		w.t.Fatalf("registration did not complete the login: %+v", session)
+	}
+	return authenticator
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	test.register()
+
+	// the challenge can only be answered once
+	var client = test.browser()
+	test.passwordLogin(client, "alice")
+	if status := test.finish(client, []byte("{}")); status != http.StatusBadRequest {
+		t.Errorf("finish without begin: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestWebAuthnSecondFactorLogin(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	var authenticator = test.register()
+
+	var client = test.browser()
+	test.passwordLogin(client, "alice")
+	var status, options = test.begin(client, CeremonyLogin)
+	if status != http.StatusOK {
+		t.Fatalf("begin login: %d", status)
+	}
+	if allowCredentials, _ := options["publicKey"].(map[string]any)["allowCredentials"].([]any); len(allowCredentials) != 1 {
+		t.Errorf("allowCredentials: got %v, want the registered credential", allowCredentials)
+	}
+	if status := test.finish(client, authenticator.get(options)); status != http.StatusOK {
+		t.Fatalf("finish login: %d", status)
+	}
+	var session = test.whoami(client)
+	if session == nil || session.UserID != "alice" || strings.Join(session.Methods, " ") != "pwd swk" {
+		t.Errorf("session: got %+v, want alice with pwd swk", session)
+	}
+
+	// a key of another user is not accepted
+	var other = newSoftAuthenticator(t, test.server.URL)
+	other.userHandle = authenticator.userHandle
+	client = test.browser()
+	test.passwordLogin(client, "alice")
+	_, options = test.begin(client, CeremonyLogin)
+	if status := test.finish(client, other.get(options)); status != http.StatusForbidden {
+		t.Errorf("finish with unknown key: got %d, want %d", status, http.StatusForbidden)
+	}
+	if session := test.whoami(client); session != nil {
+		t.Errorf("unknown key started a session: %+v", session)
+	}
+}
+
+func TestWebAuthnDiscoverableLogin(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	var authenticator = test.register()
+
+	var client = test.browser()
+	var status, options = test.begin(client, CeremonyLogin)
+	if status != http.StatusOK {
+		t.Fatalf("begin discoverable login: %d", status)
+	}
+	if options["publicKey"].(map[string]any)["userVerification"] != "required" {
+		t.Errorf("discoverable login does not require user verification: %v", options)
+	}
+	if status := test.finish(client, authenticator.get(options)); status != http.StatusOK {
+		t.Fatalf("finish discoverable login: %d", status)
+	}
+	var session = test.whoami(client)
+	if session == nil || session.UserID != "alice" || strings.Join(session.Methods, " ") != "swk" {
+		t.Errorf("session: got %+v, want alice with swk", session)
+	}
+}
+
+// TestWebAuthnRegistrationRequiresSecondFactor makes sure the password alone is never enough to add a factor
+func TestWebAuthnRegistrationRequiresSecondFactor(t *testing.T) {
+	var test = newWebAuthnTest(t)
+	var authenticator = test.register()
+
+	var tests = []struct {
+		name   string
+		login  func(client *http.Client)
+		status int
+	}{
+		{"pending login of user with passkey", func(client *http.Client) { test.passwordLogin(client, "alice") }, http.StatusForbidden},
+		{"pending login of user with one-time password", func(client *http.Client) { test.passwordLogin(client, "bob") }, http.StatusForbidden},
+		{"password session", func(client *http.Client) { test.session(client, "alice", "pwd", 0) }, http.StatusForbidden},
+		{"old multi-factor session", func(client *http.Client) { test.session(client, "alice", "pwd swk", 10*time.Minute) }, http.StatusForbidden},
+		{"recent multi-factor session", func(client *http.Client) { test.session(client, "alice", "pwd swk", time.Minute) }, http.StatusOK},
+		{"recent passkey session", func(client *http.Client) { test.session(client, "alice", "swk", 0) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client = test.browser()
+			tt.login(client)
+			if status, _ := test.begin(client, CeremonyRegistration); status != tt.status {
+				t.Errorf("begin registration: got %d, want %d", status, tt.status)
+			}
+			var _, page = test.do(client, http.MethodGet, "/login/webauthn?client_id=app", "", nil)
+			if offered := bytes.Contains(page, []byte(`data-ceremony="register"`)); offered != (tt.status == http.StatusOK) {
+				t.Errorf("page offers registration: got %v, want %v", offered, tt.status == http.StatusOK)
+			}
+		})
+	}
+
+	// the pending login of bob can not be completed with a key registered by an attacker either
+	var client = test.browser()
+	test.passwordLogin(client, "bob")
+	if status := test.finish(client, authenticator.create(map[string]any{"publicKey": map[string]any{
+		"challenge": "", "user": map[string]any{"id": "Ym9i"}}})); status == http.StatusOK {
+		t.Errorf("finish registration without begin succeeded")
+	}
+	if session := test.whoami(client); session != nil {
+		t.Errorf("bob has a session: %+v", session)
+	}
+
+	// users with a passkey can not enroll a one-time password after the password either
+	client = test.browser()
+	test.passwordLogin(client, "alice")
+	var req, _ = http.NewRequest(http.MethodGet, test.server.URL+"/login/otp?client_id=app", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || !strings.Contains(location, "/login/webauthn") {
+		t.Errorf("otp enrollment: got %d %s, want redirect to /login/webauthn", resp.StatusCode, location)
+	}
+}
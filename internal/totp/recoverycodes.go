@@ -0,0 +1,46 @@
+package totp
+
+import (
+	"crypto/rand"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"strings"
+)
+
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns count single-use recovery codes and their bcrypt hashes
+func GenerateRecoveryCodes(count int) ([]string, []string, error) {
+	var codes, hashes = make([]string, count), make([]string, count)
+	for i := range count {
+		var code = make([]byte, 10)
+		for j := range code {
+			var n, err = rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			code[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		if hash, err := bcrypt.GenerateFromPassword([]byte(codes[i]), 5); err != nil {
+			return nil, nil, err
+		} else {
+			hashes[i] = string(hash)
+		}
+	}
+	return codes, hashes, nil
+}
+
+// MatchRecoveryCode returns the index of the hash matching the recovery code or -1
+func MatchRecoveryCode(hashes []string, code string) int {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	for i, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,35 @@
+package totp
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMatchRecoveryCode(t *testing.T) {
+	var codes, hashes, err = GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var format = regexp.MustCompile(`^[a-z2-9]{5}-[a-z2-9]{5}$`)
+	for i, code := range codes {
+		if !format.MatchString(code) || strings.ContainsAny(code, "ilo01") {
+			t.Errorf("recovery code %q", code)
+		}
+		for _, entered := range []string{code, strings.ToUpper(code), " " + code + " ", strings.ReplaceAll(code, "-", "")} {
+			if index := MatchRecoveryCode(hashes, entered); index != i {
+				t.Errorf("MatchRecoveryCode(%q) = %d, want %d", entered, index, i)
+			}
+		}
+	}
+
+	for _, entered := range []string{"", "abcde-fghjk", codes[0][:5], codes[0] + "x"} {
+		if index := MatchRecoveryCode(hashes, entered); index != -1 {
+			t.Errorf("MatchRecoveryCode(%q) = %d", entered, index)
+		}
+	}
+	// a used code no longer matches once its hash is removed
+	if index := MatchRecoveryCode(hashes[1:], codes[0]); index != -1 {
+		t.Errorf("MatchRecoveryCode of used code = %d", index)
+	}
+}
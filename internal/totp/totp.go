@@ -0,0 +1,97 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Time-based one-time passwords as per RFC 6238 with the parameters supported by common authenticator apps
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is the number of periods a code may be off, to allow for clock drift and slow typing
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random 160 bit secret in base32 encoding
+func GenerateSecret() (string, error) {
+	var secret = make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// KeyURI returns the otpauth URI that authenticator apps read from QR codes
+func KeyURI(issuer, accountName, secret string) string {
+	var params = url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: params.Encode(),
+	}).String()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	return encoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "=")))
+}
+
+// Step returns the time step of the given time
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+func code(key []byte, step int64) string {
+	var message = make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(step))
+	var mac = hmac.New(sha1.New, key)
+	mac.Write(message)
+	var sum = mac.Sum(nil)
+	var offset = sum[len(sum)-1] & 0x0f
+	var value = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000)
+}
+
+// Code returns the one-time password for the given time
+func Code(secret string, t time.Time) (string, error) {
+	var key, err = decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Step(t)), nil
+}
+
+// Validate checks the one-time password against the time steps around t and returns the matching step, so that
+// callers can reject codes that have been used before
+func Validate(secret, passcode string, t time.Time) (int64, bool) {
+	var key, err = decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	passcode = strings.ReplaceAll(passcode, " ", "")
+	if len(passcode) != Digits {
+		return 0, false
+	}
+	var step = Step(t)
+	for i := int64(-Skew); i <= Skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, step+i)), []byte(passcode)) == 1 {
+			return step + i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		if code, err := Code(rfc6238Secret, time.Unix(tt.unix, 0)); err != nil || code != tt.code {
+			t.Errorf("Code(%d) = %q, %v, want %s", tt.unix, code, err, tt.code)
+		}
+	}
+	// authenticator apps show secrets in lower case groups
+	if code, err := Code("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0)); err != nil || code != "287082" {
+		t.Errorf("Code of formatted secret = %q, %v", code, err)
+	}
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var now = time.Unix(1111111111, 0)
+	var step = Step(now)
+	for _, tt := range []struct {
+		name     string
+		passcode string
+		step     int64
+		valid    bool
+	}{
+		{"current step", "050471", step, true},
+		{"with blank", "050 471", step, true},
+		{"previous step", "081804", step - 1, true},
+		{"next step", mustCode(t, now.Add(Period)), step + 1, true},
+		{"two steps behind", mustCode(t, now.Add(-2*Period)), 0, false},
+		{"two steps ahead", mustCode(t, now.Add(2*Period)), 0, false},
+		{"8 digits", "14050471", 0, false},
+		{"empty", "", 0, false},
+	} {
+		if matched, valid := Validate(rfc6238Secret, tt.passcode, now); valid != tt.valid || matched != tt.step {
+			t.Errorf("%s: Validate(%q) = %d, %v, want %d, %v", tt.name, tt.passcode, matched, valid, tt.step, tt.valid)
+		}
+	}
+	if _, valid := Validate("not base32!", "050471", now); valid {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func mustCode(t *testing.T, at time.Time) string {
+	var code, err = Code(rfc6238Secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestGenerateSecret(t *testing.T) {
+	var secret, err = GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := decodeSecret(secret); err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("secrets repeat")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	var uri, err = url.Parse(KeyURI("Example", "alice", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Example:alice" {
+		t.Errorf("KeyURI = %s", uri)
+	}
+	var query = uri.Query()
+	if query.Get("secret") != rfc6238Secret || query.Get("issuer") != "Example" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("KeyURI = %s", uri)
+	}
+}
@@ -1,10 +1,16 @@
 package keyset
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
+	"github.com/go-jose/go-jose/v3"
 )
 
 const HeaderKeyID = "KeyID"
@@ -29,3 +35,52 @@ func GeneratePrivateKey(keySize int, keyID string) ([]byte, error) {
 
 	return bytes, nil
 }
+
+// GenerateSigningKey generates a private key suitable for the signature algorithm
+func GenerateSigningKey(algorithm jose.SignatureAlgorithm, rsaKeySize int) (crypto.Signer, error) {
+	switch algorithm {
+	case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+		return rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case jose.ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jose.ES384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jose.ES512:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jose.EdDSA:
+		var _, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSigningAlg, algorithm)
+	}
+}
+
+// EncodePrivateKeyPEM encodes the private key as PKCS#8 PEM block
+func EncodePrivateKeyPEM(privateKey crypto.Signer, keyID string) ([]byte, error) {
+	var der, err = x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	var block = &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}
+	if keyID != "" {
+		block.Headers = map[string]string{
+			HeaderKeyID: keyID,
+		}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// EncodePublicKeyPEM encodes the public key as PKIX PEM block
+func EncodePublicKeyPEM(publicKey crypto.PublicKey, keyID string) string {
+	var pubASN1, _ = x509.MarshalPKIXPublicKey(publicKey)
+
+	var pubBytes = pem.EncodeToMemory(&pem.Block{
+		Type:    "PUBLIC KEY",
+		Bytes:   pubASN1,
+		Headers: map[string]string{HeaderKeyID: keyID},
+	})
+	return string(pubBytes)
+}
@@ -0,0 +1,111 @@
+package keyset
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/youmark/pkcs8"
+	"strings"
+)
+
+var (
+	ErrPasswordRequired      = errors.New("private key is encrypted but no password is configured")
+	ErrUnsupportedKeyType    = errors.New("unsupported private key type")
+	ErrAlgorithmKeyMismatch  = errors.New("signing algorithm does not match key type")
+	ErrUnsupportedSigningAlg = errors.New("unsupported signing algorithm")
+)
+
+// ParsePrivateKey parses PKCS#1, SEC 1 and PKCS#8 private keys. Encrypted PKCS#8 keys and legacy encrypted PEM
+// blocks (Proc-Type: 4,ENCRYPTED) are decrypted with the given password.
+func ParsePrivateKey(block *pem.Block, password []byte) (crypto.Signer, error) {
+	var der = block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch strings.TrimSpace(strings.ToLower(block.Type)) {
+	case "rsa private key":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "ec private key":
+		key, err = x509.ParseECPrivateKey(der)
+	case "private key":
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	case "encrypted private key":
+		if len(password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		key, err = pkcs8.ParsePKCS8PrivateKey(der, password)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ed25519.PrivateKey:
+		return *k, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, key)
+	}
+}
+
+// SigningAlgorithms returns the signature algorithms usable with the public key, the first one is the default
+func SigningAlgorithms(publicKey crypto.PublicKey) []jose.SignatureAlgorithm {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return []jose.SignatureAlgorithm{jose.ES256}
+		case elliptic.P384():
+			return []jose.SignatureAlgorithm{jose.ES384}
+		case elliptic.P521():
+			return []jose.SignatureAlgorithm{jose.ES512}
+		}
+	case ed25519.PublicKey:
+		return []jose.SignatureAlgorithm{jose.EdDSA}
+	}
+	return nil
+}
+
+// SigningAlgorithm validates the configured algorithm against the key or picks the default algorithm for the key
+func SigningAlgorithm(publicKey crypto.PublicKey, algorithm string) (jose.SignatureAlgorithm, error) {
+	var algorithms = SigningAlgorithms(publicKey)
+	if len(algorithms) == 0 {
+		return "", fmt.Errorf("%w: %T", ErrUnsupportedKeyType, publicKey)
+	}
+	if algorithm == "" {
+		return algorithms[0], nil
+	}
+	for _, alg := range algorithms {
+		if strings.EqualFold(string(alg), algorithm) {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrAlgorithmKeyMismatch, algorithm)
+}
@@ -20,22 +20,33 @@ type Provider interface {
 	Get() (map[string]any, error)
 }
 
+// JSONWebKeyProvider provides the public keys along with their use and algorithm, keys read from PEM files have
+// neither
+type JSONWebKeyProvider interface {
+	Provider
+	JSONWebKeys() ([]jose.JSONWebKey, error)
+}
+
 type provider struct {
-	dir              string
-	keys             []string
-	mu               sync.RWMutex
-	cacheDuration    time.Duration
-	cachedPublicKeys map[string]any
-	cachedAt         time.Time
+	dir           string
+	keys          []string
+	mu            sync.RWMutex
+	cacheDuration time.Duration
+	cachedKeys    []jose.JSONWebKey
+	cachedAt      time.Time
 }
 
 func NewProvider(dir string, keys []string, cacheDuration time.Duration) Provider {
+	return NewJSONWebKeyProvider(dir, keys, cacheDuration)
+}
+
+func NewJSONWebKeyProvider(dir string, keys []string, cacheDuration time.Duration) JSONWebKeyProvider {
 	return &provider{dir: dir, keys: keys, cacheDuration: cacheDuration}
 }
 
-func (p *provider) load() (map[string]any, error) {
+func (p *provider) load() ([]jose.JSONWebKey, error) {
 	log.Print("Retrieving public keys")
-	var publicKeys = make(map[string]any)
+	var publicKeys []jose.JSONWebKey
 
 	for index, rawKey := range p.keys {
 		var (
@@ -64,10 +75,7 @@ func (p *provider) load() (map[string]any, error) {
 				if err != nil {
 					return nil, err
 				}
-				jwksKeys := ToPublicKeys(jwks)
-				for jwkid, jwkey := range jwksKeys {
-					publicKeys[jwkid] = jwkey
-				}
+				publicKeys = append(publicKeys, jwks...)
 				continue
 			} else {
 				if err != nil {
@@ -94,10 +102,7 @@ func (p *provider) load() (map[string]any, error) {
 				if err != nil {
 					return nil, err
 				}
-				jwksKeys := ToPublicKeys(jwks)
-				for jwkid, jwkey := range jwksKeys {
-					publicKeys[jwkid] = jwkey
-				}
+				publicKeys = append(publicKeys, jwks...)
 				continue
 			}
 
@@ -112,18 +117,12 @@ func (p *provider) load() (map[string]any, error) {
 		}
 
 		switch strings.TrimSpace(strings.ToLower(block.Type)) {
-		case "rsa private key":
-			rsaPrivateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-			if err != nil {
-				return nil, err
-			}
-			publicKey = &rsaPrivateKey.PublicKey
-		case "ec private key":
-			ecPrivateKey, err := x509.ParseECPrivateKey(block.Bytes)
+		case "rsa private key", "ec private key", "private key":
+			privateKey, err := ParsePrivateKey(block, nil)
 			if err != nil {
 				return nil, err
 			}
-			publicKey = &ecPrivateKey.PublicKey
+			publicKey = privateKey.Public()
 		case "rsa public key":
 			var err error
 			publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
@@ -140,33 +139,65 @@ func (p *provider) load() (map[string]any, error) {
 			return nil, errors.New("unsupported key type: " + block.Type)
 		}
 
-		publicKeys[kid] = publicKey
+		publicKeys = append(publicKeys, jose.JSONWebKey{Key: publicKey, KeyID: kid})
 	}
 
 	return publicKeys, nil
 }
 
 func (p *provider) Get() (map[string]any, error) {
-	if p.cachedPublicKeys != nil && time.Now().Sub(p.cachedAt) < p.cacheDuration {
+	var publicKeys, err = p.JSONWebKeys()
+	if err != nil {
+		return nil, err
+	}
+	return ToPublicKeys(publicKeys), nil
+}
+
+func (p *provider) JSONWebKeys() ([]jose.JSONWebKey, error) {
+	if p.cachedKeys != nil && time.Now().Sub(p.cachedAt) < p.cacheDuration {
 		log.Print("Getting public keys from cache")
 		p.mu.RLock()
 		defer p.mu.RUnlock()
-		return p.cachedPublicKeys, nil
+		return p.cachedKeys, nil
 	} else {
 		p.mu.Lock()
 		defer p.mu.Unlock()
 		if publicKeys, err := p.load(); err != nil {
-			if p.cachedPublicKeys != nil {
+			if p.cachedKeys != nil {
 				log.Printf("!!! %s", err)
 				log.Printf("Falling back to public keys cached at %s", p.cachedAt.Format(time.DateTime))
-				return p.cachedPublicKeys, nil
+				return p.cachedKeys, nil
 			} else {
 				return nil, err
 			}
 		} else {
-			p.cachedPublicKeys = publicKeys
+			if publicKeys == nil {
+				publicKeys = []jose.JSONWebKey{}
+			}
+			p.cachedKeys = publicKeys
 			p.cachedAt = time.Now()
 			return publicKeys, nil
 		}
 	}
 }
+
+type combinedProvider []Provider
+
+// Combine merges the public keys of multiple providers into one key set
+func Combine(providers ...Provider) Provider {
+	return combinedProvider(providers)
+}
+
+func (c combinedProvider) Get() (map[string]any, error) {
+	var publicKeys = make(map[string]any)
+	for _, provider := range c {
+		var keys, err = provider.Get()
+		if err != nil {
+			return nil, err
+		}
+		for kid, publicKey := range keys {
+			publicKeys[kid] = publicKey
+		}
+	}
+	return publicKeys, nil
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/cwkr/authd/internal/httputil"
+	"github.com/cwkr/authd/internal/oauth2"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitKeyIP       = "ip"
+	RateLimitKeyClientID = "client_id"
+	RateLimitKeyUserID   = "user_id"
+
+	ErrorTooManyRequests = "too_many_requests"
+
+	defaultRateLimitMaxKeys = 10_000
+)
+
+// RateLimitSettings limit every key to the given number of requests per minute, bursts of up to Burst requests are
+// accepted
+type RateLimitSettings struct {
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	Burst             int     `json:"burst,omitempty"`
+	// Key is one of ip, client_id or user_id, requests without client or user are limited by ip
+	Key string `json:"key,omitempty"`
+	// MaxKeys is the number of buckets kept, the least recently used bucket is dropped for a new key
+	MaxKeys int `json:"max_keys,omitempty"`
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket for every key, keys are chosen by the clients so the number of buckets is bounded
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   RateLimitSettings
+	buckets map[string]*list.Element
+	// order holds the buckets, the most recently used first
+	order *list.List
+}
+
+func NewRateLimiter(limit RateLimitSettings) (*RateLimiter, error) {
+	if limit.RequestsPerMinute <= 0 {
+		return nil, fmt.Errorf("invalid rate limit: %v requests per minute", limit.RequestsPerMinute)
+	}
+	switch limit.Key {
+	case "":
+		limit.Key = RateLimitKeyIP
+	case RateLimitKeyIP, RateLimitKeyClientID, RateLimitKeyUserID:
+	default:
+		return nil, fmt.Errorf("invalid rate limit key: %s", limit.Key)
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.RequestsPerMinute))
+	}
+	if limit.MaxKeys <= 0 {
+		limit.MaxKeys = defaultRateLimitMaxKeys
+	}
+	return &RateLimiter{limit: limit, buckets: map[string]*list.Element{}, order: list.New()}, nil
+}
+
+func (l *RateLimiter) rate() float64 {
+	return l.limit.RequestsPerMinute / 60
+}
+
+// purge removes the least recently used buckets that have been refilled completely and makes room for a new bucket,
+// the caller holds the lock
+func (l *RateLimiter) purge(now time.Time) {
+	var refill = time.Duration(float64(l.limit.Burst) / l.rate() * float64(time.Second))
+	for oldest := l.order.Back(); oldest != nil; oldest = l.order.Back() {
+		var b = oldest.Value.(*bucket)
+		if l.order.Len() < l.limit.MaxKeys && !b.last.Add(refill).Before(now) {
+			return
+		}
+		l.order.Remove(oldest)
+		delete(l.buckets, b.key)
+	}
+}
+
+// Allow takes a token from the bucket of the key, it returns the time until the next token is available otherwise
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var now = time.Now()
+	var b *bucket
+	if element, found := l.buckets[key]; found {
+		l.order.MoveToFront(element)
+		b = element.Value.(*bucket)
+	} else {
+		l.purge(now)
+		b = &bucket{key: key, tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = l.order.PushFront(b)
+	}
+	b.tokens = min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.rate())
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate() * float64(time.Second))
+}
+
+// key returns the client id or user id of the request as configured, or the address of the client
+func (l *RateLimiter) key(r *http.Request) string {
+	switch l.limit.Key {
+	case RateLimitKeyClientID:
+		if clientID, _, basicAuth := r.BasicAuth(); basicAuth && clientID != "" {
+			return "client:" + strings.ToLower(clientID)
+		}
+		if clientID := strings.TrimSpace(r.FormValue("client_id")); clientID != "" {
+			return "client:" + strings.ToLower(clientID)
+		}
+	case RateLimitKeyUserID:
+		// set by RequireJWT
+		if userID, _ := r.Context().Value("user_id").(string); userID != "" {
+			return "user:" + strings.ToLower(userID)
+		}
+		if userID := strings.TrimSpace(r.PostFormValue("user_id")); userID != "" {
+			return "user:" + strings.ToLower(userID)
+		}
+		if userID := strings.TrimSpace(r.PostFormValue("username")); userID != "" {
+			return "user:" + strings.ToLower(userID)
+		}
+	}
+	return "ip:" + httputil.RemoteAddr(r)
+}
+
+// RateLimit answers requests exceeding the limit with 429 Too Many Requests
+func RateLimit(next http.Handler, limiter *RateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key = limiter.key(r)
+		if allowed, retryAfter := limiter.Allow(key); !allowed {
+			log.Printf("!!! rate limit exceeded for %s: %s %s", key, r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(retryAfter.Seconds()))))
+			oauth2.Error(w, ErrorTooManyRequests, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
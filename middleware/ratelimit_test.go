@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	var limiter, err = NewRateLimiter(RateLimitSettings{RequestsPerMinute: 1, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("ip:192.0.2.1"); !allowed {
+			t.Fatalf("request %d rejected", i+1)
+		}
+	}
+	if allowed, retryAfter := limiter.Allow("ip:192.0.2.1"); allowed || retryAfter <= 0 {
+		t.Errorf("request over the limit: allowed=%v retryAfter=%v", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.Allow("ip:192.0.2.2"); !allowed {
+		t.Error("other key rejected")
+	}
+}
+
+func TestRateLimiterMaxKeys(t *testing.T) {
+	var limiter, err = NewRateLimiter(RateLimitSettings{RequestsPerMinute: 1, Burst: 1, MaxKeys: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.Allow("user:alice")
+	for i := 0; i < 1000; i++ {
+		limiter.Allow(fmt.Sprintf("user:attacker-%d", i))
+		// a key in use keeps its bucket
+		if i%50 == 0 {
+			if allowed, _ := limiter.Allow("user:alice"); allowed {
+				t.Fatalf("bucket of alice dropped after %d keys", i)
+			}
+		}
+	}
+	if len(limiter.buckets) > 100 || limiter.order.Len() != len(limiter.buckets) {
+		t.Errorf("%d buckets in map, %d in order, want at most 100", len(limiter.buckets), limiter.order.Len())
+	}
+}
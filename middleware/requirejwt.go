@@ -2,13 +2,30 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/cwkr/authd/internal/httputil"
 	"github.com/cwkr/authd/internal/oauth2"
 	"net/http"
+	"slices"
+	"strings"
 )
 
+// ErrorInsufficientUserAuthentication is returned when the access token does not carry one of the required acr
+// values, see RFC 9470
+const ErrorInsufficientUserAuthentication = "insufficient_user_authentication"
+
 func RequireJWT(next http.Handler, tokenVerifier AccessTokenValidator, audiences ...string) http.Handler {
+	return requireJWT(next, tokenVerifier, nil, audiences...)
+}
+
+// RequireACR works like RequireJWT and additionally demands that the user authenticated with one of the given acr
+// values, clients are told which acr_values to request when stepping up
+func RequireACR(next http.Handler, tokenVerifier AccessTokenValidator, acrValues []string, audiences ...string) http.Handler {
+	return requireJWT(next, tokenVerifier, acrValues, audiences...)
+}
+
+func requireJWT(next http.Handler, tokenVerifier AccessTokenValidator, acrValues []string, audiences ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var accessToken = httputil.ExtractAccessToken(r)
 		if accessToken == "" {
@@ -16,12 +33,29 @@ func RequireJWT(next http.Handler, tokenVerifier AccessTokenValidator, audiences
 			oauth2.Error(w, "unauthorized", "authentication required", http.StatusUnauthorized)
 			return
 		}
-		var userID, err = tokenVerifier.Validate(accessToken, audiences...)
+		var claims, err = tokenVerifier.ValidateClaims(accessToken, audiences...)
+		var claimsRequest *oauth2.ClaimsRequest
+		if err == nil && len(claims.RequestedClaims) > 0 {
+			err = json.Unmarshal(claims.RequestedClaims, &claimsRequest)
+		}
 		if err != nil {
 			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=\"invalid_token\", error_description=\"%s\"", err.Error()))
 			oauth2.Error(w, "invalid_token", err.Error(), http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "user_id", userID)))
+		if len(acrValues) > 0 && !slices.Contains(acrValues, claims.AuthContext) {
+			var description = "a different authentication level is required"
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=\"%s\", error_description=\"%s\", acr_values=\"%s\"",
+				ErrorInsufficientUserAuthentication, description, strings.Join(acrValues, " ")))
+			oauth2.Error(w, ErrorInsufficientUserAuthentication, description, http.StatusUnauthorized)
+			return
+		}
+		var ctx = context.WithValue(r.Context(), "user_id", claims.Subject)
+		ctx = context.WithValue(ctx, "client_id", claims.ClientID)
+		ctx = context.WithValue(ctx, "scope", claims.Scope)
+		ctx = context.WithValue(ctx, "claims", claimsRequest)
+		ctx = context.WithValue(ctx, "acr", claims.AuthContext)
+		ctx = context.WithValue(ctx, "amr", claims.AuthMethods)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/trl"
+	"log"
+	"strings"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// SubjectResolver maps the subject of an access token issued to a client back to the user id
+type SubjectResolver func(clientID, subject string) (string, error)
+
+type revocationValidator struct {
+	validator       AccessTokenValidator
+	trlStore        trl.Store
+	subjectResolver SubjectResolver
+}
+
+// NewRevocationValidator rejects access tokens that have been revoked by id or by a cutoff for their user and client,
+// subjects are taken as user ids when no resolver is given
+func NewRevocationValidator(validator AccessTokenValidator, trlStore trl.Store, subjectResolver SubjectResolver) AccessTokenValidator {
+	return &revocationValidator{validator, trlStore, subjectResolver}
+}
+
+func (v revocationValidator) Validate(rawToken string, audiences ...string) (string, error) {
+	return subject(v.ValidateClaims(rawToken, audiences...))
+}
+
+func (v revocationValidator) ValidateClaims(rawToken string, audiences ...string) (*AccessTokenClaims, error) {
+	var claims, err = v.validator.ValidateClaims(rawToken, audiences...)
+	if err != nil {
+		return nil, err
+	}
+	var userID = claims.Subject
+	// client credentials tokens have the client as subject and no user to resolve
+	if v.subjectResolver != nil && !strings.EqualFold(claims.Subject, claims.ClientID) {
+		if userID, err = v.subjectResolver(claims.ClientID, claims.Subject); err != nil {
+			log.Printf("!!! %s", err)
+			return nil, err
+		}
+	}
+	if revoked, err := oauth2.IsRevoked(v.trlStore, claims.ID, userID, claims.ClientID, claims.IssuedAt.Time()); err != nil {
+		log.Printf("!!! %s", err)
+		return nil, err
+	} else if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
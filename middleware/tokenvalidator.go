@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/cwkr/authd/internal/maputil"
+	"github.com/cwkr/authd/internal/oauth2/opaque"
 	"github.com/cwkr/authd/keyset"
 	"github.com/go-jose/go-jose/v3/jwt"
 	"log"
@@ -15,41 +17,94 @@ var (
 	ErrMatchingKeyNotFound = errors.New("matching key not found")
 )
 
+type AccessTokenClaims struct {
+	jwt.Claims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// RequestedClaims is the claims request parameter of the authorization request
+	RequestedClaims json.RawMessage `json:"claims,omitempty"`
+	AuthMethods     []string        `json:"amr,omitempty"`
+	AuthContext     string          `json:"acr,omitempty"`
+}
+
 type AccessTokenValidator interface {
+	// Validate returns the subject of a valid access token
 	Validate(rawToken string, audiences ...string) (string, error)
+	// ValidateClaims returns the claims of a valid access token
+	ValidateClaims(rawToken string, audiences ...string) (*AccessTokenClaims, error)
 }
 
 type accessTokenValidator struct {
 	keySetProvider keyset.Provider
+	opaqueStore    opaque.Store
 }
 
-func NewAccessTokenValidator(keySetProvider keyset.Provider) AccessTokenValidator {
-	return &accessTokenValidator{keySetProvider}
+// NewAccessTokenValidator creates a validator for signed access tokens, reference tokens are resolved with the
+// opaque token store when one is given
+func NewAccessTokenValidator(keySetProvider keyset.Provider, opaqueStore opaque.Store) AccessTokenValidator {
+	return &accessTokenValidator{keySetProvider, opaqueStore}
 }
 
 func (t accessTokenValidator) Validate(rawToken string, audiences ...string) (string, error) {
+	return subject(t.ValidateClaims(rawToken, audiences...))
+}
+
+func (t accessTokenValidator) ValidateClaims(rawToken string, audiences ...string) (*AccessTokenClaims, error) {
+	if opaque.IsOpaque(rawToken) {
+		return t.validateReferenceToken(rawToken, audiences...)
+	}
 	var publicKeys map[string]any
 	if pk, err := t.keySetProvider.Get(); err != nil {
-		return "", err
+		return nil, err
 	} else {
 		publicKeys = maputil.LowerKeys(pk)
 	}
 	var token, err = jwt.ParseSigned(rawToken)
 	if err != nil {
 		log.Printf("!!! %s", err)
-		return "", err
+		return nil, err
 	}
 	if len(token.Headers) == 0 || token.Headers[0].KeyID == "" {
-		return "", ErrMissingKid
+		return nil, ErrMissingKid
 	}
 	var publicKey, found = publicKeys[strings.ToLower(token.Headers[0].KeyID)]
 	if !found {
-		return "", ErrMatchingKeyNotFound
+		return nil, ErrMatchingKeyNotFound
 	}
-	var claims = jwt.Claims{}
+	var claims = AccessTokenClaims{}
 	if err := token.Claims(publicKey, &claims); err != nil {
 		log.Printf("!!! %s", err)
-		return "", err
+		return nil, err
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{
+		Time:     time.Now(),
+		Audience: audiences,
+	}, 0)
+	if err != nil {
+		log.Printf("!!! %s", err)
+		return nil, err
+	}
+	// access tokens issued without client_id claim name the client as second audience
+	if claims.ClientID == "" && len(claims.Audience) > 1 {
+		claims.ClientID = claims.Audience[1]
+	}
+	return &claims, nil
+}
+
+func (t accessTokenValidator) validateReferenceToken(rawToken string, audiences ...string) (*AccessTokenClaims, error) {
+	if t.opaqueStore == nil {
+		return nil, opaque.ErrTokenNotFound
+	}
+	var storedClaims, err = t.opaqueStore.Lookup(opaque.Hash(rawToken))
+	if err != nil {
+		log.Printf("!!! %s", err)
+		return nil, err
+	}
+	var claims = AccessTokenClaims{}
+	if bytes, err := json.Marshal(storedClaims); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(bytes, &claims); err != nil {
+		return nil, err
 	}
 	err = claims.ValidateWithLeeway(jwt.Expected{
 		Time:     time.Now(),
@@ -57,8 +112,14 @@ func (t accessTokenValidator) Validate(rawToken string, audiences ...string) (st
 	}, 0)
 	if err != nil {
 		log.Printf("!!! %s", err)
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func subject(claims *AccessTokenClaims, err error) (string, error) {
+	if err != nil {
 		return "", err
-	} else {
-		return claims.Subject, nil
 	}
+	return claims.Subject, nil
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticKeySet map[string]any
+
+func (s staticKeySet) Get() (map[string]any, error) {
+	return s, nil
+}
+
+func TestAccessTokenValidator(t *testing.T) {
+	var key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var signer, err = jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "sigkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var now = time.Now()
+	token, err := jwt.Signed(signer).Claims(map[string]any{
+		"iss":       "http://localhost",
+		"sub":       "alice",
+		"aud":       []string{"http://localhost", "app"},
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Minute).Unix(),
+		"client_id": "app",
+		"scope":     "openid",
+		"claims":    map[string]any{"userinfo": map[string]any{"email": map[string]any{"essential": true}}},
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validator = NewAccessTokenValidator(staticKeySet{"sigkey": key.Public()}, nil)
+
+	if userID, err := validator.Validate(token, "app"); err != nil || userID != "alice" {
+		t.Errorf("Validate = %q, %v", userID, err)
+	}
+	if _, err := validator.Validate(token, "other"); err == nil {
+		t.Error("token accepted for another audience")
+	}
+
+	var claimsRequest *oauth2.ClaimsRequest
+	var handler = RequireJWT(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claimsRequest, _ = r.Context().Value("claims").(*oauth2.ClaimsRequest)
+	}), validator, "app")
+	var r = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("RequireJWT: %d %s", w.Code, w.Body.String())
+	}
+	if claimsRequest == nil || claimsRequest.UserInfo["email"] == nil || !claimsRequest.UserInfo["email"].Essential {
+		t.Errorf("claims request = %+v", claimsRequest)
+	}
+}
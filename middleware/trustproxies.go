@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges of reverse proxies
+func ParseTrustedProxies(trustedProxies []string) ([]netip.Prefix, error) {
+	var prefixes = make([]netip.Prefix, 0, len(trustedProxies))
+	for _, trustedProxy := range trustedProxies {
+		if strings.Contains(trustedProxy, "/") {
+			if prefix, err := netip.ParsePrefix(trustedProxy); err != nil {
+				return nil, err
+			} else {
+				prefixes = append(prefixes, prefix.Masked())
+			}
+		} else if addr, err := netip.ParseAddr(trustedProxy); err != nil {
+			return nil, err
+		} else {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return prefixes, nil
+}
+
+func isTrusted(trustedProxies []netip.Prefix, host string) bool {
+	var addr, err = netip.ParseAddr(strings.TrimSpace(host))
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustProxies replaces the remote address of requests forwarded by trusted proxies by the client address taken from
+// X-Forwarded-For or X-Real-IP. X-Forwarded-For is read from right to left and the first untrusted address is used,
+// so clients can not spoof their address by sending the header themselves.
+func TrustProxies(next http.Handler, trustedProxies []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var host, port, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !isTrusted(trustedProxies, host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var clientAddr string
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			var hops = strings.Split(strings.Join(forwardedFor, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				clientAddr = strings.TrimSpace(hops[i])
+				if !isTrusted(trustedProxies, clientAddr) {
+					break
+				}
+			}
+		} else {
+			clientAddr = strings.TrimSpace(r.Header.Get("X-Real-IP"))
+		}
+		if addr, err := netip.ParseAddr(clientAddr); err == nil {
+			var forwarded = r.Clone(r.Context())
+			forwarded.RemoteAddr = net.JoinHostPort(addr.Unmap().String(), port)
+			r = forwarded
+		}
+		next.ServeHTTP(w, r)
+	})
+}
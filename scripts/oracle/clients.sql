@@ -5,6 +5,29 @@ CREATE TABLE clients (
     session_name VARCHAR2(255 CHAR),
     disable_implicit NUMBER(1, 0) DEFAULT 0 NOT NULL,
     enable_refresh_token_rotation NUMBER(1, 0) DEFAULT 0 NOT NULL,
+    refresh_token_ttl NUMBER(10, 0),
+    refresh_token_max_ttl NUMBER(10, 0),
+    offline_session_ttl NUMBER(10, 0),
+    grant_types VARCHAR2(255 CHAR),
+    response_types VARCHAR2(255 CHAR),
+    allowed_scopes VARCHAR2(255 CHAR),
+    default_scopes VARCHAR2(255 CHAR),
+    access_token_ttl NUMBER(10, 0),
+    id_token_ttl NUMBER(10, 0),
+    code_ttl NUMBER(10, 0),
+    access_token_extra_claims VARCHAR2(4000 CHAR),
+    id_token_extra_claims VARCHAR2(4000 CHAR),
+    released_attributes VARCHAR2(255 CHAR),
+    jwks_uri VARCHAR2(255 CHAR),
+    id_token_encrypted_response_alg VARCHAR2(255 CHAR),
+    id_token_encrypted_response_enc VARCHAR2(255 CHAR),
+    userinfo_signed_response_alg VARCHAR2(255 CHAR),
+    userinfo_encrypted_response_alg VARCHAR2(255 CHAR),
+    userinfo_encrypted_response_enc VARCHAR2(255 CHAR),
+    subject_type VARCHAR2(255 CHAR),
+    sector_identifier VARCHAR2(255 CHAR),
+    access_token_format VARCHAR2(255 CHAR),
+    require_mfa NUMBER(1, 0) DEFAULT 0 NOT NULL,
     created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
     last_modified TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL
 );
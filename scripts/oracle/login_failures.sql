@@ -0,0 +1,5 @@
+CREATE TABLE login_failures (
+    id VARCHAR2(255 CHAR) CONSTRAINT login_failures_pk PRIMARY KEY,
+    failures NUMBER(10, 0) NOT NULL,
+    last_failure TIMESTAMP(3) WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE pairwise_subjects (
+    sector_id VARCHAR2(255 CHAR) NOT NULL,
+    sub VARCHAR2(255 CHAR) NOT NULL,
+    user_id VARCHAR2(255 CHAR) NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
+    CONSTRAINT pairwise_subjects_pk PRIMARY KEY (sector_id, sub)
+);
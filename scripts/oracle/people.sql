@@ -10,6 +10,8 @@ CREATE TABLE people (
     street_address VARCHAR2(255 CHAR),
     locality VARCHAR2(255 CHAR),
     postal_code VARCHAR2(255 CHAR),
+    otp_secret VARCHAR2(255 CHAR),
+    otp_recovery_codes VARCHAR2(1000 CHAR),
     created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
     last_modified TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL
 );
@@ -29,3 +31,11 @@ CREATE TABLE people_groups (
     CONSTRAINT people_groups_fk1 FOREIGN KEY (user_id) REFERENCES people (user_id),
     CONSTRAINT people_groups_fk2 FOREIGN KEY (group_id) REFERENCES groups (group_id)
 );
+
+CREATE TABLE password_history (
+    user_id VARCHAR2(255 CHAR) NOT NULL,
+    password_hash VARCHAR2(255 CHAR) NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL
+);
+
+CREATE INDEX password_history_idx1 ON password_history (user_id, created);
@@ -0,0 +1,7 @@
+CREATE TABLE reference_tokens (
+    token_hash VARCHAR2(255 CHAR) NOT NULL,
+    claims CLOB NOT NULL,
+    exp TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
+    CONSTRAINT reference_tokens_pk PRIMARY KEY (token_hash)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE refresh_token_families (
+    fid VARCHAR2(255 CHAR) CONSTRAINT refresh_token_families_pk PRIMARY KEY,
+    user_id VARCHAR2(255 CHAR) NOT NULL,
+    client_id VARCHAR2(255 CHAR) NOT NULL,
+    jti VARCHAR2(255 CHAR) NOT NULL,
+    revoked NUMBER(1, 0) DEFAULT 0 NOT NULL,
+    exp TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
+    last_modified TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL
+);
@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    kid VARCHAR2(255 CHAR) CONSTRAINT signing_keys_pk PRIMARY KEY,
+    alg VARCHAR2(10 CHAR) NOT NULL,
+    private_key CLOB NOT NULL,
+    not_before TIMESTAMP(3) WITH TIME ZONE NOT NULL CONSTRAINT signing_keys_not_before_uk UNIQUE,
+    not_after TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+    expiry TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL
+);
@@ -3,3 +3,11 @@ CREATE TABLE token_revocation_list (
     rvt TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
     exp TIMESTAMP(3) WITH TIME ZONE NOT NULL
 );
+
+CREATE TABLE token_revocation_cutoffs (
+    user_id VARCHAR2(255 CHAR) NOT NULL,
+    client_id VARCHAR2(255 CHAR) NOT NULL,
+    rvb TIMESTAMP(3) WITH TIME ZONE NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
+    CONSTRAINT token_revocation_cutoffs_pk PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE webauthn_credentials (
+    credential_id VARCHAR2(255 CHAR) NOT NULL,
+    user_id VARCHAR2(255 CHAR) NOT NULL,
+    credential CLOB NOT NULL,
+    created TIMESTAMP(3) WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP(3) NOT NULL,
+    last_used TIMESTAMP(3) WITH TIME ZONE,
+    CONSTRAINT webauthn_credentials_pk PRIMARY KEY (credential_id)
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (lower(user_id));
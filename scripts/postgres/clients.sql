@@ -5,6 +5,29 @@ CREATE TABLE clients (
     session_name VARCHAR,
     disable_implicit BOOLEAN NOT NULL DEFAULT FALSE,
     enable_refresh_token_rotation BOOLEAN NOT NULL DEFAULT FALSE,
+    refresh_token_ttl INTEGER,
+    refresh_token_max_ttl INTEGER,
+    offline_session_ttl INTEGER,
+    grant_types VARCHAR,
+    response_types VARCHAR,
+    allowed_scopes VARCHAR,
+    default_scopes VARCHAR,
+    access_token_ttl INTEGER,
+    id_token_ttl INTEGER,
+    code_ttl INTEGER,
+    access_token_extra_claims VARCHAR,
+    id_token_extra_claims VARCHAR,
+    released_attributes VARCHAR,
+    jwks_uri VARCHAR,
+    id_token_encrypted_response_alg VARCHAR,
+    id_token_encrypted_response_enc VARCHAR,
+    userinfo_signed_response_alg VARCHAR,
+    userinfo_encrypted_response_alg VARCHAR,
+    userinfo_encrypted_response_enc VARCHAR,
+    subject_type VARCHAR,
+    sector_identifier VARCHAR,
+    access_token_format VARCHAR,
+    require_mfa BOOLEAN NOT NULL DEFAULT FALSE,
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     last_modified TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
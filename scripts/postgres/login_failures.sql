@@ -0,0 +1,5 @@
+CREATE TABLE login_failures (
+    id VARCHAR PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE pairwise_subjects (
+    sector_id VARCHAR NOT NULL,
+    sub VARCHAR NOT NULL,
+    user_id VARCHAR NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT pairwise_subjects_pk PRIMARY KEY (sector_id, sub)
+);
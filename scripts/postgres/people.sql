@@ -11,6 +11,16 @@ CREATE TABLE people (
     street_address VARCHAR,
     locality VARCHAR,
     postal_code VARCHAR,
+    otp_secret VARCHAR,
+    otp_recovery_codes VARCHAR,
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     last_modified TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
+
+CREATE TABLE password_history (
+    user_id VARCHAR NOT NULL,
+    password_hash VARCHAR NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX password_history_idx1 ON password_history (user_id, created);
@@ -0,0 +1,7 @@
+CREATE TABLE reference_tokens (
+    token_hash VARCHAR NOT NULL,
+    claims VARCHAR NOT NULL,
+    exp TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT reference_tokens_pk PRIMARY KEY (token_hash)
+);
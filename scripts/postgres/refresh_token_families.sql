@@ -0,0 +1,10 @@
+CREATE TABLE refresh_token_families (
+    fid VARCHAR PRIMARY KEY,
+    user_id VARCHAR NOT NULL,
+    client_id VARCHAR NOT NULL,
+    jti VARCHAR NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    exp TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_modified TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
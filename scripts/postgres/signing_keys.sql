@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    kid VARCHAR PRIMARY KEY,
+    alg VARCHAR NOT NULL,
+    private_key VARCHAR NOT NULL,
+    not_before TIMESTAMP WITH TIME ZONE NOT NULL CONSTRAINT signing_keys_not_before_uk UNIQUE,
+    not_after TIMESTAMP WITH TIME ZONE NOT NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -3,3 +3,11 @@ CREATE TABLE token_revocation_list (
     rvt TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     exp TIMESTAMP WITH TIME ZONE NOT NULL
 );
+
+CREATE TABLE token_revocation_cutoffs (
+    user_id VARCHAR NOT NULL,
+    client_id VARCHAR NOT NULL,
+    rvb TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT token_revocation_cutoffs_pk PRIMARY KEY (user_id, client_id)
+);
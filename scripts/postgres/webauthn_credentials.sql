@@ -0,0 +1,10 @@
+CREATE TABLE webauthn_credentials (
+    credential_id VARCHAR NOT NULL,
+    user_id VARCHAR NOT NULL,
+    credential VARCHAR NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT webauthn_credentials_pk PRIMARY KEY (credential_id)
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (lower(user_id));
@@ -0,0 +1,146 @@
+//go:build softhsm && cgo
+
+// Run with SoftHSM installed: go test -tags softhsm ./settings/
+// SOFTHSM2_MODULE overrides the module path /usr/lib/softhsm/libsofthsm2.so.
+
+package settings
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/ThalesGroup/crypto11"
+	"github.com/cwkr/authd/internal/oauth2"
+	"github.com/cwkr/authd/internal/oauth2/keys"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	softHSMTokenLabel = "authd-test"
+	softHSMPIN        = "1234"
+)
+
+// newSoftHSMToken initializes an empty SoftHSM token in a temporary directory and returns the module path
+func newSoftHSMToken(t *testing.T) string {
+	var module = os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		module = "/usr/lib/softhsm/libsofthsm2.so"
+	}
+	if _, err := os.Stat(module); err != nil {
+		t.Skipf("SoftHSM module not available: %v", err)
+	}
+	var util, err = exec.LookPath("softhsm2-util")
+	if err != nil {
+		t.Skip("softhsm2-util not available")
+	}
+
+	var dir = t.TempDir()
+	var conf = filepath.Join(dir, "softhsm2.conf")
+	if err := os.Mkdir(filepath.Join(dir, "tokens"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+filepath.Join(dir, "tokens")+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	if output, err := exec.Command(util, "--init-token", "--free", "--label", softHSMTokenLabel, "--pin", softHSMPIN, "--so-pin", "4321").CombinedOutput(); err != nil {
+		t.Fatalf("softhsm2-util: %v\n%s", err, output)
+	}
+	return module
+}
+
+func TestPKCS11ECDSAKey(t *testing.T) {
+	var module = newSoftHSMToken(t)
+
+	var context, err = crypto11.Configure(&crypto11.Config{Path: module, TokenLabel: softHSMTokenLabel, Pin: softHSMPIN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := context.GenerateECDSAKeyPairWithLabel([]byte{0x01}, []byte("sigkey"), elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicKey = generated.Public().(*ecdsa.PublicKey)
+	if err := context.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pkcs11.pin"), []byte(softHSMPIN+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var server = NewDefault(6080)
+	server.PKCS11 = &keys.PKCS11Settings{Module: module, TokenLabel: softHSMTokenLabel, PIN: "@pkcs11.pin", KeyLabel: "sigkey"}
+	if err := server.LoadKeys(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := server.KeyManager().Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyID != "sigkey" || key.Algorithm != jose.ES256 {
+		t.Fatalf("key %s with %s, want sigkey with ES256", key.KeyID, key.Algorithm)
+	}
+	signer, err := key.Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(map[string]any{"sub": "alice"}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// JWS wants R || S with 32 bytes each instead of the DER encoding the token returns
+	var parts = strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != 64 {
+		t.Fatalf("signature has %d bytes, want 64", len(signature))
+	}
+	var digest = sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(publicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		t.Fatal("signature does not verify with the token's public key")
+	}
+
+	// the public key of the token is published
+	var recorder = httptest.NewRecorder()
+	oauth2.JwksHandler(server.KeySetProvider()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/jwks", nil))
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(recorder.Body.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	var published = jwks.Key("sigkey")
+	if len(published) != 1 {
+		t.Fatalf("sigkey not in JWKS: %s", recorder.Body.String())
+	}
+	if publishedKey, ok := published[0].Key.(*ecdsa.PublicKey); !ok || !publishedKey.Equal(publicKey) {
+		t.Fatalf("JWKS holds another key: %s", recorder.Body.String())
+	}
+
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := parsed.Claims(published[0].Key, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "alice" {
+		t.Errorf("sub = %v", claims["sub"])
+	}
+}